@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/neptship/calc-yandex-go/internal/agent"
 	"github.com/neptship/calc-yandex-go/internal/config"
 	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
 )
 
 func main() {
@@ -23,30 +27,57 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "calc-agent")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	grpcHost := os.Getenv("GRPC_HOST")
 	if grpcHost == "" {
 		grpcHost = cfg.GRPCHost
 	}
 	grpcAddr := fmt.Sprintf("%s:%d", grpcHost, cfg.GRPCPort)
 
-	grpcClient, err := grpc.NewGRPCClient(grpcAddr)
+	dialOptions, err := grpc.ClientOptions(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure gRPC credentials: %v", err)
+	}
+
+	grpcClient, err := grpc.NewGRPCClient(grpcAddr, agent.NewIdentity(cfg), dialOptions...)
 	if err != nil {
 		log.Fatalf("Failed to connect to gRPC server: %v", err)
 	}
 	defer grpcClient.Close()
 
-	log.Printf("Starting %d agent workers with gRPC connection to %s", cfg.ComputingPower, grpcAddr)
-
-	for i := 0; i < cfg.ComputingPower; i++ {
-		go func(workerID int) {
-			agent.RunWorker(ctx, workerID, cfg, grpcClient)
-		}(i + 1)
+	if cfg.AgentMetricsPort > 0 {
+		go serveMetrics(cfg.AgentMetricsPort)
 	}
 
+	log.Printf("Starting agent with %d workers and gRPC connection to %s", cfg.ComputingPower, grpcAddr)
+
+	go agent.Run(ctx, cfg, grpcClient)
+
 	<-ctx.Done()
 	log.Println("Shutting down agent workers...")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer shutdownCancel()
 	<-shutdownCtx.Done()
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+}
+
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(metrics.AgentCollectors()...))
+
+	addr := ":" + strconv.Itoa(port)
+	log.Printf("Serving metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
 }
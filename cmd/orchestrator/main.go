@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/neptship/calc-yandex-go/internal/auth"
 	"github.com/neptship/calc-yandex-go/internal/config"
 	"github.com/neptship/calc-yandex-go/internal/database"
 	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/metrics"
 	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
 )
 
 func main() {
@@ -21,18 +28,42 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
+	// The orchestrator runs until it is killed, so spans are not flushed on
+	// exit; the OTLP exporter sends them every few seconds.
+	if _, err := tracing.Setup(context.Background(), cfg, "calc-orchestrator"); err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	db, err := database.NewDatabase(cfg.DBPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
-	authService, err := auth.NewService(db.GetDB())
+	jwtKeys, err := auth.LoadKeySet(cfg.JWTKeysFile, cfg.JWTSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	store := metrics.NewCountingStore(db)
+
+	authService, err := auth.NewService(store, jwtKeys,
+		time.Duration(cfg.AccessTTLMinutes)*time.Minute,
+		time.Duration(cfg.RefreshTTLHours)*time.Hour)
 	if err != nil {
 		log.Fatalf("Failed to initialize auth service: %v", err)
 	}
 
-	service := orchestrator.NewService(cfg, db)
+	service, err := orchestrator.NewService(cfg, store)
+	if err != nil {
+		log.Fatalf("Failed to initialize orchestrator service: %v", err)
+	}
+	go service.RunLeaseReaper(context.Background())
 
 	app := fiber.New()
 
@@ -43,23 +74,63 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost:3000",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Last-Event-ID",
 		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
 	}))
 
+	app.Get("/.well-known/jwks.json", auth.JWKSHandler(authService))
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler(append(metrics.OrchestratorCollectors(), service.Collector())...)))
+
 	api := app.Group("/api/v1")
 	api.Post("/register", auth.RegisterHandler(authService))
 	api.Post("/login", auth.LoginHandler(authService))
+	api.Post("/refresh", auth.RefreshHandler(authService))
+	// Registered ahead of the protected group: browsers open the stream with
+	// a ticket in the query string as they cannot send the Authorization
+	// header.
+	api.Get("/expressions/stream", auth.StreamAuthMiddleware(authService), orchestrator.StreamHandler(service))
 
 	apiProtected := api.Group("/")
 	apiProtected.Use(auth.AuthMiddleware(authService))
+	apiProtected.Post("/logout", auth.LogoutHandler(authService))
+	apiProtected.Get("/sessions", auth.GetSessionsHandler(authService))
+	apiProtected.Delete("/sessions/:id", auth.RevokeSessionHandler(authService))
 	apiProtected.Post("/calculate", orchestrator.CalculateHandler(service))
 	apiProtected.Get("/expressions", orchestrator.GetExpressionsHandler(service))
+	apiProtected.Post("/expressions/stream/ticket", auth.StreamTicketHandler(authService))
 	apiProtected.Get("/expressions/:id", orchestrator.GetExpressionHandler(service))
+	apiProtected.Delete("/expressions/:id", orchestrator.CancelExpressionHandler(service))
+	apiProtected.Get("/expressions/:id/tasks", orchestrator.GetTaskGraphHandler(service))
+	apiProtected.Get("/admin/agents", auth.AdminMiddleware(strings.Split(cfg.AdminLogins, ",")), orchestrator.AgentsHandler(service))
+
+	// agentAuth guards only the task routes of HTTP agents, not everything
+	// under /internal.
+	agentAuth := func(c *fiber.Ctx) error { return c.Next() }
+	switch {
+	case cfg.AgentToken != "":
+		agentAuth = auth.AgentTokenMiddleware(cfg.AgentToken)
+	case grpc.AgentAuthEnabled(cfg):
+		// Client certificates are only checked by the gRPC server, so with
+		// mutual TLS alone no HTTP agent can be authenticated.
+		log.Println("Agents authenticate with client certificates, HTTP agent routes are disabled")
+		agentAuth = func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "HTTP agent routes require AGENT_TOKEN",
+			})
+		}
+	default:
+		log.Println("WARNING: neither AGENT_TOKEN nor GRPC_TLS_CERT+GRPC_TLS_CA is set, agents are not authenticated")
+	}
 
 	internal := app.Group("/internal")
-	internal.Get("/task", orchestrator.GetTaskHandler(service))
-	internal.Post("/task", orchestrator.SubmitTaskResultHandler(service))
+	internal.Get("/task", agentAuth, orchestrator.GetTaskHandler(service))
+	internal.Post("/task", agentAuth, orchestrator.SubmitTaskResultHandler(service))
+	internal.Post("/task/lease", agentAuth, orchestrator.ExtendLeaseHandler(service))
+
+	grpcOptions, err := grpc.ServerOptions(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure gRPC credentials: %v", err)
+	}
 
 	go func() {
 		grpcAddr := fmt.Sprintf("%s:%d", "0.0.0.0", cfg.GRPCPort)
@@ -68,7 +139,7 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to listen for gRPC: %v", err)
 		}
-		if err := grpc.StartGRPCServer(service, lis); err != nil {
+		if err := grpc.StartGRPCServer(service, lis, grpcOptions...); err != nil {
 			log.Fatalf("Failed to start gRPC server: %v", err)
 		}
 	}()
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/database"
+)
+
+const migrateUsage = `usage: orchestrator migrate <command>
+
+commands:
+  status      list migrations and whether they are applied
+  up          apply pending migrations
+  down [n]    revert the last n migrations (default 1), dropping their data`
+
+// runMigrate handles "orchestrator migrate ..." without starting the servers.
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	db, err := database.Open(cfg.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		statuses, err := database.MigrationStatuses(db)
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			name, appliedAt := status.Name, "pending"
+			if name == "" {
+				name = "(unknown to this binary)"
+			}
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, name, appliedAt)
+		}
+		w.Flush()
+	case "up":
+		applied, err := database.MigrateUp(db)
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				log.Fatalf("Invalid number of migrations: %s", args[1])
+			}
+		}
+		if err := database.MigrateDown(db, steps); err != nil {
+			log.Fatalf("Failed to revert migrations: %v", err)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
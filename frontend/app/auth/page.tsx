@@ -67,7 +67,7 @@ export default function AuthPage() {
         login(data.token, {
           id: userId,
           username: userLogin
-        })
+        }, data.refresh_token, data.expires_in)
 
         router.push("/")
       } else {
@@ -1,10 +1,13 @@
 "use client";
 
-import { useState, useEffect, useRef } from "react";
+import { useState, useEffect } from "react";
 import { useSearchParams } from "next/navigation";
 import { ArrowRight, Loader2, LogOut, History } from "lucide-react";
 import Link from "next/link";
 import { useAuth } from "@/contexts/auth-context";
+import { useExpressionStream } from "@/lib/expression-stream";
+
+const FINAL_STATUSES = ["completed", "failed", "cancelled"];
 
 export default function Calculator() {
   const searchParams = useSearchParams();
@@ -13,9 +16,15 @@ export default function Calculator() {
   const [loading, setLoading] = useState(false);
   const [expressionId, setExpressionId] = useState<number | null>(null);
   const [history, setHistory] = useState<any[]>([]);
-  const pollInterval = useRef<NodeJS.Timeout | null>(null);
+  const [finishedId, setFinishedId] = useState<number | null>(null);
   const { token, logout, user } = useAuth();
 
+  useExpressionStream(token, (event) => {
+    if (event.type === "expression" && FINAL_STATUSES.includes(event.status ?? "")) {
+      setFinishedId(event.expression_id);
+    }
+  }, logout);
+
   useEffect(() => {
     const savedHistory = localStorage.getItem("calculatorHistory");
     if (savedHistory) {
@@ -59,9 +68,12 @@ export default function Calculator() {
     }
   };
 
+  // The result is fetched once right after submitting, in case the
+  // expression finished before its event arrived, and again when the stream
+  // reports that an expression has finished.
   useEffect(() => {
     if (expressionId !== null && loading) {
-      const pollResult = async () => {
+      const fetchResult = async () => {
         try {
           if (!token) {
             throw new Error("Not authenticated");
@@ -85,12 +97,7 @@ export default function Calculator() {
           const data = await response.json();
           const fetchedExpr = data.expression;
           
-          if (fetchedExpr.status === "completed" || fetchedExpr.status === "failed") {
-            if (pollInterval.current) {
-              clearInterval(pollInterval.current);
-              pollInterval.current = null;
-            }
-            
+          if (FINAL_STATUSES.includes(fetchedExpr.status)) {
             if (fetchedExpr.status === "completed" && fetchedExpr.result !== null) {
               setResult(fetchedExpr.result.toString());
               
@@ -132,30 +139,16 @@ export default function Calculator() {
             setLoading(false);
           }
         } catch (error) {
-          console.error("Ошибка при опросе результата:", error);
-          
-          if (pollInterval.current) {
-            clearInterval(pollInterval.current);
-            pollInterval.current = null;
-          }
+          console.error("Ошибка при получении результата:", error);
           
           setResult("Ошибка запроса");
           setLoading(false);
         }
       };
 
-      pollResult();
-      
-      pollInterval.current = setInterval(pollResult, 1000);
-
-      return () => {
-        if (pollInterval.current) {
-          clearInterval(pollInterval.current);
-          pollInterval.current = null;
-        }
-      };
+      fetchResult();
     }
-  }, [expressionId, loading, token, logout, expression]);
+  }, [expressionId, finishedId, loading, token, logout, expression]);
 
   const handleInputChange = (e: React.ChangeEvent<HTMLInputElement>) => {
     const value = e.target.value;
@@ -12,16 +12,22 @@ type User = {
 type AuthContextType = {
   user: User | null
   token: string | null
-  login: (token: string, userData: User) => void
+  login: (token: string, userData: User, refreshToken?: string, expiresIn?: number) => void
   logout: () => void
   isLoading: boolean
 }
 
+const API_URL = "http://localhost:8080/api/v1"
+
+// Access tokens are refreshed this long before they expire.
+const REFRESH_MARGIN_MS = 60 * 1000
+
 const AuthContext = createContext<AuthContextType | undefined>(undefined)
 
 export function AuthProvider({ children }: { children: ReactNode }) {
   const [user, setUser] = useState<User | null>(null)
   const [token, setToken] = useState<string | null>(null)
+  const [expiresAt, setExpiresAt] = useState<number | null>(null)
   const [isLoading, setIsLoading] = useState(true)
   const router = useRouter()
 
@@ -30,13 +36,15 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       const storedToken = localStorage.getItem("token")
       const storedUser = localStorage.getItem("user")
       
+      const storedExpiresAt = localStorage.getItem("tokenExpiresAt")
+      
       if (storedToken && storedUser) {
         setToken(storedToken)
         setUser(JSON.parse(storedUser))
+        setExpiresAt(storedExpiresAt ? Number(storedExpiresAt) : null)
       }
     } catch (error) {
-      localStorage.removeItem("token")
-      localStorage.removeItem("user")
+      clearStorage()
     } finally {
       setIsLoading(false)
     }
@@ -56,24 +64,87 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
   }, [isLoading, token, router])
 
-  const login = (newToken: string, userData: User) => {
+  useEffect(() => {
+    if (!token || !expiresAt) {
+      return
+    }
+
+    const timer = setTimeout(async () => {
+      const refreshToken = localStorage.getItem("refreshToken")
+      if (!refreshToken) {
+        return
+      }
+
+      try {
+        const response = await fetch(`${API_URL}/refresh`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refresh_token: refreshToken }),
+        })
+
+        if (response.status === 401) {
+          endSession()
+          return
+        }
+        if (!response.ok) {
+          return
+        }
+
+        const data = await response.json()
+        saveTokens(data.token, data.refresh_token, data.expires_in)
+      } catch (error) {
+        console.error("Token refresh error:", error)
+      }
+    }, Math.max(expiresAt - Date.now() - REFRESH_MARGIN_MS, 0))
+
+    return () => clearTimeout(timer)
+  }, [token, expiresAt])
+
+  const saveTokens = (newToken: string, refreshToken?: string, expiresIn?: number) => {
+    const newExpiresAt = expiresIn ? Date.now() + expiresIn * 1000 : null
+
     setToken(newToken)
+    setExpiresAt(newExpiresAt)
+
+    localStorage.setItem("token", newToken)
+    if (refreshToken) {
+      localStorage.setItem("refreshToken", refreshToken)
+    }
+    if (newExpiresAt) {
+      localStorage.setItem("tokenExpiresAt", String(newExpiresAt))
+    } else {
+      localStorage.removeItem("tokenExpiresAt")
+    }
+  }
+
+  const login = (newToken: string, userData: User, refreshToken?: string, expiresIn?: number) => {
     setUser(userData)
+    saveTokens(newToken, refreshToken, expiresIn)
     
-    localStorage.setItem("token", newToken)
     localStorage.setItem("user", JSON.stringify(userData))
   }
 
-  const logout = () => {
+  const endSession = () => {
     setToken(null)
     setUser(null)
+    setExpiresAt(null)
     
-    localStorage.removeItem("token")
-    localStorage.removeItem("user")
+    clearStorage()
     
     router.push("/auth")
   }
 
+  const logout = () => {
+    if (token) {
+      fetch(`${API_URL}/logout`, {
+        method: "POST",
+        headers: { Authorization: `Bearer ${token}` },
+      }).catch((error) => console.error("Logout error:", error))
+    }
+
+    endSession()
+  }
+
   return (
     <AuthContext.Provider value={{ user, token, login, logout, isLoading }}>
       {children}
@@ -81,6 +152,13 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   )
 }
 
+function clearStorage() {
+  localStorage.removeItem("token")
+  localStorage.removeItem("refreshToken")
+  localStorage.removeItem("tokenExpiresAt")
+  localStorage.removeItem("user")
+}
+
 export const useAuth = () => {
   const context = useContext(AuthContext)
   if (context === undefined) {
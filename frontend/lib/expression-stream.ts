@@ -0,0 +1,114 @@
+"use client"
+
+import { useEffect, useRef } from "react"
+
+const API_URL = "http://localhost:8080/api/v1"
+
+// Delay before the stream is reopened after a failure.
+const RECONNECT_DELAY_MS = 1000
+
+export type ExpressionEvent = {
+  id: number
+  type: "expression" | "task"
+  expression_id: number
+  status?: string
+  result?: number
+  fraction?: string
+  error?: string
+  task_id?: number
+  operation?: string
+  completed_tasks?: number
+  total_tasks?: number
+}
+
+// Subscribes to the events of the user's expressions while token is set.
+// EventSource cannot send the Authorization header, so every connection is
+// opened with a fresh single-use ticket; after a failure the stream is
+// reopened with a new ticket and resumes from the last received event.
+export function useExpressionStream(
+  token: string | null,
+  onEvent: (event: ExpressionEvent) => void,
+  onUnauthorized?: () => void,
+) {
+  const eventHandler = useRef(onEvent)
+  const unauthorizedHandler = useRef(onUnauthorized)
+  eventHandler.current = onEvent
+  unauthorizedHandler.current = onUnauthorized
+
+  useEffect(() => {
+    if (!token) {
+      return
+    }
+
+    let source: EventSource | null = null
+    let timer: ReturnType<typeof setTimeout> | null = null
+    let lastEventId = ""
+    let stopped = false
+
+    const reconnect = () => {
+      if (!stopped) {
+        timer = setTimeout(connect, RECONNECT_DELAY_MS)
+      }
+    }
+
+    const handleMessage = (message: MessageEvent) => {
+      lastEventId = message.lastEventId || lastEventId
+      try {
+        eventHandler.current(JSON.parse(message.data))
+      } catch (error) {
+        console.error("Failed to parse stream event:", error)
+      }
+    }
+
+    const connect = async () => {
+      try {
+        const response = await fetch(`${API_URL}/expressions/stream/ticket`, {
+          method: "POST",
+          headers: { Authorization: `Bearer ${token}` },
+        })
+
+        if (response.status === 401) {
+          unauthorizedHandler.current?.()
+          return
+        }
+        if (!response.ok) {
+          throw new Error(`ticket request failed with status ${response.status}`)
+        }
+
+        const { ticket } = await response.json()
+        if (stopped) {
+          return
+        }
+
+        const params = new URLSearchParams({ ticket })
+        if (lastEventId) {
+          params.set("last_event_id", lastEventId)
+        }
+
+        source = new EventSource(`${API_URL}/expressions/stream?${params}`)
+        source.addEventListener("expression", handleMessage)
+        source.addEventListener("task", handleMessage)
+        // The ticket is spent, so the built-in reconnect of EventSource
+        // would be rejected; reopen the stream with a new ticket instead.
+        source.onerror = () => {
+          source?.close()
+          source = null
+          reconnect()
+        }
+      } catch (error) {
+        console.error("Expression stream error:", error)
+        reconnect()
+      }
+    }
+
+    connect()
+
+    return () => {
+      stopped = true
+      if (timer) {
+        clearTimeout(timer)
+      }
+      source?.close()
+    }
+  }, [token])
+}
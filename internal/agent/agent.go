@@ -5,12 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"time"
 
 	"github.com/neptship/calc-yandex-go/internal/config"
 	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
 	"github.com/neptship/calc-yandex-go/pkg/calculation"
 	pb "github.com/neptship/calc-yandex-go/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func RunWorker(ctx context.Context, id int, cfg *config.Config, client *grpc.GRPCClient) {
@@ -22,8 +28,9 @@ func RunWorker(ctx context.Context, id int, cfg *config.Config, client *grpc.GRP
 			log.Printf("Worker %d shutting down", id)
 			return
 		default:
-			task, err := client.FetchTask(ctx)
+			taskCtx, task, err := client.FetchTask(ctx)
 			if err != nil {
+				metrics.AgentFetchErrors.Inc()
 				log.Printf("Worker %d failed to fetch task: %v", id, err)
 				time.Sleep(time.Duration(cfg.AgentPeriodicityMs) * time.Millisecond)
 				continue
@@ -34,52 +41,165 @@ func RunWorker(ctx context.Context, id int, cfg *config.Config, client *grpc.GRP
 				continue
 			}
 
-			log.Printf("Worker %d processing task ID=%d", id, task.TaskId)
+			executeTask(taskCtx, id, cfg, client, client, task)
+			time.Sleep(time.Duration(cfg.AgentPeriodicityMs) * time.Millisecond)
+		}
+	}
+}
 
-			var arg1, arg2 interface{}
+// resultSender is where results go: the unary RPC or the task stream.
+type resultSender interface {
+	SubmitResult(ctx context.Context, taskID int, leaseID string, result float64, isError bool, errorMsg string) error
+	SubmitExactResult(ctx context.Context, taskID int, leaseID string, result *big.Rat) error
+}
 
-			switch t := task.Arg1.(type) {
-			case *pb.TaskResponse_NumberArg1:
-				arg1 = t.NumberArg1
-			case *pb.TaskResponse_StringArg1:
-				arg1 = t.StringArg1
-			}
+// executeTask continues the trace of the expression found in ctx; the span
+// is sent back with the result.
+func executeTask(ctx context.Context, id int, cfg *config.Config, client *grpc.GRPCClient, sender resultSender, task *pb.TaskResponse) {
+	log.Printf("Worker %d processing task ID=%d", id, task.TaskId)
 
-			switch t := task.Arg2.(type) {
-			case *pb.TaskResponse_NumberArg2:
-				arg2 = t.NumberArg2
-			case *pb.TaskResponse_StringArg2:
-				arg2 = t.StringArg2
-			}
+	ctx, span := tracing.Tracer().Start(ctx, "executeTask", trace.WithAttributes(
+		attribute.Int("task.id", int(task.TaskId)),
+		attribute.Int("expression.id", int(task.ExpressionId)),
+		attribute.String("task.operation", task.Operation),
+		attribute.String("agent.id", client.AgentID()),
+		attribute.Int("worker.id", id),
+	))
+	defer span.End()
+
+	metrics.AgentBusyWorkers.Inc()
+	defer metrics.AgentBusyWorkers.Dec()
 
-			time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+	args := taskArgs(task)
 
-			result, isError, errorMsg := performOperation(task.Operation, arg1, arg2)
+	taskCtx, cancelTask := context.WithCancel(ctx)
+	go renewLease(taskCtx, id, cfg, client, task, cancelTask)
 
-			err = client.SubmitResult(ctx, int(task.TaskId), result, isError, errorMsg)
+	select {
+	case <-time.After(time.Duration(task.OperationTime) * time.Millisecond):
+	case <-taskCtx.Done():
+	}
+
+	if taskCtx.Err() != nil {
+		cancelTask()
+		span.SetStatus(codes.Error, "task abandoned")
+		log.Printf("Worker %d abandoned task ID=%d", id, task.TaskId)
+		return
+	}
+
+	var err error
+	if task.Exact {
+		result, isError, errorMsg := performExactOperation(task.Operation, args)
+		cancelTask()
+		if isError {
+			span.SetStatus(codes.Error, errorMsg)
+		}
+
+		if isError {
+			err = sender.SubmitResult(ctx, int(task.TaskId), task.LeaseId, 0, true, errorMsg)
+		} else {
+			err = sender.SubmitExactResult(ctx, int(task.TaskId), task.LeaseId, result)
+		}
+		if err != nil {
+			tracing.RecordError(span, err)
+			metrics.AgentSubmitErrors.Inc()
+			log.Printf("Worker %d failed to submit result: %v", id, err)
+		} else {
+			metrics.AgentTasksCompleted.Inc()
+			log.Printf("Worker %d submitted exact result for task ID=%d: %s", id, task.TaskId, result)
+		}
+	} else {
+		result, isError, errorMsg := performOperation(task.Operation, args)
+		cancelTask()
+		if isError {
+			span.SetStatus(codes.Error, errorMsg)
+		}
+
+		err = sender.SubmitResult(ctx, int(task.TaskId), task.LeaseId, result, isError, errorMsg)
+		if err != nil {
+			tracing.RecordError(span, err)
+			metrics.AgentSubmitErrors.Inc()
+			log.Printf("Worker %d failed to submit result: %v", id, err)
+		} else {
+			metrics.AgentTasksCompleted.Inc()
+			log.Printf("Worker %d submitted result for task ID=%d: %f", id, task.TaskId, result)
+		}
+	}
+}
+
+func renewLease(ctx context.Context, id int, cfg *config.Config, client *grpc.GRPCClient, task *pb.TaskResponse, cancelTask context.CancelFunc) {
+	interval := time.Duration(cfg.LeaseGraceMs/2) * time.Millisecond
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := client.ExtendLease(ctx, int(task.TaskId), task.LeaseId)
+			if errors.Is(err, grpc.ErrTaskCancelled) {
+				log.Printf("Worker %d: expression of task ID=%d was cancelled", id, task.TaskId)
+				cancelTask()
+				return
+			}
 			if err != nil {
-				log.Printf("Worker %d failed to submit result: %v", id, err)
-			} else {
-				log.Printf("Worker %d submitted result for task ID=%d: %f", id, task.TaskId, result)
+				log.Printf("Worker %d failed to extend lease for task ID=%d: %v", id, task.TaskId, err)
 			}
-
-			time.Sleep(time.Duration(cfg.AgentPeriodicityMs) * time.Millisecond)
 		}
 	}
 }
 
-func performOperation(operation string, arg1, arg2 interface{}) (float64, bool, string) {
-	val1, err1 := convertToFloat64(arg1)
-	if err1 != nil {
-		return 0, true, "Error converting first argument: " + err1.Error()
+func taskArgs(task *pb.TaskResponse) []interface{} {
+	if len(task.Args) > 0 {
+		args := make([]interface{}, len(task.Args))
+		for i, operand := range task.Args {
+			switch v := operand.Value.(type) {
+			case *pb.Operand_Number:
+				args[i] = v.Number
+			case *pb.Operand_Ref:
+				args[i] = v.Ref
+			case *pb.Operand_Rational:
+				args[i] = v.Rational
+			}
+		}
+		return args
+	}
+
+	var arg1, arg2 interface{}
+
+	switch t := task.Arg1.(type) {
+	case *pb.TaskResponse_NumberArg1:
+		arg1 = t.NumberArg1
+	case *pb.TaskResponse_StringArg1:
+		arg1 = t.StringArg1
 	}
 
-	val2, err2 := convertToFloat64(arg2)
-	if err2 != nil {
-		return 0, true, "Error converting second argument: " + err2.Error()
+	switch t := task.Arg2.(type) {
+	case *pb.TaskResponse_NumberArg2:
+		arg2 = t.NumberArg2
+	case *pb.TaskResponse_StringArg2:
+		arg2 = t.StringArg2
 	}
 
-	result, err := calculation.EvaluateOperation(val1, val2, operation)
+	return []interface{}{arg1, arg2}
+}
+
+func performOperation(operation string, args []interface{}) (float64, bool, string) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, err := convertToFloat64(arg)
+		if err != nil {
+			return 0, true, fmt.Sprintf("Error converting argument %d: %v", i+1, err)
+		}
+		values[i] = value
+	}
+
+	result, err := calculation.ApplyOperation(operation, values)
 	if err != nil {
 		return 0, true, "Operation error: " + err.Error()
 	}
@@ -87,6 +207,35 @@ func performOperation(operation string, arg1, arg2 interface{}) (float64, bool,
 	return result, false, ""
 }
 
+func performExactOperation(operation string, args []interface{}) (*big.Rat, bool, string) {
+	values := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		value, err := convertToRat(arg)
+		if err != nil {
+			return nil, true, fmt.Sprintf("Error converting argument %d: %v", i+1, err)
+		}
+		values[i] = value
+	}
+
+	result, err := calculation.ApplyExactOperation(operation, values)
+	if err != nil {
+		return nil, true, "Operation error: " + err.Error()
+	}
+
+	return result, false, ""
+}
+
+func convertToRat(val interface{}) (*big.Rat, error) {
+	switch v := val.(type) {
+	case *big.Rat:
+		return v, nil
+	case string:
+		return calculation.ParseRat(v)
+	default:
+		return nil, errors.New("unsupported argument type")
+	}
+}
+
 func convertToFloat64(val interface{}) (float64, error) {
 	switch v := val.(type) {
 	case float64:
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/neptship/calc-yandex-go/internal/models"
@@ -65,3 +66,80 @@ func TestExecuteOperation(t *testing.T) {
 		})
 	}
 }
+
+func TestPerformOperation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		operation string
+		args      []interface{}
+		expected  float64
+		hasError  bool
+	}{
+		{"сложение", "+", []interface{}{5.0, 3.0}, 8.0, false},
+		{"степень", "^", []interface{}{2.0, 10.0}, 1024.0, false},
+		{"дробная степень", "^", []interface{}{9.0, 0.5}, 3.0, false},
+		{"корень из отрицательного", "^", []interface{}{-9.0, 0.5}, 0.0, true},
+		{"аргумент строкой", "^", []interface{}{"3", 2.0}, 9.0, false},
+		{"корень", "sqrt", []interface{}{16.0}, 4.0, false},
+		{"sqrt(-1)", "sqrt", []interface{}{-1.0}, 0.0, true},
+		{"log(0)", "log", []interface{}{0.0}, 0.0, true},
+		{"максимум из трёх", "max", []interface{}{1.0, 7.0, 3.0}, 7.0, false},
+		{"лишний аргумент", "abs", []interface{}{1.0, 2.0}, 0.0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, isError, errorMsg := performOperation(tc.operation, tc.args)
+
+			if tc.hasError {
+				if !isError {
+					t.Errorf("ожидалась ошибка для операции '%s', но её нет", tc.operation)
+				}
+				return
+			}
+			if isError {
+				t.Fatalf("неожиданная ошибка для операции '%s': %s", tc.operation, errorMsg)
+			}
+			if result != tc.expected {
+				t.Errorf("для операции '%s': ожидалось %f, получено %f", tc.operation, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPerformExactOperation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		operation string
+		args      []interface{}
+		expected  string
+		hasError  bool
+	}{
+		{"сложение десятичных", "+", []interface{}{"1/10", "1/5"}, "3/10", false},
+		{"треть на три", "*", []interface{}{big.NewRat(1, 3), "3"}, "1/1", false},
+		{"целая степень", "^", []interface{}{"2/3", "-2"}, "9/4", false},
+		{"дробная степень", "^", []interface{}{"9", "1/2"}, "", true},
+		{"деление на ноль", "/", []interface{}{"1", "0"}, "", true},
+		{"неточная функция", "sin", []interface{}{"1"}, "", true},
+		{"некорректная дробь", "+", []interface{}{"1/x", "1"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, isError, errorMsg := performExactOperation(tc.operation, tc.args)
+
+			if tc.hasError {
+				if !isError {
+					t.Errorf("ожидалась ошибка для операции '%s', но её нет", tc.operation)
+				}
+				return
+			}
+			if isError {
+				t.Fatalf("неожиданная ошибка для операции '%s': %s", tc.operation, errorMsg)
+			}
+			if result.String() != tc.expected {
+				t.Errorf("для операции '%s': ожидалось %s, получено %s", tc.operation, tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Version is reported to the orchestrator on registration; release builds
+// set it with -ldflags "-X github.com/neptship/calc-yandex-go/internal/agent.Version=...".
+var Version = "dev"
+
+// defaultHeartbeatInterval is used until the orchestrator tells otherwise.
+const defaultHeartbeatInterval = 5 * time.Second
+
+// NewIdentity describes this agent: AGENT_ID or the hostname with a random
+// suffix, the build version and COMPUTING_POWER.
+func NewIdentity(cfg *config.Config) grpc.AgentIdentity {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	id := cfg.AgentID
+	if id == "" {
+		b := make([]byte, 4)
+		rand.Read(b)
+		id = hostname + "-" + hex.EncodeToString(b)
+	}
+
+	return grpc.AgentIdentity{
+		ID:       id,
+		Hostname: hostname,
+		Version:  Version,
+		Capacity: cfg.ComputingPower,
+	}
+}
+
+func register(ctx context.Context, client *grpc.GRPCClient) (time.Duration, error) {
+	interval, err := client.Register(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	log.Printf("Agent %s registered, heartbeat every %v", client.AgentID(), interval)
+	return interval, nil
+}
+
+// keepRegistered registers the agent, sends heartbeats and registers again
+// whenever the orchestrator has forgotten the agent, e.g. after a restart.
+// It stops if the orchestrator has no registry at all.
+func keepRegistered(ctx context.Context, client *grpc.GRPCClient, registered chan<- struct{}) {
+	interval, err := register(ctx, client)
+	close(registered)
+
+	for {
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("Orchestrator has no agent registry, heartbeats disabled")
+			return
+		}
+		if err != nil {
+			log.Printf("Agent %s failed to register: %v", client.AgentID(), err)
+			interval = defaultHeartbeatInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if err != nil {
+			interval, err = register(ctx, client)
+			continue
+		}
+
+		err = client.Heartbeat(ctx)
+		if errors.Is(err, grpc.ErrAgentNotRegistered) {
+			log.Printf("Agent %s is unknown to the orchestrator, registering again", client.AgentID())
+			interval, err = register(ctx, client)
+		} else if err != nil && status.Code(err) != codes.Unimplemented {
+			log.Printf("Agent %s failed to send heartbeat: %v", client.AgentID(), err)
+			err = nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	pb "github.com/neptship/calc-yandex-go/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Run registers the agent, keeps sending heartbeats and receives tasks over
+// TaskStream, reconnecting whenever the stream breaks. It falls back to
+// polling workers when streaming is disabled or the orchestrator is too old
+// to support it.
+func Run(ctx context.Context, cfg *config.Config, client *grpc.GRPCClient) {
+	// Tasks fetched before registration are not attributed to the agent, so
+	// wait for the first attempt.
+	registered := make(chan struct{})
+	go keepRegistered(ctx, client, registered)
+	<-registered
+
+	if !cfg.AgentStreaming {
+		RunWorkers(ctx, cfg, client)
+		return
+	}
+
+	for {
+		err := RunStream(ctx, cfg, client)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("Orchestrator does not support task streaming, falling back to polling")
+			RunWorkers(ctx, cfg, client)
+			return
+		}
+
+		metrics.AgentFetchErrors.Inc()
+		log.Printf("Task stream closed: %v, reconnecting", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(cfg.AgentPeriodicityMs) * time.Millisecond):
+		}
+	}
+}
+
+// RunWorkers starts cfg.ComputingPower polling workers and waits for them to
+// stop.
+func RunWorkers(ctx context.Context, cfg *config.Config, client *grpc.GRPCClient) {
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.ComputingPower; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			RunWorker(ctx, workerID, cfg, client)
+		}(i + 1)
+	}
+	wg.Wait()
+}
+
+// RunStream opens one TaskStream, announces cfg.ComputingPower free slots and
+// runs every task it receives, announcing the slot again once the result is
+// sent or the orchestrator withdraws the task. It returns when the stream
+// ends; tasks still running are abandoned since the orchestrator releases
+// their leases.
+func RunStream(ctx context.Context, cfg *config.Config, client *grpc.GRPCClient) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	stream, err := client.OpenTaskStream(streamCtx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Announce(cfg.ComputingPower); err != nil {
+		return err
+	}
+	log.Printf("Task stream opened with %d slots", cfg.ComputingPower)
+
+	// running cancels the tasks in progress by lease ID.
+	var (
+		runningMu sync.Mutex
+		running   = make(map[string]context.CancelFunc)
+	)
+
+	slot := 0
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch payload := msg.Payload.(type) {
+		case *pb.OrchestratorMessage_Task:
+			slot = slot%cfg.ComputingPower + 1
+			taskCtx, cancelTask := context.WithCancel(streamCtx)
+			runningMu.Lock()
+			running[payload.Task.LeaseId] = cancelTask
+			runningMu.Unlock()
+
+			wg.Add(1)
+			go func(workerID int, task *pb.TaskResponse) {
+				defer wg.Done()
+				executeTask(tracing.Extract(taskCtx, task.TraceContext), workerID, cfg, client, stream, task)
+
+				runningMu.Lock()
+				delete(running, task.LeaseId)
+				runningMu.Unlock()
+				cancelTask()
+
+				if streamCtx.Err() == nil {
+					stream.Announce(1)
+				}
+			}(slot, payload.Task)
+		case *pb.OrchestratorMessage_Result:
+			if !payload.Result.Success {
+				log.Printf("Result for task ID=%d was rejected: %s", payload.Result.TaskId, payload.Result.Message)
+			}
+		case *pb.OrchestratorMessage_Cancel:
+			runningMu.Lock()
+			cancelTask, exists := running[payload.Cancel.LeaseId]
+			runningMu.Unlock()
+			if exists {
+				log.Printf("Task ID=%d was withdrawn by the orchestrator", payload.Cancel.TaskId)
+				cancelTask()
+			}
+		}
+	}
+}
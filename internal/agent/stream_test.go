@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+	"github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	pb "github.com/neptship/calc-yandex-go/proto"
+	grpclib "google.golang.org/grpc"
+)
+
+func TestRunStreamAbandonsWithdrawnTask(t *testing.T) {
+	// The lease is only extended every 30 seconds, so the slot can free up in
+	// time only if the orchestrator withdraws the task over the stream.
+	cfg := &config.Config{
+		ComputingPower:   1,
+		MultiplicationMs: 30000,
+		LeaseGraceMs:     60000,
+	}
+
+	service, err := orchestrator.NewService(cfg, memory.New())
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("не удалось открыть порт: %v", err)
+	}
+	server := grpclib.NewServer()
+	pb.RegisterAgentServiceServer(server, grpc.NewAgentServer(service))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	opts, err := grpc.ClientOptions(cfg)
+	if err != nil {
+		t.Fatalf("не удалось настроить клиента: %v", err)
+	}
+	client, err := grpc.NewGRPCClient(lis.Addr().String(), grpc.AgentIdentity{Capacity: 1}, opts...)
+	if err != nil {
+		t.Fatalf("не удалось подключиться к серверу: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunStream(ctx, cfg, client)
+
+	slowID, err := service.AddExpression(1, "2*3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	waitForStatus(t, service, slowID, func(expr *models.Expression) bool { return expr.StartedAt != nil })
+
+	if _, err := service.CancelExpression(1, slowID); err != nil {
+		t.Fatalf("не удалось отменить выражение: %v", err)
+	}
+
+	fastID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	waitForStatus(t, service, fastID, func(expr *models.Expression) bool { return expr.Status == models.StatusCompleted })
+}
+
+func waitForStatus(t *testing.T, service *orchestrator.Service, exprID int, done func(*models.Expression) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		expr, err := service.GetExpressionByID(1, exprID)
+		if err != nil {
+			t.Fatalf("не удалось получить выражение: %v", err)
+		}
+		if done(expr) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("выражение ID=%d не дошло до ожидаемого состояния", exprID)
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminMiddleware lets through only the users whose login is listed in
+// admins; it must follow AuthMiddleware. Without any admins every request
+// is rejected.
+func AdminMiddleware(admins []string) fiber.Handler {
+	allowed := make(map[string]struct{}, len(admins))
+	for _, login := range admins {
+		if login = strings.TrimSpace(login); login != "" {
+			allowed[login] = struct{}{}
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		login, _ := c.Locals("login").(string)
+		if _, ok := allowed[login]; !ok || login == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Administrator access required",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/auth"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	service := newAuthService(t)
+	if err := service.Register("admin", "password"); err != nil {
+		t.Fatalf("не удалось зарегистрировать администратора: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/admin", auth.AuthMiddleware(service), auth.AdminMiddleware([]string{" admin", ""}), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	request := func(token string) int {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("не удалось выполнить запрос: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	login := func(name string) string {
+		t.Helper()
+
+		tokens, err := service.Login(name, "password", "test")
+		if err != nil {
+			t.Fatalf("не удалось войти как %s: %v", name, err)
+		}
+		return tokens.AccessToken
+	}
+
+	if code := request(""); code != fiber.StatusUnauthorized {
+		t.Errorf("без токена ожидался 401, получено %d", code)
+	}
+	if code := request(login("user")); code != fiber.StatusForbidden {
+		t.Errorf("для обычного пользователя ожидался 403, получено %d", code)
+	}
+	if code := request(login("admin")); code != fiber.StatusOK {
+		t.Errorf("для администратора ожидался 200, получено %d", code)
+	}
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AgentTokenMiddleware protects the /internal routes used by agents and
+// administrators with the pre-shared agent token. An empty token rejects
+// every request.
+func AgentTokenMiddleware(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		presented, found := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !found || token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid agent token",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -14,8 +14,24 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse keeps the access token in "token" for existing clients.
+// ExpiresIn is the lifetime of the access token in seconds.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func newLoginResponse(tokens *TokenPair) LoginResponse {
+	return LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}
 }
 
 func RegisterHandler(service *Service) fiber.Handler {
@@ -68,7 +84,7 @@ func LoginHandler(service *Service) fiber.Handler {
 			})
 		}
 
-		token, err := service.Login(req.Login, req.Password)
+		tokens, err := service.Login(req.Login, req.Password, c.Get(fiber.HeaderUserAgent))
 		if err != nil {
 			switch err {
 			case ErrInvalidLogin:
@@ -82,8 +98,103 @@ func LoginHandler(service *Service) fiber.Handler {
 			}
 		}
 
-		return c.Status(fiber.StatusOK).JSON(LoginResponse{
-			Token: token,
+		return c.Status(fiber.StatusOK).JSON(newLoginResponse(tokens))
+	}
+}
+
+func RefreshHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req RefreshRequest
+		if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Refresh token is required",
+			})
+		}
+
+		tokens, err := service.Refresh(req.RefreshToken)
+		if err != nil {
+			switch err {
+			case ErrInvalidRefreshToken:
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid refresh token",
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+		}
+
+		return c.Status(fiber.StatusOK).JSON(newLoginResponse(tokens))
+	}
+}
+
+// LogoutHandler ends the session the access token belongs to.
+func LogoutHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+		sessionID := c.Locals("sessionID").(string)
+
+		if err := service.RevokeSession(userID, sessionID); err != nil && err != ErrSessionNotFound {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Logged out successfully",
+		})
+	}
+}
+
+func GetSessionsHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+		sessionID := c.Locals("sessionID").(string)
+
+		sessions, err := service.Sessions(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"sessions": sessions,
+		})
+	}
+}
+
+func RevokeSessionHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+
+		err := service.RevokeSession(userID, c.Params("id"))
+		if err != nil {
+			switch err {
+			case ErrSessionNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Session not found",
+				})
+			default:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Session revoked",
+		})
+	}
+}
+
+// JWKSHandler serves the public signing keys as a JSON Web Key Set.
+func JWKSHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"keys": service.JWKS(),
 		})
 	}
 }
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrNoSigningKey = errors.New("no signing key")
+)
+
+// minSecretLength is the shortest HS256 secret accepted from configuration.
+const minSecretLength = 32
+
+// KeySet holds the keys tokens are signed and verified with. New tokens are
+// signed with the active key and carry its ID in the kid header; every key in
+// the set is accepted for verification, so a key can be rotated out by
+// making another one active and removing the old one once its tokens expire.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyFile is the format of JWT_KEYS_FILE. Each key gives exactly one of
+// Secret (HS256), PrivateKey or PublicKey, inline as PEM or as a path
+// relative to the key file. Keys with only a public key verify tokens signed
+// elsewhere and cannot be active.
+type KeyFile struct {
+	Active string      `json:"active"`
+	Keys   []KeyConfig `json:"keys"`
+}
+
+type KeyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKey     string `json:"private_key,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKey      string `json:"public_key,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// LoadKeySet reads the keys from keysFile if it is set, otherwise uses secret
+// as a single HS256 key. With neither, a random key is generated and tokens
+// stop being valid when the process restarts.
+func LoadKeySet(keysFile, secret string) (*KeySet, error) {
+	switch {
+	case keysFile != "":
+		return loadKeyFile(keysFile)
+	case secret != "":
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("JWT secret must be at least %d bytes", minSecretLength)
+		}
+		return newSecretKeySet([]byte(secret))
+	default:
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		log.Println("WARNING: neither JWT_KEYS_FILE nor JWT_SECRET is set, tokens will not survive a restart")
+		return newSecretKeySet(random)
+	}
+}
+
+// newSecretKeySet names the key after a hash of the secret, so instances
+// sharing a secret agree on the kid without configuring it.
+func newSecretKeySet(secret []byte) (*KeySet, error) {
+	sum := sha256.Sum256(secret)
+	key := &signingKey{
+		id:        hex.EncodeToString(sum[:8]),
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+	return &KeySet{
+		active: key,
+		keys:   map[string]*signingKey{key.id: key},
+	}, nil
+}
+
+func loadKeyFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT keys file: %w", err)
+	}
+
+	var file KeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse JWT keys file: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]*signingKey)}
+	dir := filepath.Dir(path)
+	for _, config := range file.Keys {
+		key, err := parseKey(config, dir)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %w", config.ID, err)
+		}
+		if _, exists := set.keys[key.id]; exists {
+			return nil, fmt.Errorf("JWT key %q is listed twice", key.id)
+		}
+		set.keys[key.id] = key
+	}
+
+	active, exists := set.keys[file.Active]
+	if !exists {
+		return nil, fmt.Errorf("active JWT key %q: %w", file.Active, ErrUnknownKey)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active JWT key %q has no private key: %w", file.Active, ErrNoSigningKey)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+func parseKey(config KeyConfig, dir string) (*signingKey, error) {
+	if config.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+
+	private, err := readPEM(config.PrivateKey, config.PrivateKeyFile, dir)
+	if err != nil {
+		return nil, err
+	}
+	public, err := readPEM(config.PublicKey, config.PublicKeyFile, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: config.ID}
+	switch config.Algorithm {
+	case "HS256":
+		if len(config.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(config.Secret)
+		key.verifyKey = []byte(config.Secret)
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if private != nil {
+			rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = rsaKey, &rsaKey.PublicKey
+		} else if public != nil {
+			if key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(public); err != nil {
+				return nil, err
+			}
+		}
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if private != nil {
+			edKey, err := jwt.ParseEdPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = edKey, edKey.(ed25519.PrivateKey).Public()
+		} else if public != nil {
+			if key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(public); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, expected HS256, RS256 or EdDSA", config.Algorithm)
+	}
+
+	if key.verifyKey == nil {
+		return nil, errors.New("private_key or public_key is required")
+	}
+	return key, nil
+}
+
+func readPEM(inline, file, dir string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	return os.ReadFile(file)
+}
+
+// Sign creates a token signed with the active key.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	return token.SignedString(k.active.signKey)
+}
+
+// Keyfunc finds the verification key by kid. The algorithm is taken from
+// the key, never from the token, so an RS256 public key cannot be used as an
+// HMAC secret.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, exists := k.keys[kid]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q expects %s, token uses %s", kid, key.method.Alg(), token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in the format of RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS lists the public keys of the set ordered by kid. HS256 secrets are
+// never published.
+func (k *KeySet) JWKS() []JWK {
+	keys := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwk := JWK{KeyID: key.id, Algorithm: key.method.Alg(), Use: "sig"}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys
+}
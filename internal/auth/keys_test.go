@@ -0,0 +1,185 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/neptship/calc-yandex-go/internal/auth"
+)
+
+func writeKeyFile(t *testing.T, dir, name string, file auth.KeyFile) string {
+	t.Helper()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("не удалось сохранить ключи: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("не удалось записать %s: %v", path, err)
+	}
+	return path
+}
+
+func writeKeyPEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatalf("не удалось записать %s: %v", name, err)
+	}
+}
+
+func issue(t *testing.T, keys *auth.KeySet, userID int) string {
+	t.Helper()
+
+	token, err := keys.Sign(auth.UserClaims{
+		UserID:         userID,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	})
+	if err != nil {
+		t.Fatalf("не удалось подписать токен: %v", err)
+	}
+	return token
+}
+
+func validate(t *testing.T, keys *auth.KeySet, token string) (*auth.UserClaims, error) {
+	t.Helper()
+
+	claims := &auth.UserClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, keys.Keyfunc); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func TestSharedSecretSurvivesRestart(t *testing.T) {
+	secret := strings.Repeat("s", 32)
+
+	first, err := auth.LoadKeySet("", secret)
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключ: %v", err)
+	}
+	second, err := auth.LoadKeySet("", secret)
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключ: %v", err)
+	}
+
+	claims, err := validate(t, second, issue(t, first, 7))
+	if err != nil || claims.UserID != 7 {
+		t.Fatalf("токен должен приниматься экземпляром с тем же секретом: %v", err)
+	}
+
+	if _, err := auth.LoadKeySet("", "short"); err == nil {
+		t.Error("короткий секрет должен отклоняться")
+	}
+	if keys := second.JWKS(); len(keys) != 0 {
+		t.Errorf("секрет HS256 не должен публиковаться, получено %v", keys)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ RSA: %v", err)
+	}
+	writeKeyPEM(t, dir, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("не удалось сохранить открытый ключ: %v", err)
+	}
+	writeKeyPEM(t, dir, "old.pub", "PUBLIC KEY", publicDER)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ Ed25519: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("не удалось сохранить ключ: %v", err)
+	}
+	writeKeyPEM(t, dir, "new.pem", "PRIVATE KEY", edDER)
+
+	before, err := auth.LoadKeySet(writeKeyFile(t, dir, "before.json", auth.KeyFile{
+		Active: "old",
+		Keys:   []auth.KeyConfig{{ID: "old", Algorithm: "RS256", PrivateKeyFile: "old.pem"}},
+	}), "")
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключи: %v", err)
+	}
+	oldToken := issue(t, before, 1)
+
+	during, err := auth.LoadKeySet(writeKeyFile(t, dir, "during.json", auth.KeyFile{
+		Active: "new",
+		Keys: []auth.KeyConfig{
+			{ID: "new", Algorithm: "EdDSA", PrivateKeyFile: "new.pem"},
+			{ID: "old", Algorithm: "RS256", PublicKeyFile: "old.pub"},
+		},
+	}), "")
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключи: %v", err)
+	}
+
+	if _, err := validate(t, during, oldToken); err != nil {
+		t.Fatalf("токен старого ключа должен приниматься во время ротации: %v", err)
+	}
+	newToken := issue(t, during, 2)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &auth.UserClaims{})
+	if err != nil || parsed.Header["kid"] != "new" || parsed.Method.Alg() != "EdDSA" {
+		t.Fatalf("новый токен должен быть подписан активным ключом, получено %v (%v)", parsed.Header, err)
+	}
+
+	jwks := during.JWKS()
+	if len(jwks) != 2 || jwks[0].KeyID != "new" || jwks[0].KeyType != "OKP" || jwks[1].KeyID != "old" || jwks[1].KeyType != "RSA" {
+		t.Fatalf("JWKS должен содержать оба открытых ключа, получено %+v", jwks)
+	}
+
+	after, err := auth.LoadKeySet(writeKeyFile(t, dir, "after.json", auth.KeyFile{
+		Active: "new",
+		Keys:   []auth.KeyConfig{{ID: "new", Algorithm: "EdDSA", PrivateKeyFile: "new.pem"}},
+	}), "")
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключи: %v", err)
+	}
+	if _, err := validate(t, after, oldToken); err == nil {
+		t.Error("токен удалённого ключа должен отклоняться")
+	}
+	if _, err := validate(t, after, newToken); err != nil {
+		t.Errorf("токен активного ключа должен приниматься: %v", err)
+	}
+
+	// A token that claims HS256 and is signed with the public RSA key must
+	// not pass as a token of the RSA key.
+	public, err := os.ReadFile(filepath.Join(dir, "old.pub"))
+	if err != nil {
+		t.Fatalf("не удалось прочитать открытый ключ: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.UserClaims{UserID: 1})
+	forged.Header["kid"] = "old"
+	forgedToken, err := forged.SignedString(public)
+	if err != nil {
+		t.Fatalf("не удалось подписать токен: %v", err)
+	}
+	if _, err := validate(t, during, forgedToken); err == nil {
+		t.Error("токен с подменённым алгоритмом должен отклоняться")
+	}
+
+	if _, err := auth.LoadKeySet(writeKeyFile(t, dir, "public-only.json", auth.KeyFile{
+		Active: "old",
+		Keys:   []auth.KeyConfig{{ID: "old", Algorithm: "RS256", PublicKeyFile: "old.pub"}},
+	}), ""); err == nil {
+		t.Error("ключ без закрытой части не может быть активным")
+	}
+}
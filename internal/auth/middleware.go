@@ -31,6 +31,8 @@ func AuthMiddleware(authService *Service) fiber.Handler {
 		}
 
 		c.Locals("userID", claims.UserID)
+		c.Locals("sessionID", claims.SessionID)
+		c.Locals("login", claims.Subject)
 
 		return c.Next()
 	}
@@ -1,13 +1,12 @@
 package auth
 
 import (
-	"crypto/rand"
-	"database/sql"
 	"errors"
-	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/neptship/calc-yandex-go/internal/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,39 +16,43 @@ var (
 	ErrInternalServer = errors.New("internal server error")
 )
 
-var globalJWTSecret []byte
-
-func init() {
-	globalJWTSecret = make([]byte, 32)
-	_, err := rand.Read(globalJWTSecret)
-	if err != nil {
-		log.Fatalf("Failed to generate JWT secret: %v", err)
-	}
-	log.Println("JWT secret generated successfully")
-}
-
 type UserClaims struct {
-	UserID int `json:"user_id"`
+	UserID    int    `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.StandardClaims
 }
 
 type Service struct {
-	db         *sql.DB
-	jwtSecret  []byte
-	jwtExpires time.Duration
+	users      database.UserStore
+	keys       *KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	ticketsMu sync.Mutex
+	tickets   map[string]streamTicket
 }
 
-func NewService(db *sql.DB) (*Service, error) {
+// NewService creates the auth service. Zero lifetimes fall back to
+// DefaultAccessTokenTTL and DefaultRefreshTokenTTL.
+func NewService(users database.UserStore, keys *KeySet, accessTTL, refreshTTL time.Duration) (*Service, error) {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+
 	return &Service{
-		db:         db,
-		jwtSecret:  globalJWTSecret,
-		jwtExpires: 24 * time.Hour,
+		users:      users,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		tickets:    make(map[string]streamTicket),
 	}, nil
 }
 
 func (s *Service) Register(login, password string) error {
-	var exists bool
-	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE login = ?)", login).Scan(&exists)
+	exists, err := s.users.CheckUserExists(login)
 	if err != nil {
 		return ErrInternalServer
 	}
@@ -62,8 +65,10 @@ func (s *Service) Register(login, password string) error {
 		return ErrInternalServer
 	}
 
-	_, err = s.db.Exec("INSERT INTO users (login, password_hash) VALUES (?, ?)",
-		login, string(hashedPassword))
+	err = s.users.CreateUser(login, string(hashedPassword))
+	if errors.Is(err, database.ErrDuplicate) {
+		return ErrUserExists
+	}
 	if err != nil {
 		return ErrInternalServer
 	}
@@ -71,51 +76,45 @@ func (s *Service) Register(login, password string) error {
 	return nil
 }
 
-func (s *Service) Login(login, password string) (string, error) {
-	var id int
-	var hashedPassword string
-	err := s.db.QueryRow("SELECT id, password_hash FROM users WHERE login = ?", login).Scan(&id, &hashedPassword)
+// Login starts a new session; userAgent is kept to tell sessions apart in
+// the list of sessions.
+func (s *Service) Login(login, password, userAgent string) (*TokenPair, error) {
+	id, hashedPassword, err := s.users.GetUserByLogin(login)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", ErrInvalidLogin
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrInvalidLogin
 		}
-		return "", ErrInternalServer
+		return nil, ErrInternalServer
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
-		return "", ErrInvalidLogin
+		return nil, ErrInvalidLogin
 	}
 
-	claims := UserClaims{
-		UserID: id,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(s.jwtExpires).Unix(),
-			Subject:   login,
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtSecret)
-	if err != nil {
-		return "", ErrInternalServer
-	}
-
-	return tokenString, nil
+	return s.createSession(id, login, userAgent)
 }
 
 func (s *Service) ValidateToken(tokenString string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return s.jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, s.keys.Keyfunc)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
 
-	return nil, errors.New("invalid token")
+	if err := s.checkSession(claims.SessionID); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys other services can verify tokens with.
+func (s *Service) JWKS() []JWK {
+	return s.keys.JWKS()
 }
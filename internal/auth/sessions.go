@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session revoked or expired")
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenPair is what a client receives on login and refresh. The access
+// token is a short-lived JWT bound to a session; the refresh token is an
+// opaque secret that is replaced on every refresh.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// Session is one login of a user, i.e. one row of refresh_tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// createSession stores a new refresh token for the user and returns the
+// token pair for it.
+func (s *Service) createSession(userID int, login, userAgent string) (*TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	now := time.Now().UTC()
+	err = s.users.CreateSession(&models.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		TokenHash:  hashToken(refreshToken),
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	return s.issueTokens(userID, login, sessionID, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The old refresh
+// token stops working, so a copied token is useless once either holder has
+// refreshed.
+func (s *Service) Refresh(refreshToken string) (*TokenPair, error) {
+	oldHash := hashToken(refreshToken)
+
+	session, err := s.users.GetSessionByTokenHash(oldHash)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	now := time.Now().UTC()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	login, err := s.users.GetUserLogin(session.UserID)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	newToken, err := randomToken(32)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	// Rotation only succeeds while the session still has the old hash, so of
+	// two concurrent refreshes with the same token only one succeeds.
+	rotated, err := s.users.RotateSession(session.ID, oldHash, hashToken(newToken), now, now.Add(s.refreshTTL))
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+	if !rotated {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(session.UserID, login, session.ID, newToken)
+}
+
+func (s *Service) issueTokens(userID int, login, sessionID, refreshToken string) (*TokenPair, error) {
+	claims := UserClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(s.accessTTL).Unix(),
+			Subject:   login,
+		},
+	}
+
+	accessToken, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.accessTTL,
+	}, nil
+}
+
+// Sessions lists the sessions of the user that can still be refreshed.
+// currentSessionID marks the session the request was made from.
+func (s *Service) Sessions(userID int, currentSessionID string) ([]Session, error) {
+	stored, err := s.users.GetUserSessions(userID)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+
+	now := time.Now()
+	sessions := []Session{}
+	for _, session := range stored {
+		if !now.Before(session.ExpiresAt) {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the user. Its refresh token stops working
+// at once and so do access tokens already issued for it.
+func (s *Service) RevokeSession(userID int, sessionID string) error {
+	revoked, err := s.users.RevokeSession(userID, sessionID, time.Now().UTC())
+	if err != nil {
+		return ErrInternalServer
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// checkSession returns ErrSessionRevoked unless the session exists, was not
+// revoked and has not expired.
+func (s *Service) checkSession(sessionID string) error {
+	if sessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	session, err := s.users.GetSession(sessionID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return ErrInternalServer
+	}
+
+	if session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is what is stored instead of the refresh token itself, so a
+// leaked database does not give out working tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
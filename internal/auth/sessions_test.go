@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/auth"
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+)
+
+func newAuthService(t *testing.T) *auth.Service {
+	t.Helper()
+
+	keys, err := auth.LoadKeySet("", strings.Repeat("s", 32))
+	if err != nil {
+		t.Fatalf("не удалось загрузить ключ: %v", err)
+	}
+	service, err := auth.NewService(memory.New(), keys, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	if err := service.Register("user", "password"); err != nil {
+		t.Fatalf("не удалось зарегистрировать пользователя: %v", err)
+	}
+	return service
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	service := newAuthService(t)
+
+	tokens, err := service.Login("user", "password", "test")
+	if err != nil {
+		t.Fatalf("не удалось войти: %v", err)
+	}
+	if tokens.ExpiresIn != time.Minute {
+		t.Errorf("время жизни токена должно быть 1m, получено %v", tokens.ExpiresIn)
+	}
+
+	refreshed, err := service.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("не удалось обновить токен: %v", err)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("при обновлении должен выдаваться новый refresh-токен")
+	}
+	if _, err := service.Refresh(tokens.RefreshToken); err != auth.ErrInvalidRefreshToken {
+		t.Errorf("использованный refresh-токен должен отклоняться, получено %v", err)
+	}
+
+	claims, err := service.ValidateToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("новый токен доступа должен приниматься: %v", err)
+	}
+	if _, err := service.ValidateToken(tokens.AccessToken); err != nil {
+		t.Errorf("токен доступа той же сессии должен приниматься до истечения: %v", err)
+	}
+
+	sessions, err := service.Sessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		t.Fatalf("не удалось получить сессии: %v", err)
+	}
+	if len(sessions) != 1 || !sessions[0].Current || sessions[0].UserAgent != "test" {
+		t.Errorf("ожидалась одна текущая сессия, получено %+v", sessions)
+	}
+}
+
+func TestRevokedSessionRejectsTokens(t *testing.T) {
+	service := newAuthService(t)
+
+	first, err := service.Login("user", "password", "first")
+	if err != nil {
+		t.Fatalf("не удалось войти: %v", err)
+	}
+	second, err := service.Login("user", "password", "second")
+	if err != nil {
+		t.Fatalf("не удалось войти: %v", err)
+	}
+
+	claims, err := service.ValidateToken(first.AccessToken)
+	if err != nil {
+		t.Fatalf("токен должен приниматься: %v", err)
+	}
+
+	if err := service.RevokeSession(claims.UserID+1, claims.SessionID); err != auth.ErrSessionNotFound {
+		t.Errorf("чужую сессию нельзя отозвать, получено %v", err)
+	}
+	if err := service.RevokeSession(claims.UserID, claims.SessionID); err != nil {
+		t.Fatalf("не удалось отозвать сессию: %v", err)
+	}
+
+	if _, err := service.ValidateToken(first.AccessToken); err == nil {
+		t.Error("токен отозванной сессии должен отклоняться")
+	}
+	if _, err := service.Refresh(first.RefreshToken); err != auth.ErrInvalidRefreshToken {
+		t.Errorf("refresh-токен отозванной сессии должен отклоняться, получено %v", err)
+	}
+	if _, err := service.ValidateToken(second.AccessToken); err != nil {
+		t.Errorf("другая сессия не должна затрагиваться: %v", err)
+	}
+
+	sessions, err := service.Sessions(claims.UserID, "")
+	if err != nil {
+		t.Fatalf("не удалось получить сессии: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].UserAgent != "second" {
+		t.Errorf("должна остаться только вторая сессия, получено %+v", sessions)
+	}
+}
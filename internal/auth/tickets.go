@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StreamTicketTTL is how long a stream ticket can be redeemed.
+const StreamTicketTTL = 30 * time.Second
+
+var ErrInvalidTicket = errors.New("invalid or expired stream ticket")
+
+// streamTicket stands in for the access token on the expression stream.
+// Browsers cannot set the Authorization header on EventSource and WebSocket
+// connections, so they exchange their token for a ticket and pass it in the
+// query string. A ticket works once and only shortly, so a copy left in a
+// log or in the browser history is of no use.
+type streamTicket struct {
+	userID    int
+	sessionID string
+	expiresAt time.Time
+}
+
+// IssueStreamTicket returns a ticket that opens one stream for the session.
+func (s *Service) IssueStreamTicket(userID int, sessionID string) (string, error) {
+	ticket, err := randomToken(32)
+	if err != nil {
+		return "", ErrInternalServer
+	}
+
+	now := time.Now()
+
+	s.ticketsMu.Lock()
+	defer s.ticketsMu.Unlock()
+
+	for hash, issued := range s.tickets {
+		if !now.Before(issued.expiresAt) {
+			delete(s.tickets, hash)
+		}
+	}
+	s.tickets[hashToken(ticket)] = streamTicket{
+		userID:    userID,
+		sessionID: sessionID,
+		expiresAt: now.Add(StreamTicketTTL),
+	}
+
+	return ticket, nil
+}
+
+// RedeemStreamTicket consumes the ticket and returns the user and session
+// it was issued for. The session must still be active.
+func (s *Service) RedeemStreamTicket(ticket string) (int, string, error) {
+	hash := hashToken(ticket)
+
+	s.ticketsMu.Lock()
+	issued, ok := s.tickets[hash]
+	delete(s.tickets, hash)
+	s.ticketsMu.Unlock()
+
+	if !ok || !time.Now().Before(issued.expiresAt) {
+		return 0, "", ErrInvalidTicket
+	}
+	if err := s.checkSession(issued.sessionID); err != nil {
+		return 0, "", ErrInvalidTicket
+	}
+
+	return issued.userID, issued.sessionID, nil
+}
+
+// StreamTicketHandler issues a stream ticket for the session of the access
+// token.
+func StreamTicketHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+		sessionID := c.Locals("sessionID").(string)
+
+		ticket, err := service.IssueStreamTicket(userID, sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"ticket":     ticket,
+			"expires_in": int64(StreamTicketTTL.Seconds()),
+		})
+	}
+}
+
+// StreamAuthMiddleware authenticates the expression stream either like
+// AuthMiddleware or with a stream ticket in the ticket query parameter.
+func StreamAuthMiddleware(authService *Service) fiber.Handler {
+	withToken := AuthMiddleware(authService)
+
+	return func(c *fiber.Ctx) error {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			return withToken(c)
+		}
+
+		userID, sessionID, err := authService.RedeemStreamTicket(ticket)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid stream ticket",
+			})
+		}
+
+		c.Locals("userID", userID)
+		c.Locals("sessionID", sessionID)
+
+		return c.Next()
+	}
+}
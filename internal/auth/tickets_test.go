@@ -0,0 +1,63 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/auth"
+)
+
+func TestStreamTicketWorksOnce(t *testing.T) {
+	service := newAuthService(t)
+
+	tokens, err := service.Login("user", "password", "test")
+	if err != nil {
+		t.Fatalf("не удалось войти: %v", err)
+	}
+	claims, err := service.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("токен должен приниматься: %v", err)
+	}
+
+	ticket, err := service.IssueStreamTicket(claims.UserID, claims.SessionID)
+	if err != nil {
+		t.Fatalf("не удалось выдать билет: %v", err)
+	}
+	if _, err := service.ValidateToken(ticket); err == nil {
+		t.Error("билет не должен приниматься как токен доступа")
+	}
+
+	userID, sessionID, err := service.RedeemStreamTicket(ticket)
+	if err != nil {
+		t.Fatalf("билет должен приниматься: %v", err)
+	}
+	if userID != claims.UserID || sessionID != claims.SessionID {
+		t.Errorf("ожидались пользователь %d и сессия %s, получено %d и %s", claims.UserID, claims.SessionID, userID, sessionID)
+	}
+	if _, _, err := service.RedeemStreamTicket(ticket); err != auth.ErrInvalidTicket {
+		t.Errorf("использованный билет должен отклоняться, получено %v", err)
+	}
+}
+
+func TestStreamTicketOfRevokedSession(t *testing.T) {
+	service := newAuthService(t)
+
+	tokens, err := service.Login("user", "password", "test")
+	if err != nil {
+		t.Fatalf("не удалось войти: %v", err)
+	}
+	claims, err := service.ValidateToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("токен должен приниматься: %v", err)
+	}
+
+	ticket, err := service.IssueStreamTicket(claims.UserID, claims.SessionID)
+	if err != nil {
+		t.Fatalf("не удалось выдать билет: %v", err)
+	}
+	if err := service.RevokeSession(claims.UserID, claims.SessionID); err != nil {
+		t.Fatalf("не удалось отозвать сессию: %v", err)
+	}
+	if _, _, err := service.RedeemStreamTicket(ticket); err != auth.ErrInvalidTicket {
+		t.Errorf("билет отозванной сессии должен отклоняться, получено %v", err)
+	}
+}
@@ -5,16 +5,45 @@ import (
 )
 
 type Config struct {
-	Port               int    `env:"PORT" envDefault:"8080"`
-	GRPCPort           int    `env:"GRPC_PORT" envDefault:"8090"`
-	AdditionMs         int    `env:"ADDITION_MS" envDefault:"1000"`
-	SubtractionMs      int    `env:"SUBTRACTION_MS" envDefault:"1000"`
-	MultiplicationMs   int    `env:"MULTIPLICATION_MS" envDefault:"1500"`
-	DivisionMs         int    `env:"DIVISION_MS" envDefault:"2000"`
-	ComputingPower     int    `env:"COMPUTING_POWER" envDefault:"3"`
-	AgentPeriodicityMs int    `env:"AGENT_PERIODICITY_MS" envDefault:"500"`
-	DBPath             string `env:"DB_PATH" envDefault:"./data/calculator.db"`
-	GRPCHost           string `env:"GRPC_HOST" envDefault:"localhost"`
+	Port                int    `env:"PORT" envDefault:"8080"`
+	GRPCPort            int    `env:"GRPC_PORT" envDefault:"8090"`
+	AdditionMs          int    `env:"ADDITION_MS" envDefault:"1000"`
+	SubtractionMs       int    `env:"SUBTRACTION_MS" envDefault:"1000"`
+	MultiplicationMs    int    `env:"MULTIPLICATION_MS" envDefault:"1500"`
+	DivisionMs          int    `env:"DIVISION_MS" envDefault:"2000"`
+	PowerMs             int    `env:"POWER_MS" envDefault:"2000"`
+	SqrtMs              int    `env:"SQRT_MS" envDefault:"1500"`
+	AbsMs               int    `env:"ABS_MS" envDefault:"500"`
+	SinMs               int    `env:"SIN_MS" envDefault:"1500"`
+	CosMs               int    `env:"COS_MS" envDefault:"1500"`
+	LogMs               int    `env:"LOG_MS" envDefault:"1500"`
+	MinMs               int    `env:"MIN_MS" envDefault:"500"`
+	MaxMs               int    `env:"MAX_MS" envDefault:"500"`
+	RoundMs             int    `env:"ROUND_MS" envDefault:"500"`
+	ComputingPower      int    `env:"COMPUTING_POWER" envDefault:"3"`
+	AgentPeriodicityMs  int    `env:"AGENT_PERIODICITY_MS" envDefault:"500"`
+	AgentStreaming      bool   `env:"AGENT_STREAMING" envDefault:"true"`
+	LeaseGraceMs        int    `env:"LEASE_GRACE_MS" envDefault:"5000"`
+	LeaseReaperMs       int    `env:"LEASE_REAPER_MS" envDefault:"1000"`
+	AgentTimeoutMs      int    `env:"AGENT_TIMEOUT_MS" envDefault:"15000"`
+	AgentID             string `env:"AGENT_ID"`
+	AgentMetricsPort    int    `env:"AGENT_METRICS_PORT" envDefault:"9091"`
+	AgentToken          string `env:"AGENT_TOKEN"`
+	GRPCTLSCert         string `env:"GRPC_TLS_CERT"`
+	GRPCTLSKey          string `env:"GRPC_TLS_KEY"`
+	GRPCTLSCA           string `env:"GRPC_TLS_CA"`
+	GRPCTLSServerName   string `env:"GRPC_TLS_SERVER_NAME"`
+	DBPath              string `env:"DB_PATH" envDefault:"./data/calculator.db"`
+	JWTKeysFile         string `env:"JWT_KEYS_FILE"`
+	JWTSecret           string `env:"JWT_SECRET"`
+	AccessTTLMinutes    int    `env:"ACCESS_TOKEN_TTL_MINUTES" envDefault:"15"`
+	RefreshTTLHours     int    `env:"REFRESH_TOKEN_TTL_HOURS" envDefault:"720"`
+	GRPCHost            string `env:"GRPC_HOST" envDefault:"localhost"`
+	AdminLogins         string `env:"ADMIN_LOGINS"`
+	TracingExporter     string `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingOTLPEndpoint string `env:"TRACING_OTLP_ENDPOINT" envDefault:"localhost:4317"`
+	TracingOTLPInsecure bool   `env:"TRACING_OTLP_INSECURE" envDefault:"false"`
+	TracingFile         string `env:"TRACING_FILE" envDefault:"./data/traces.jsonl"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -2,11 +2,18 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/big"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/neptship/calc-yandex-go/internal/models"
 	_ "modernc.org/sqlite"
 )
@@ -15,20 +22,14 @@ type Database struct {
 	db *sql.DB
 }
 
+// NewDatabase opens the database and brings its schema up to date.
 func NewDatabase(dbPath string) (*Database, error) {
-	dir := dbPath[:len(dbPath)-len("/calculator.db")]
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, err
-		}
-	}
-
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := Open(dbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.Exec(Schema); err != nil {
+	if _, err := MigrateUp(db); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -37,24 +38,40 @@ func NewDatabase(dbPath string) (*Database, error) {
 	return &Database{db: db}, nil
 }
 
-func (d *Database) Close() error {
-	return d.db.Close()
+// Open opens the database without migrating it.
+func Open(dbPath string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+
+	return sql.Open("sqlite3", dbPath)
 }
 
-func (d *Database) GetDB() *sql.DB {
-	return d.db
+func (d *Database) Close() error {
+	return d.db.Close()
 }
 
 func (d *Database) GetUserByLogin(login string) (int, string, error) {
 	var id int
 	var passwordHash string
 	err := d.db.QueryRow("SELECT id, password_hash FROM users WHERE login = ?", login).Scan(&id, &passwordHash)
-	return id, passwordHash, err
+	return id, passwordHash, notFound(err)
+}
+
+func (d *Database) GetUserLogin(id int) (string, error) {
+	var login string
+	err := d.db.QueryRow("SELECT login FROM users WHERE id = ?", id).Scan(&login)
+	return login, notFound(err)
 }
 
 func (d *Database) CreateUser(login, passwordHash string) error {
 	_, err := d.db.Exec("INSERT INTO users (login, password_hash) VALUES (?, ?)",
 		login, passwordHash)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return ErrDuplicate
+	}
 	return err
 }
 
@@ -64,10 +81,73 @@ func (d *Database) CheckUserExists(login string) (bool, error) {
 	return exists, err
 }
 
-func (d *Database) SaveExpression(userID int, expression string, status models.ExpressionStatus) (int, error) {
-	result, err := d.db.Exec(
-		"INSERT INTO expressions (user_id, expression, status) VALUES (?, ?, ?)",
-		userID, expression, status)
+// execer is what writes need, so they run the same way on the database
+// and inside a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// SaveExpression stores expr.Expression as submitted together with the
+// variable bindings it was calculated with.
+func (d *Database) SaveExpression(userID int, expr *models.Expression) (int, error) {
+	return insertExpression(d.db, userID, expr)
+}
+
+func (d *Database) CreateExpression(userID int, expr *models.Expression, plan func(expressionID int) (*ExpressionPlan, error)) (int, error) {
+	var expressionID int
+	err := inTransaction(d.db, func(tx *sql.Tx) error {
+		var err error
+		expressionID, err = insertExpression(tx, userID, expr)
+		if err != nil || plan == nil {
+			return err
+		}
+
+		p, err := plan(expressionID)
+		if err != nil {
+			return err
+		}
+
+		for _, task := range p.Tasks {
+			if _, err := insertTask(tx, task); err != nil {
+				return fmt.Errorf("task %d: %w", task.ID, err)
+			}
+		}
+
+		if len(p.Tasks) > 0 {
+			rootTaskID := p.Tasks[len(p.Tasks)-1].ID
+			if err := insertResult(tx, p.RootResultID, expressionID, &rootTaskID, 0, false); err != nil {
+				return fmt.Errorf("root result: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expressionID, nil
+}
+
+func insertExpression(ex execer, userID int, expr *models.Expression) (int, error) {
+	variables, err := encodeVariables(expr.Variables)
+	if err != nil {
+		return 0, err
+	}
+
+	var exactResult interface{}
+	if expr.ExactResult != nil {
+		exactResult = expr.ExactResult.String()
+	}
+
+	createdAt := expr.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	result, err := ex.Exec(
+		"INSERT INTO expressions (user_id, expression, status, result, mode, result_precision, exact_result, variables, created_at, started_at, completed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, expr.Expression, expr.Status, expr.Result, expr.Mode, expr.Precision, exactResult, variables,
+		formatTimestamp(createdAt), nullTime(expr.StartedAt), nullTime(expr.CompletedAt))
 	if err != nil {
 		return 0, err
 	}
@@ -85,6 +165,12 @@ func (d *Database) UpdateExpressionStatus(id int, status models.ExpressionStatus
 	return err
 }
 
+func (d *Database) StartExpression(id int) error {
+	_, err := d.db.Exec("UPDATE expressions SET status = ? WHERE id = ? AND status = ?",
+		models.StatusProcessing, id, models.StatusPending)
+	return err
+}
+
 func (d *Database) SetExpressionResult(id int, result float64) error {
 	_, err := d.db.Exec(
 		"UPDATE expressions SET status = ?, result = ? WHERE id = ?",
@@ -92,33 +178,207 @@ func (d *Database) SetExpressionResult(id int, result float64) error {
 	return err
 }
 
+// FailExpression marks the expression failed and stores why.
+func (d *Database) FailExpression(id int, reason string) error {
+	_, err := d.db.Exec(
+		"UPDATE expressions SET status = ?, error_message = ? WHERE id = ?",
+		models.StatusFailed, reason, id)
+	return err
+}
+
+// SetExpressionExactResult stores an exact-mode result as a fraction and
+// keeps its float approximation in the result column.
+func (d *Database) SetExpressionExactResult(id int, result *big.Rat) error {
+	value, _ := result.Float64()
+	_, err := d.db.Exec(
+		"UPDATE expressions SET status = ?, result = ?, exact_result = ? WHERE id = ?",
+		models.StatusCompleted, value, result.String(), id)
+	return err
+}
+
+func (d *Database) SetExpressionStartedAt(id int, at time.Time) error {
+	_, err := d.db.Exec("UPDATE expressions SET started_at = COALESCE(started_at, ?) WHERE id = ?", formatTimestamp(at), id)
+	return err
+}
+
+func (d *Database) SetExpressionCompletedAt(id int, at time.Time) error {
+	_, err := d.db.Exec("UPDATE expressions SET completed_at = ? WHERE id = ?", formatTimestamp(at), id)
+	return err
+}
+
+const expressionColumns = "id, user_id, expression, status, result, mode, result_precision, exact_result, variables, error_message, created_at, started_at, completed_at"
+
 func (d *Database) GetExpression(id int) (*models.Expression, error) {
-	expr := &models.Expression{ID: id}
+	return scanExpression(d.db.QueryRow("SELECT "+expressionColumns+" FROM expressions WHERE id = ?", id))
+}
+
+func (d *Database) GetUserExpressions(userID int) ([]*models.Expression, error) {
+	rows, err := d.db.Query("SELECT "+expressionColumns+" FROM expressions WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanExpressions(rows)
+}
+
+func (d *Database) ListExpressions(query ExpressionQuery) ([]*models.Expression, int, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{query.UserID}
+
+	if len(query.Statuses) > 0 {
+		placeholders := make([]string, len(query.Statuses))
+		for i, status := range query.Statuses {
+			placeholders[i] = "?"
+			args = append(args, status)
+		}
+		where = append(where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !query.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, formatTimestamp(query.From))
+	}
+	if !query.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, formatTimestamp(query.To))
+	}
+	if query.Search != "" {
+		where = append(where, "instr(expression, ?) > 0")
+		args = append(args, query.Search)
+	}
+
+	var total int
+	filter := strings.Join(where, " AND ")
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM expressions WHERE "+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Keyset pagination: the page starts right after the cursor in the sort
+	// order, which is the sort field with the ID as a tie-breaker.
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	order := "id " + direction
+	if column := sortColumn(query.SortBy); column != "" {
+		order = column + " " + direction + ", " + order
+		if query.After != nil {
+			filter += " AND (" + column + ", id) " + comparison + " (?, ?)"
+			args = append(args, query.After.Value, query.After.ID)
+		}
+	} else if query.After != nil {
+		filter += " AND id " + comparison + " ?"
+		args = append(args, query.After.ID)
+	}
+
+	args = append(args, query.Limit)
+	rows, err := d.db.Query("SELECT "+expressionColumns+" FROM expressions WHERE "+filter+" ORDER BY "+order+" LIMIT ?", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	expressions, err := scanExpressions(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return expressions, total, nil
+}
+
+// timestampFormat is RFC 3339 in UTC with all nine fractional digits. Being
+// of fixed width, stored timestamps compare as strings in time order, so
+// filters on them use the columns and their indexes as they are.
+const timestampFormat = "2006-01-02T15:04:05.000000000Z"
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+// sortColumn returns the column to sort by before the ID, if any.
+func sortColumn(sortBy string) string {
+	switch sortBy {
+	case SortByExpression:
+		return "expression"
+	case SortByStatus:
+		return "status"
+	default:
+		return ""
+	}
+}
+
+func scanExpressions(rows *sql.Rows) ([]*models.Expression, error) {
+	defer rows.Close()
+
+	expressions := []*models.Expression{}
+	for rows.Next() {
+		expr, err := scanExpression(rows)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expr)
+	}
+
+	return expressions, rows.Err()
+}
+
+func scanExpression(row rowScanner) (*models.Expression, error) {
+	expr := &models.Expression{}
 	var resultValue sql.NullFloat64
+	var exactValue, variables, errorMessage sql.NullString
+	var createdAt, startedAt, completedAt sql.NullTime
 	var status string
 
-	err := d.db.QueryRow(
-		"SELECT expression, status, result FROM expressions WHERE id = ?",
-		id).Scan(&expr.Expression, &status, &resultValue)
-
+	err := row.Scan(&expr.ID, &expr.UserID, &expr.Expression, &status, &resultValue, &expr.Mode, &expr.Precision,
+		&exactValue, &variables, &errorMessage, &createdAt, &startedAt, &completedAt)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 
 	expr.Status = models.ExpressionStatus(status)
+	expr.Error = errorMessage.String
+	expr.CreatedAt = createdAt.Time
+	expr.StartedAt = timePointer(startedAt)
+	expr.CompletedAt = timePointer(completedAt)
 
 	if resultValue.Valid {
 		result := resultValue.Float64
 		expr.Result = &result
 	}
 
+	expr.ExactResult, err = parseExactResult(exactValue)
+	if err != nil {
+		return nil, err
+	}
+
+	expr.Variables, err = decodeVariables(variables)
+	if err != nil {
+		return nil, err
+	}
+
 	return expr, nil
 }
 
-func (d *Database) GetUserExpressions(userID int) ([]*models.Expression, error) {
+func (d *Database) CountExpressionsByStatus() (map[models.ExpressionStatus]int, error) {
+	rows, err := d.db.Query("SELECT status, COUNT(*) FROM expressions GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[models.ExpressionStatus]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[models.ExpressionStatus(status)] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (d *Database) GetUnfinishedExpressions() ([]*models.Expression, error) {
 	rows, err := d.db.Query(
-		"SELECT id, expression, status, result FROM expressions WHERE user_id = ? ORDER BY id DESC",
-		userID)
+		"SELECT id, user_id, expression, status, mode, result_precision FROM expressions WHERE status IN (?, ?) ORDER BY id",
+		models.StatusPending, models.StatusProcessing)
 	if err != nil {
 		return nil, err
 	}
@@ -128,32 +388,33 @@ func (d *Database) GetUserExpressions(userID int) ([]*models.Expression, error)
 	for rows.Next() {
 		expr := &models.Expression{}
 		var status string
-		var resultValue sql.NullFloat64
 
-		if err := rows.Scan(&expr.ID, &expr.Expression, &status, &resultValue); err != nil {
+		if err := rows.Scan(&expr.ID, &expr.UserID, &expr.Expression, &status, &expr.Mode, &expr.Precision); err != nil {
 			return nil, err
 		}
 
 		expr.Status = models.ExpressionStatus(status)
-
-		if resultValue.Valid {
-			result := resultValue.Float64
-			expr.Result = &result
-		}
-
 		expressions = append(expressions, expr)
 	}
 
-	return expressions, nil
+	return expressions, rows.Err()
 }
 
 func (d *Database) SaveTask(task *models.Task) (int, error) {
+	return insertTask(d.db, task)
+}
+
+func insertTask(ex execer, task *models.Task) (int, error) {
 	arg1Str := convertArgToString(task.Arg1)
 	arg2Str := convertArgToString(task.Arg2)
+	argsStr, err := convertArgsToString(task.Args)
+	if err != nil {
+		return 0, err
+	}
 
-	result, err := d.db.Exec(
-		"INSERT INTO tasks (expression_id, arg1, arg2, operation, operation_time, completed) VALUES (?, ?, ?, ?, ?, ?)",
-		task.ExpressionID, arg1Str, arg2Str, task.Operation, task.OperationTime, false)
+	result, err := ex.Exec(
+		"INSERT INTO tasks (id, expression_id, arg1, arg2, args, operation, operation_time, completed) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		task.ID, task.ExpressionID, arg1Str, arg2Str, argsStr, task.Operation, task.OperationTime, false)
 	if err != nil {
 		return 0, err
 	}
@@ -168,7 +429,7 @@ func (d *Database) SaveTask(task *models.Task) (int, error) {
 
 func (d *Database) GetUncompletedTasks(expressionID int) ([]*models.Task, error) {
 	rows, err := d.db.Query(
-		"SELECT id, expression_id, arg1, arg2, operation, operation_time FROM tasks WHERE expression_id = ? AND completed = 0",
+		"SELECT id, expression_id, arg1, arg2, args, operation, operation_time, dispatched_at, finished_at FROM tasks WHERE expression_id = ? AND completed = 0 ORDER BY id",
 		expressionID)
 	if err != nil {
 		return nil, err
@@ -179,13 +440,19 @@ func (d *Database) GetUncompletedTasks(expressionID int) ([]*models.Task, error)
 	for rows.Next() {
 		task := &models.Task{}
 		var arg1Str, arg2Str string
+		var argsStr sql.NullString
+		var dispatchedAt, finishedAt sql.NullTime
 
-		if err := rows.Scan(&task.ID, &task.ExpressionID, &arg1Str, &arg2Str, &task.Operation, &task.OperationTime); err != nil {
+		if err := rows.Scan(&task.ID, &task.ExpressionID, &arg1Str, &arg2Str, &argsStr, &task.Operation, &task.OperationTime,
+			&dispatchedAt, &finishedAt); err != nil {
 			return nil, err
 		}
+		task.DispatchedAt = timePointer(dispatchedAt)
+		task.FinishedAt = timePointer(finishedAt)
 
-		task.Arg1 = parseArgument(arg1Str)
-		task.Arg2 = parseArgument(arg2Str)
+		if err := setTaskArgs(task, arg1Str, arg2Str, argsStr); err != nil {
+			return nil, err
+		}
 
 		tasks = append(tasks, task)
 	}
@@ -193,6 +460,94 @@ func (d *Database) GetUncompletedTasks(expressionID int) ([]*models.Task, error)
 	return tasks, nil
 }
 
+func (d *Database) GetExpressionTasks(expressionID int) ([]*models.TaskRecord, error) {
+	rows, err := d.db.Query(
+		"SELECT id, expression_id, arg1, arg2, args, operation, operation_time, completed, result, exact_result, agent_id, dispatched_at, finished_at FROM tasks WHERE expression_id = ? ORDER BY id",
+		expressionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*models.TaskRecord{}
+	for rows.Next() {
+		record := &models.TaskRecord{}
+		var arg1Str, arg2Str string
+		var argsStr, exactValue, agentID sql.NullString
+		var result sql.NullFloat64
+		var dispatchedAt, finishedAt sql.NullTime
+
+		err := rows.Scan(&record.ID, &record.ExpressionID, &arg1Str, &arg2Str, &argsStr, &record.Operation, &record.OperationTime,
+			&record.Completed, &result, &exactValue, &agentID, &dispatchedAt, &finishedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := setTaskArgs(&record.Task, arg1Str, arg2Str, argsStr); err != nil {
+			return nil, err
+		}
+		record.Result = result.Float64
+		record.ExactResult, err = parseExactResult(exactValue)
+		if err != nil {
+			return nil, err
+		}
+		record.AgentID = agentID.String
+		record.DispatchedAt = timePointer(dispatchedAt)
+		record.FinishedAt = timePointer(finishedAt)
+
+		tasks = append(tasks, record)
+	}
+
+	return tasks, rows.Err()
+}
+
+// setTaskArgs decodes the stored arguments; tasks saved before the args
+// column existed only have arg1 and arg2.
+func setTaskArgs(task *models.Task, arg1Str, arg2Str string, argsStr sql.NullString) error {
+	task.Arg1 = parseArgument(arg1Str)
+	task.Arg2 = parseArgument(arg2Str)
+	if !argsStr.Valid || argsStr.String == "" {
+		task.Args = []interface{}{task.Arg1, task.Arg2}
+		return nil
+	}
+
+	var err error
+	task.Args, err = parseArguments(argsStr.String)
+	return err
+}
+
+func (d *Database) GetTaskResults(expressionID int) ([]*models.TaskResult, error) {
+	rows, err := d.db.Query(
+		"SELECT id, result, exact_result FROM tasks WHERE expression_id = ? AND completed = 1 ORDER BY id",
+		expressionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.TaskResult{}
+	for rows.Next() {
+		result := &models.TaskResult{}
+		var exactValue sql.NullString
+		if err := rows.Scan(&result.ID, &result.Result, &exactValue); err != nil {
+			return nil, err
+		}
+		result.ExactResult, err = parseExactResult(exactValue)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+func (d *Database) GetMaxTaskID() (int, error) {
+	var id int
+	err := d.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM tasks").Scan(&id)
+	return id, err
+}
+
 func (d *Database) SetTaskResult(taskID int, result float64) error {
 	_, err := d.db.Exec(
 		"UPDATE tasks SET completed = 1, result = ? WHERE id = ?",
@@ -200,7 +555,34 @@ func (d *Database) SetTaskResult(taskID int, result float64) error {
 	return err
 }
 
+func (d *Database) SetTaskExactResult(taskID int, result *big.Rat) error {
+	value, _ := result.Float64()
+	_, err := d.db.Exec(
+		"UPDATE tasks SET completed = 1, result = ?, exact_result = ? WHERE id = ?",
+		value, result.String(), taskID)
+	return err
+}
+
+func (d *Database) SetTaskDispatched(taskID int, agentID string, at time.Time) error {
+	_, err := d.db.Exec("UPDATE tasks SET agent_id = ?, dispatched_at = ? WHERE id = ?", agentID, formatTimestamp(at), taskID)
+	return err
+}
+
+func (d *Database) ClearTaskDispatched(taskID int) error {
+	_, err := d.db.Exec("UPDATE tasks SET agent_id = NULL, dispatched_at = NULL WHERE id = ?", taskID)
+	return err
+}
+
+func (d *Database) SetTaskFinishedAt(taskID int, at time.Time) error {
+	_, err := d.db.Exec("UPDATE tasks SET finished_at = ? WHERE id = ?", formatTimestamp(at), taskID)
+	return err
+}
+
 func (d *Database) SaveResult(resultID string, expressionID int, taskID *int, value float64, completed bool) error {
+	return insertResult(d.db, resultID, expressionID, taskID, value, completed)
+}
+
+func insertResult(ex execer, resultID string, expressionID int, taskID *int, value float64, completed bool) error {
 	var taskIDValue interface{}
 	if taskID != nil {
 		taskIDValue = *taskID
@@ -208,7 +590,7 @@ func (d *Database) SaveResult(resultID string, expressionID int, taskID *int, va
 		taskIDValue = nil
 	}
 
-	_, err := d.db.Exec(
+	_, err := ex.Exec(
 		"INSERT INTO results (id, expression_id, task_id, value, completed) VALUES (?, ?, ?, ?, ?)",
 		resultID, expressionID, taskIDValue, value, completed)
 	return err
@@ -222,7 +604,7 @@ func (d *Database) GetResult(resultID string) (float64, bool, error) {
 		"SELECT value, completed FROM results WHERE id = ?",
 		resultID).Scan(&value, &completed)
 
-	return value, completed, err
+	return value, completed, notFound(err)
 }
 
 func (d *Database) UpdateResult(resultID string, value float64, completed bool) error {
@@ -232,17 +614,67 @@ func (d *Database) UpdateResult(resultID string, value float64, completed bool)
 	return err
 }
 
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTimestamp(*t)
+}
+
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// notFound turns sql.ErrNoRows into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
 func convertArgToString(arg interface{}) string {
 	switch v := arg.(type) {
 	case float64:
 		return "n:" + strconv.FormatFloat(v, 'f', -1, 64)
 	case string:
 		return "s:" + v
+	case *big.Rat:
+		return "r:" + v.String()
 	default:
 		return ""
 	}
 }
 
+func convertArgsToString(args []interface{}) (string, error) {
+	encoded := make([]string, len(args))
+	for i, arg := range args {
+		encoded[i] = convertArgToString(arg)
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func parseArguments(argsStr string) ([]interface{}, error) {
+	var encoded []string
+	if err := json.Unmarshal([]byte(argsStr), &encoded); err != nil {
+		return nil, err
+	}
+
+	args := make([]interface{}, len(encoded))
+	for i, arg := range encoded {
+		args[i] = parseArgument(arg)
+	}
+	return args, nil
+}
+
 func parseArgument(argStr string) interface{} {
 	if len(argStr) < 2 {
 		return nil
@@ -259,7 +691,49 @@ func parseArgument(argStr string) interface{} {
 		return val
 	} else if prefix == "s:" {
 		return value
+	} else if prefix == "r:" {
+		val, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return value
+		}
+		return val
 	}
 
 	return argStr
 }
+
+func encodeVariables(variables map[string]string) (interface{}, error) {
+	if len(variables) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func decodeVariables(value sql.NullString) (map[string]string, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+
+	var variables map[string]string
+	if err := json.Unmarshal([]byte(value.String), &variables); err != nil {
+		return nil, fmt.Errorf("invalid variables %q: %w", value.String, err)
+	}
+	return variables, nil
+}
+
+func parseExactResult(value sql.NullString) (*big.Rat, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+
+	result, ok := new(big.Rat).SetString(value.String)
+	if !ok {
+		return nil, fmt.Errorf("invalid exact result %q", value.String)
+	}
+	return result, nil
+}
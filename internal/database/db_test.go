@@ -0,0 +1,20 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/database/storetest"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		db, err := database.NewDatabase(filepath.Join(t.TempDir(), "calculator.db"))
+		if err != nil {
+			t.Fatalf("не удалось открыть базу данных: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
@@ -0,0 +1,684 @@
+// Package memory is a storage backend that keeps everything in process
+// memory. It behaves like the SQLite store and is meant for tests and
+// short-lived instances.
+package memory
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// Store implements database.Store. Values are copied on the way in and out,
+// so callers never share state with the store.
+type Store struct {
+	mu sync.Mutex
+
+	users          map[int]*user
+	nextUserID     int
+	sessions       map[string]*models.Session
+	expressions    map[int]*models.Expression
+	nextExprID     int
+	tasks          map[int]*task
+	results        map[string]*result
+	lastAssignedID int
+}
+
+type user struct {
+	login        string
+	passwordHash string
+}
+
+type task struct {
+	task      *models.Task
+	completed bool
+	result    float64
+	exact     *big.Rat
+}
+
+type result struct {
+	value     float64
+	completed bool
+}
+
+var _ database.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		users:       make(map[int]*user),
+		nextUserID:  1,
+		sessions:    make(map[string]*models.Session),
+		expressions: make(map[int]*models.Expression),
+		nextExprID:  1,
+		tasks:       make(map[int]*task),
+		results:     make(map[string]*result),
+	}
+}
+
+func (s *Store) CreateUser(login, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.findUser(login); exists {
+		return database.ErrDuplicate
+	}
+
+	s.users[s.nextUserID] = &user{login: login, passwordHash: passwordHash}
+	s.nextUserID++
+	return nil
+}
+
+func (s *Store) CheckUserExists(login string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.findUser(login)
+	return exists, nil
+}
+
+func (s *Store) GetUserByLogin(login string) (int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, exists := s.findUser(login)
+	if !exists {
+		return 0, "", database.ErrNotFound
+	}
+	return id, s.users[id].passwordHash, nil
+}
+
+func (s *Store) GetUserLogin(id int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[id]
+	if !exists {
+		return "", database.ErrNotFound
+	}
+	return u.login, nil
+}
+
+func (s *Store) findUser(login string) (int, bool) {
+	for id, u := range s.users {
+		if u.login == login {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Store) CreateSession(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return database.ErrDuplicate
+	}
+	for _, other := range s.sessions {
+		if other.TokenHash == session.TokenHash {
+			return database.ErrDuplicate
+		}
+	}
+
+	s.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (s *Store) GetSession(id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return nil, database.ErrNotFound
+	}
+	return copySession(session), nil
+}
+
+func (s *Store) GetSessionByTokenHash(tokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.TokenHash == tokenHash {
+			return copySession(session), nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (s *Store) GetUserSessions(userID int) ([]*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []*models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (s *Store) RotateSession(id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.TokenHash != oldHash || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	session.TokenHash = newHash
+	session.LastUsedAt = usedAt
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+func (s *Store) RevokeSession(userID int, id string, revokedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.UserID != userID || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	session.RevokedAt = &revokedAt
+	return true, nil
+}
+
+func (s *Store) SaveExpression(userID int, expr *models.Expression) (int, error) {
+	return s.CreateExpression(userID, expr, nil)
+}
+
+func (s *Store) CreateExpression(userID int, expr *models.Expression, plan func(expressionID int) (*database.ExpressionPlan, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := copyExpression(expr)
+	stored.ID = s.nextExprID
+	stored.UserID = userID
+	stored.Error = ""
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = time.Now().UTC()
+	}
+
+	var p *database.ExpressionPlan
+	if plan != nil {
+		var err error
+		if p, err = plan(stored.ID); err != nil {
+			return 0, err
+		}
+	} else {
+		p = &database.ExpressionPlan{}
+	}
+
+	// Everything is checked before anything is written, which is what
+	// makes the creation atomic.
+	planned := make(map[int]bool, len(p.Tasks))
+	for _, t := range p.Tasks {
+		if _, exists := s.tasks[t.ID]; exists || planned[t.ID] {
+			return 0, fmt.Errorf("task %d: %w", t.ID, database.ErrDuplicate)
+		}
+		planned[t.ID] = true
+	}
+	if len(p.Tasks) > 0 {
+		if _, exists := s.results[p.RootResultID]; exists {
+			return 0, fmt.Errorf("result %s: %w", p.RootResultID, database.ErrDuplicate)
+		}
+	}
+
+	s.expressions[stored.ID] = stored
+	s.nextExprID++
+	for _, t := range p.Tasks {
+		s.insertTask(t.ID, t)
+	}
+	if len(p.Tasks) > 0 {
+		s.results[p.RootResultID] = &result{}
+	}
+	return stored.ID, nil
+}
+
+func (s *Store) GetExpression(id int) (*models.Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expr, exists := s.expressions[id]
+	if !exists {
+		return nil, database.ErrNotFound
+	}
+	return copyExpression(expr), nil
+}
+
+func (s *Store) GetUserExpressions(userID int) ([]*models.Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expressions := []*models.Expression{}
+	for _, expr := range s.expressions {
+		if expr.UserID == userID {
+			expressions = append(expressions, copyExpression(expr))
+		}
+	}
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].ID > expressions[j].ID })
+	return expressions, nil
+}
+
+func (s *Store) ListExpressions(query database.ExpressionQuery) ([]*models.Expression, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []*models.Expression
+	for _, expr := range s.expressions {
+		if matchesQuery(expr, query) {
+			matching = append(matching, expr)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return compareCursors(query.CursorFor(matching[i]), query.CursorFor(matching[j]), query.Descending) < 0
+	})
+
+	page := []*models.Expression{}
+	for _, expr := range matching {
+		if len(page) == query.Limit {
+			break
+		}
+		if query.After != nil && compareCursors(query.CursorFor(expr), query.After, query.Descending) <= 0 {
+			continue
+		}
+		page = append(page, copyExpression(expr))
+	}
+	return page, len(matching), nil
+}
+
+func matchesQuery(expr *models.Expression, query database.ExpressionQuery) bool {
+	if expr.UserID != query.UserID {
+		return false
+	}
+	if len(query.Statuses) > 0 {
+		found := false
+		for _, status := range query.Statuses {
+			found = found || expr.Status == status
+		}
+		if !found {
+			return false
+		}
+	}
+	if !query.From.IsZero() && expr.CreatedAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !expr.CreatedAt.Before(query.To) {
+		return false
+	}
+	return strings.Contains(expr.Expression, query.Search)
+}
+
+// compareCursors orders two positions the way the SQLite store does: by the
+// sort value, then by ID.
+func compareCursors(a, b *database.ExpressionCursor, descending bool) int {
+	result := strings.Compare(a.Value, b.Value)
+	if result == 0 {
+		switch {
+		case a.ID < b.ID:
+			result = -1
+		case a.ID > b.ID:
+			result = 1
+		}
+	}
+	if descending {
+		return -result
+	}
+	return result
+}
+
+func (s *Store) CountExpressionsByStatus() (map[models.ExpressionStatus]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[models.ExpressionStatus]int)
+	for _, expr := range s.expressions {
+		counts[expr.Status]++
+	}
+	return counts, nil
+}
+
+func (s *Store) GetUnfinishedExpressions() ([]*models.Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expressions := []*models.Expression{}
+	for _, expr := range s.expressions {
+		if expr.Status == models.StatusPending || expr.Status == models.StatusProcessing {
+			expressions = append(expressions, copyExpression(expr))
+		}
+	}
+	sort.Slice(expressions, func(i, j int) bool { return expressions[i].ID < expressions[j].ID })
+	return expressions, nil
+}
+
+func (s *Store) UpdateExpressionStatus(id int, status models.ExpressionStatus) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		expr.Status = status
+	})
+	return nil
+}
+
+func (s *Store) StartExpression(id int) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		if expr.Status == models.StatusPending {
+			expr.Status = models.StatusProcessing
+		}
+	})
+	return nil
+}
+
+func (s *Store) SetExpressionResult(id int, value float64) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		expr.Status = models.StatusCompleted
+		expr.Result = &value
+	})
+	return nil
+}
+
+func (s *Store) SetExpressionExactResult(id int, exact *big.Rat) error {
+	value, _ := exact.Float64()
+	s.updateExpression(id, func(expr *models.Expression) {
+		expr.Status = models.StatusCompleted
+		expr.Result = &value
+		expr.ExactResult = new(big.Rat).Set(exact)
+	})
+	return nil
+}
+
+func (s *Store) FailExpression(id int, reason string) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		expr.Status = models.StatusFailed
+		expr.Error = reason
+	})
+	return nil
+}
+
+func (s *Store) SetExpressionStartedAt(id int, at time.Time) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		if expr.StartedAt == nil {
+			expr.StartedAt = copyTime(&at)
+		}
+	})
+	return nil
+}
+
+func (s *Store) SetExpressionCompletedAt(id int, at time.Time) error {
+	s.updateExpression(id, func(expr *models.Expression) {
+		expr.CompletedAt = copyTime(&at)
+	})
+	return nil
+}
+
+func (s *Store) updateExpression(id int, update func(*models.Expression)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expr, exists := s.expressions[id]; exists {
+		update(expr)
+	}
+}
+
+func (s *Store) SaveTask(t *models.Task) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := t.ID
+	if id == 0 {
+		id = s.lastAssignedID + 1
+	}
+	if _, exists := s.tasks[id]; exists {
+		return 0, fmt.Errorf("task %d: %w", id, database.ErrDuplicate)
+	}
+
+	s.insertTask(id, t)
+	return id, nil
+}
+
+// insertTask must be called with s.mu held.
+func (s *Store) insertTask(id int, t *models.Task) {
+	if id > s.lastAssignedID {
+		s.lastAssignedID = id
+	}
+
+	s.tasks[id] = &task{task: &models.Task{
+		ID:            id,
+		ExpressionID:  t.ExpressionID,
+		Arg1:          copyArg(t.Arg1),
+		Arg2:          copyArg(t.Arg2),
+		Args:          copyArgs(t.Args),
+		Operation:     t.Operation,
+		OperationTime: t.OperationTime,
+	}}
+}
+
+func (s *Store) GetUncompletedTasks(expressionID int) ([]*models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := []*models.Task{}
+	for _, t := range s.sortedTasks(expressionID) {
+		if t.completed {
+			continue
+		}
+		tasks = append(tasks, copyTask(t.task))
+	}
+	return tasks, nil
+}
+
+func (s *Store) GetExpressionTasks(expressionID int) ([]*models.TaskRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := []*models.TaskRecord{}
+	for _, t := range s.sortedTasks(expressionID) {
+		record := &models.TaskRecord{Task: *copyTask(t.task), Completed: t.completed, Result: t.result}
+		if t.exact != nil {
+			record.ExactResult = new(big.Rat).Set(t.exact)
+		}
+		tasks = append(tasks, record)
+	}
+	return tasks, nil
+}
+
+func (s *Store) GetTaskResults(expressionID int) ([]*models.TaskResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []*models.TaskResult{}
+	for _, t := range s.sortedTasks(expressionID) {
+		if !t.completed {
+			continue
+		}
+		taskResult := &models.TaskResult{ID: t.task.ID, Result: t.result}
+		if t.exact != nil {
+			taskResult.ExactResult = new(big.Rat).Set(t.exact)
+		}
+		results = append(results, taskResult)
+	}
+	return results, nil
+}
+
+func (s *Store) GetMaxTaskID() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxID := 0
+	for id := range s.tasks {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	return maxID, nil
+}
+
+func (s *Store) SetTaskResult(taskID int, value float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, exists := s.tasks[taskID]; exists {
+		t.completed = true
+		t.result = value
+	}
+	return nil
+}
+
+func (s *Store) SetTaskExactResult(taskID int, exact *big.Rat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, exists := s.tasks[taskID]; exists {
+		t.completed = true
+		t.result, _ = exact.Float64()
+		t.exact = new(big.Rat).Set(exact)
+	}
+	return nil
+}
+
+func (s *Store) SetTaskDispatched(taskID int, agentID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, exists := s.tasks[taskID]; exists {
+		t.task.AgentID = agentID
+		t.task.DispatchedAt = copyTime(&at)
+	}
+	return nil
+}
+
+func (s *Store) ClearTaskDispatched(taskID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, exists := s.tasks[taskID]; exists {
+		t.task.AgentID = ""
+		t.task.DispatchedAt = nil
+	}
+	return nil
+}
+
+func (s *Store) SetTaskFinishedAt(taskID int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, exists := s.tasks[taskID]; exists {
+		t.task.FinishedAt = copyTime(&at)
+	}
+	return nil
+}
+
+func (s *Store) SaveResult(resultID string, expressionID int, taskID *int, value float64, completed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.results[resultID]; exists {
+		return fmt.Errorf("result %s: %w", resultID, database.ErrDuplicate)
+	}
+	s.results[resultID] = &result{value: value, completed: completed}
+	return nil
+}
+
+func (s *Store) GetResult(resultID string) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, exists := s.results[resultID]
+	if !exists {
+		return 0, false, database.ErrNotFound
+	}
+	return r.value, r.completed, nil
+}
+
+// sortedTasks must be called with s.mu held.
+func (s *Store) sortedTasks(expressionID int) []*task {
+	var tasks []*task
+	for _, t := range s.tasks {
+		if t.task.ExpressionID == expressionID {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].task.ID < tasks[j].task.ID })
+	return tasks
+}
+
+func copySession(session *models.Session) *models.Session {
+	copied := *session
+	if session.RevokedAt != nil {
+		revokedAt := *session.RevokedAt
+		copied.RevokedAt = &revokedAt
+	}
+	return &copied
+}
+
+func copyExpression(expr *models.Expression) *models.Expression {
+	copied := *expr
+	if expr.Result != nil {
+		value := *expr.Result
+		copied.Result = &value
+	}
+	if expr.ExactResult != nil {
+		copied.ExactResult = new(big.Rat).Set(expr.ExactResult)
+	}
+	copied.StartedAt = copyTime(expr.StartedAt)
+	copied.CompletedAt = copyTime(expr.CompletedAt)
+	copied.Variables = copyVariables(expr.Variables)
+	return &copied
+}
+
+func copyTask(t *models.Task) *models.Task {
+	copied := *t
+	copied.Arg1 = copyArg(t.Arg1)
+	copied.Arg2 = copyArg(t.Arg2)
+	copied.Args = copyArgs(t.Args)
+	copied.DispatchedAt = copyTime(t.DispatchedAt)
+	copied.FinishedAt = copyTime(t.FinishedAt)
+	return &copied
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := t.UTC()
+	return &copied
+}
+
+func copyVariables(variables map[string]string) map[string]string {
+	if len(variables) == 0 {
+		return nil
+	}
+
+	copied := make(map[string]string, len(variables))
+	for name, value := range variables {
+		copied[name] = value
+	}
+	return copied
+}
+
+func copyArgs(args []interface{}) []interface{} {
+	copied := make([]interface{}, len(args))
+	for i, arg := range args {
+		copied[i] = copyArg(arg)
+	}
+	return copied
+}
+
+func copyArg(arg interface{}) interface{} {
+	if rat, ok := arg.(*big.Rat); ok {
+		return new(big.Rat).Set(rat)
+	}
+	return arg
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+	"github.com/neptship/calc-yandex-go/internal/database/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return memory.New()
+	})
+}
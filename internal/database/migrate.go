@@ -0,0 +1,306 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var ErrDatabaseTooNew = errors.New("database schema is newer than this binary")
+
+// Migration is one step of the schema. Migrations are read from
+// migrations/NNNN_name.up.sql and the matching .down.sql and applied in
+// order of NNNN; every applied version is recorded in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a migration known to the binary or recorded in
+// the database. AppliedAt is nil for pending migrations; Name is empty for
+// versions applied by a newer binary.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// legacyMarkers tell how far a database created before schema_migrations
+// existed has got: the schema used to be extended in place, so the columns
+// of each of these migrations are present only if all earlier ones are.
+var legacyMarkers = []struct {
+	Version int
+	Table   string
+	Column  string
+}{
+	{1, "users", "id"},
+	{2, "tasks", "args"},
+	{3, "expressions", "mode"},
+	{4, "expressions", "variables"},
+	{5, "expressions", "error_message"},
+	{6, "refresh_tokens", "token_hash"},
+}
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);`
+
+// Migrations returns the migrations embedded in the binary ordered by
+// version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		name := file.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+		number, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s does not start with a version", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		} else if migration.Name != title {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, title)
+		}
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations and returns how many were
+// applied. It fails with ErrDatabaseTooNew, without touching anything, if
+// the database has migrations the binary does not know.
+func MigrateUp(db *sql.DB) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := prepareMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	if current > len(migrations) {
+		return 0, fmt.Errorf("%w: database is at version %d, binary knows %d", ErrDatabaseTooNew, current, len(migrations))
+	}
+
+	for _, migration := range migrations[current:] {
+		err := inTransaction(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+
+	return len(migrations) - current, nil
+}
+
+// MigrateDown reverts the last steps migrations. It is meant for
+// development: reverting drops the data of the removed tables and columns.
+func MigrateDown(db *sql.DB, steps int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := prepareMigrations(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: database is at version %d, binary knows %d", ErrDatabaseTooNew, current, len(migrations))
+	}
+
+	for ; steps > 0 && current > 0; steps-- {
+		migration := migrations[current-1]
+		err := inTransaction(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		current--
+	}
+
+	return nil
+}
+
+// MigrationStatuses lists the migrations of the binary together with those
+// recorded in the database, ordered by version.
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := prepareMigrations(db); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name})
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		if version <= len(statuses) {
+			statuses[version-1].AppliedAt = &appliedAt
+		} else {
+			statuses = append(statuses, MigrationStatus{Version: version, AppliedAt: &appliedAt})
+		}
+	}
+	return statuses, rows.Err()
+}
+
+// prepareMigrations creates schema_migrations if needed and returns the
+// current version. A database created before migrations existed is
+// recorded as being at the version its columns match.
+func prepareMigrations(db *sql.DB) (int, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')").Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		legacy, err := legacyVersion(db)
+		if err != nil {
+			return 0, err
+		}
+
+		err = inTransaction(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(createMigrationsTable); err != nil {
+				return err
+			}
+			if legacy == 0 {
+				return nil
+			}
+
+			migrations, err := Migrations()
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			for _, migration := range migrations[:legacy] {
+				if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+					migration.Version, migration.Name, now); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if legacy > 0 {
+			log.Printf("Database created before migrations, recorded as version %d", legacy)
+		}
+	}
+
+	var current int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	return current, err
+}
+
+func legacyVersion(db *sql.DB) (int, error) {
+	version := 0
+	for _, marker := range legacyMarkers {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", marker.Table, marker.Column).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			break
+		}
+		version = marker.Version
+	}
+	return version, nil
+}
+
+func inTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
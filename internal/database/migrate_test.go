@@ -0,0 +1,141 @@
+package database_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+)
+
+func openDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "calculator.db")
+	db, err := database.Open(path)
+	if err != nil {
+		t.Fatalf("не удалось открыть базу данных: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func appliedVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	statuses, err := database.MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("не удалось получить состояние миграций: %v", err)
+	}
+	version := 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			version = status.Version
+		}
+	}
+	return version
+}
+
+func hasColumn(t *testing.T, db *sql.DB, table, column string) bool {
+	t.Helper()
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column).Scan(&exists)
+	if err != nil {
+		t.Fatalf("не удалось прочитать схему: %v", err)
+	}
+	return exists
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db, _ := openDB(t)
+
+	migrations, err := database.Migrations()
+	if err != nil {
+		t.Fatalf("не удалось прочитать миграции: %v", err)
+	}
+
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatalf("не удалось применить миграции: %v", err)
+	}
+	if version := appliedVersion(t, db); version != len(migrations) {
+		t.Fatalf("ожидалась версия %d, получено %d", len(migrations), version)
+	}
+
+	if err := database.MigrateDown(db, len(migrations)); err != nil {
+		t.Fatalf("не удалось откатить миграции: %v", err)
+	}
+	if version := appliedVersion(t, db); version != 0 {
+		t.Fatalf("после отката всех миграций ожидалась версия 0, получено %d", version)
+	}
+	if hasColumn(t, db, "users", "id") {
+		t.Error("откат первой миграции должен удалить таблицы")
+	}
+
+	applied, err := database.MigrateUp(db)
+	if err != nil || applied != len(migrations) {
+		t.Fatalf("повторное применение должно пройти все %d миграций, получено %d (%v)", len(migrations), applied, err)
+	}
+}
+
+func TestLegacyDatabaseIsAdopted(t *testing.T) {
+	db, path := openDB(t)
+
+	// The schema as it was before migrations, with the columns added up to
+	// exact mode.
+	_, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT NOT NULL UNIQUE, password_hash TEXT NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		CREATE TABLE expressions (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, expression TEXT NOT NULL, status TEXT NOT NULL, result REAL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			mode TEXT NOT NULL DEFAULT 'float', result_precision INTEGER NOT NULL DEFAULT 0, exact_result TEXT);
+		CREATE TABLE tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, expression_id INTEGER NOT NULL, arg1 TEXT NOT NULL, arg2 TEXT NOT NULL, operation TEXT NOT NULL, operation_time INTEGER NOT NULL, completed INTEGER DEFAULT 0, result REAL,
+			args TEXT, exact_result TEXT);
+		CREATE TABLE results (id TEXT PRIMARY KEY, expression_id INTEGER NOT NULL, task_id INTEGER, value REAL, completed INTEGER DEFAULT 0);
+		INSERT INTO users (login, password_hash) VALUES ('user', 'hash');`)
+	if err != nil {
+		t.Fatalf("не удалось создать старую схему: %v", err)
+	}
+
+	store, err := database.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("старая база должна обновляться: %v", err)
+	}
+	defer store.Close()
+
+	if !hasColumn(t, db, "expressions", "error_message") || !hasColumn(t, db, "refresh_tokens", "token_hash") {
+		t.Error("недостающие миграции должны примениться")
+	}
+	if _, _, err := store.GetUserByLogin("user"); err != nil {
+		t.Errorf("данные старой базы должны сохраниться: %v", err)
+	}
+
+	statuses, err := database.MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("не удалось получить состояние миграций: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("миграция %d_%s должна быть отмечена применённой", status.Version, status.Name)
+		}
+	}
+}
+
+func TestNewerDatabaseIsRefused(t *testing.T) {
+	db, path := openDB(t)
+
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatalf("не удалось применить миграции: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		1000, "future", time.Now()); err != nil {
+		t.Fatalf("не удалось добавить миграцию: %v", err)
+	}
+
+	if _, err := database.NewDatabase(path); !errors.Is(err, database.ErrDatabaseTooNew) {
+		t.Fatalf("база новее бинарника должна отклоняться, получено %v", err)
+	}
+	if err := database.MigrateDown(db, 1); !errors.Is(err, database.ErrDatabaseTooNew) {
+		t.Errorf("откат неизвестной миграции должен отклоняться, получено %v", err)
+	}
+}
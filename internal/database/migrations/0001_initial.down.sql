@@ -0,0 +1,4 @@
+DROP TABLE results;
+DROP TABLE tasks;
+DROP TABLE expressions;
+DROP TABLE users;
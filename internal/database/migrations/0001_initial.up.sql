@@ -1,14 +1,11 @@
-package database
-
-const Schema = `
-CREATE TABLE IF NOT EXISTS users (
+CREATE TABLE users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     login TEXT NOT NULL UNIQUE,
     password_hash TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE IF NOT EXISTS expressions (
+CREATE TABLE expressions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     expression TEXT NOT NULL,
@@ -18,7 +15,7 @@ CREATE TABLE IF NOT EXISTS expressions (
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
-CREATE TABLE IF NOT EXISTS tasks (
+CREATE TABLE tasks (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     expression_id INTEGER NOT NULL,
     arg1 TEXT NOT NULL,
@@ -30,7 +27,7 @@ CREATE TABLE IF NOT EXISTS tasks (
     FOREIGN KEY (expression_id) REFERENCES expressions(id)
 );
 
-CREATE TABLE IF NOT EXISTS results (
+CREATE TABLE results (
     id TEXT PRIMARY KEY,
     expression_id INTEGER NOT NULL,
     task_id INTEGER,
@@ -39,4 +36,3 @@ CREATE TABLE IF NOT EXISTS results (
     FOREIGN KEY (expression_id) REFERENCES expressions(id),
     FOREIGN KEY (task_id) REFERENCES tasks(id)
 );
-`
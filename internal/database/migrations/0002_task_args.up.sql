@@ -0,0 +1 @@
+ALTER TABLE tasks ADD COLUMN args TEXT;
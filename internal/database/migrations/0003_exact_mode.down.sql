@@ -0,0 +1,4 @@
+ALTER TABLE tasks DROP COLUMN exact_result;
+ALTER TABLE expressions DROP COLUMN exact_result;
+ALTER TABLE expressions DROP COLUMN result_precision;
+ALTER TABLE expressions DROP COLUMN mode;
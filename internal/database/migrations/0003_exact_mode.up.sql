@@ -0,0 +1,4 @@
+ALTER TABLE expressions ADD COLUMN mode TEXT NOT NULL DEFAULT 'float';
+ALTER TABLE expressions ADD COLUMN result_precision INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE expressions ADD COLUMN exact_result TEXT;
+ALTER TABLE tasks ADD COLUMN exact_result TEXT;
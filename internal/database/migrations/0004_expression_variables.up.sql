@@ -0,0 +1 @@
+ALTER TABLE expressions ADD COLUMN variables TEXT;
@@ -0,0 +1 @@
+ALTER TABLE expressions ADD COLUMN error_message TEXT;
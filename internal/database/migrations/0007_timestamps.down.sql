@@ -0,0 +1,4 @@
+ALTER TABLE tasks DROP COLUMN finished_at;
+ALTER TABLE tasks DROP COLUMN dispatched_at;
+ALTER TABLE expressions DROP COLUMN completed_at;
+ALTER TABLE expressions DROP COLUMN started_at;
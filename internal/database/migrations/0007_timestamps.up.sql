@@ -0,0 +1,4 @@
+ALTER TABLE expressions ADD COLUMN started_at TIMESTAMP;
+ALTER TABLE expressions ADD COLUMN completed_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN dispatched_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN finished_at TIMESTAMP;
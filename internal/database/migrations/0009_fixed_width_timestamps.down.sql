@@ -0,0 +1,6 @@
+DROP INDEX idx_expressions_user_created;
+UPDATE tasks SET finished_at = replace(replace(finished_at, 'T', ' '), 'Z', '+00:00') WHERE finished_at IS NOT NULL;
+UPDATE tasks SET dispatched_at = replace(replace(dispatched_at, 'T', ' '), 'Z', '+00:00') WHERE dispatched_at IS NOT NULL;
+UPDATE expressions SET completed_at = replace(replace(completed_at, 'T', ' '), 'Z', '+00:00') WHERE completed_at IS NOT NULL;
+UPDATE expressions SET started_at = replace(replace(started_at, 'T', ' '), 'Z', '+00:00') WHERE started_at IS NOT NULL;
+UPDATE expressions SET created_at = replace(replace(created_at, 'T', ' '), 'Z', '+00:00') WHERE created_at IS NOT NULL;
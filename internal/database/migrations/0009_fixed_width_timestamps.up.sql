@@ -0,0 +1,36 @@
+-- Timestamps were stored as "YYYY-MM-DD HH:MM:SS[.fraction]+00:00" with a
+-- fraction of varying length (or without an offset by CURRENT_TIMESTAMP).
+-- They are rewritten as RFC 3339 UTC with nine fractional digits, which
+-- compares correctly as text.
+
+UPDATE expressions SET created_at = strftime('%Y-%m-%dT%H:%M:%S', created_at) || '.' ||
+    substr(CASE WHEN substr(created_at, 20, 1) = '.'
+        THEN substr(created_at, 21, instr(substr(created_at, 21) || '+', '+') - 1)
+        ELSE '' END || '000000000', 1, 9) || 'Z'
+WHERE created_at IS NOT NULL;
+
+UPDATE expressions SET started_at = strftime('%Y-%m-%dT%H:%M:%S', started_at) || '.' ||
+    substr(CASE WHEN substr(started_at, 20, 1) = '.'
+        THEN substr(started_at, 21, instr(substr(started_at, 21) || '+', '+') - 1)
+        ELSE '' END || '000000000', 1, 9) || 'Z'
+WHERE started_at IS NOT NULL;
+
+UPDATE expressions SET completed_at = strftime('%Y-%m-%dT%H:%M:%S', completed_at) || '.' ||
+    substr(CASE WHEN substr(completed_at, 20, 1) = '.'
+        THEN substr(completed_at, 21, instr(substr(completed_at, 21) || '+', '+') - 1)
+        ELSE '' END || '000000000', 1, 9) || 'Z'
+WHERE completed_at IS NOT NULL;
+
+UPDATE tasks SET dispatched_at = strftime('%Y-%m-%dT%H:%M:%S', dispatched_at) || '.' ||
+    substr(CASE WHEN substr(dispatched_at, 20, 1) = '.'
+        THEN substr(dispatched_at, 21, instr(substr(dispatched_at, 21) || '+', '+') - 1)
+        ELSE '' END || '000000000', 1, 9) || 'Z'
+WHERE dispatched_at IS NOT NULL;
+
+UPDATE tasks SET finished_at = strftime('%Y-%m-%dT%H:%M:%S', finished_at) || '.' ||
+    substr(CASE WHEN substr(finished_at, 20, 1) = '.'
+        THEN substr(finished_at, 21, instr(substr(finished_at, 21) || '+', '+') - 1)
+        ELSE '' END || '000000000', 1, 9) || 'Z'
+WHERE finished_at IS NOT NULL;
+
+CREATE INDEX idx_expressions_user_created ON expressions(user_id, created_at);
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// Fields expressions can be sorted by. Expressions are created in ID
+// order, so sorting by creation time sorts by ID.
+const (
+	SortByCreatedAt  = "created_at"
+	SortByExpression = "expression"
+	SortByStatus     = "status"
+)
+
+// ExpressionQuery selects a page of the expressions of a user. Zero values
+// do not filter: From and To bound the creation time (To is exclusive) and
+// Search matches a substring of the expression text.
+type ExpressionQuery struct {
+	UserID     int
+	Statuses   []models.ExpressionStatus
+	From       time.Time
+	To         time.Time
+	Search     string
+	SortBy     string
+	Descending bool
+	// After continues the listing after the given expression; it must come
+	// from the same sort order.
+	After *ExpressionCursor
+	Limit int
+}
+
+// ExpressionCursor is the position of an expression in a sort order: its
+// ID and, unless sorting by creation time, the value of the sort field.
+type ExpressionCursor struct {
+	ID    int
+	Value string
+}
+
+// CursorFor returns the position of expr in the sort order of the query.
+func (q ExpressionQuery) CursorFor(expr *models.Expression) *ExpressionCursor {
+	switch q.SortBy {
+	case SortByExpression:
+		return &ExpressionCursor{ID: expr.ID, Value: expr.Expression}
+	case SortByStatus:
+		return &ExpressionCursor{ID: expr.ID, Value: string(expr.Status)}
+	default:
+		return &ExpressionCursor{ID: expr.ID}
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+const sessionColumns = "id, user_id, token_hash, user_agent, created_at, last_used_at, expires_at, revoked_at"
+
+func (d *Database) CreateSession(session *models.Session) error {
+	_, err := d.db.Exec(`INSERT INTO refresh_tokens (id, user_id, token_hash, user_agent, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.TokenHash, session.UserAgent, session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	return err
+}
+
+func (d *Database) GetSession(id string) (*models.Session, error) {
+	return scanSession(d.db.QueryRow("SELECT "+sessionColumns+" FROM refresh_tokens WHERE id = ?", id))
+}
+
+func (d *Database) GetSessionByTokenHash(tokenHash string) (*models.Session, error) {
+	return scanSession(d.db.QueryRow("SELECT "+sessionColumns+" FROM refresh_tokens WHERE token_hash = ?", tokenHash))
+}
+
+func (d *Database) GetUserSessions(userID int) ([]*models.Session, error) {
+	rows, err := d.db.Query("SELECT "+sessionColumns+` FROM refresh_tokens
+		WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (d *Database) RotateSession(id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	result, err := d.db.Exec(`UPDATE refresh_tokens SET token_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND token_hash = ? AND revoked_at IS NULL`,
+		newHash, usedAt, expiresAt, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+	return affected(result)
+}
+
+func (d *Database) RevokeSession(userID int, id string, revokedAt time.Time) (bool, error) {
+	result, err := d.db.Exec(`UPDATE refresh_tokens SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		revokedAt, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return affected(result)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	session := &models.Session{}
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&session.ID, &session.UserID, &session.TokenHash, &session.UserAgent,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
+
+func affected(result sql.Result) (bool, error) {
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
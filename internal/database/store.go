@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrDuplicate = errors.New("already exists")
+)
+
+// UserStore keeps users and their login sessions. Lookups of missing records
+// return ErrNotFound; creating a user with a taken login returns ErrDuplicate.
+type UserStore interface {
+	CreateUser(login, passwordHash string) error
+	CheckUserExists(login string) (bool, error)
+	GetUserByLogin(login string) (int, string, error)
+	GetUserLogin(id int) (string, error)
+
+	CreateSession(session *models.Session) error
+	GetSession(id string) (*models.Session, error)
+	GetSessionByTokenHash(tokenHash string) (*models.Session, error)
+	// GetUserSessions returns the sessions of the user that were not
+	// revoked, most recently used first.
+	GetUserSessions(userID int) ([]*models.Session, error)
+	// RotateSession replaces the token hash of an active session, but only
+	// if it still is oldHash. It reports whether the session was updated.
+	RotateSession(id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error)
+	// RevokeSession reports whether an active session of the user was
+	// revoked.
+	RevokeSession(userID int, id string, revokedAt time.Time) (bool, error)
+}
+
+// ExpressionPlan is what CreateExpression stores along with a new
+// expression: its tasks and the ID of the result the last task produces.
+type ExpressionPlan struct {
+	Tasks        []*models.Task
+	RootResultID string
+}
+
+// ExpressionStore keeps submitted expressions. Updates of a missing
+// expression are no-ops.
+type ExpressionStore interface {
+	SaveExpression(userID int, expr *models.Expression) (int, error)
+	// CreateExpression stores the expression, with its result if it is
+	// already known, and the plan built for its ID in one transaction.
+	// plan may be nil for expressions without tasks. If plan or any write
+	// fails, nothing is stored.
+	CreateExpression(userID int, expr *models.Expression, plan func(expressionID int) (*ExpressionPlan, error)) (int, error)
+	GetExpression(id int) (*models.Expression, error)
+	// GetUserExpressions returns the expressions of the user, newest first.
+	GetUserExpressions(userID int) ([]*models.Expression, error)
+	// ListExpressions returns up to query.Limit expressions matching the
+	// query and how many match it in total, regardless of paging.
+	ListExpressions(query ExpressionQuery) ([]*models.Expression, int, error)
+	// CountExpressionsByStatus returns how many expressions of all users
+	// have each status; statuses without expressions are left out.
+	CountExpressionsByStatus() (map[models.ExpressionStatus]int, error)
+	// GetUnfinishedExpressions returns pending and processing expressions
+	// ordered by ID.
+	GetUnfinishedExpressions() ([]*models.Expression, error)
+	UpdateExpressionStatus(id int, status models.ExpressionStatus) error
+	// StartExpression moves a pending expression to processing; any other
+	// status is left as it is.
+	StartExpression(id int) error
+	SetExpressionResult(id int, result float64) error
+	SetExpressionExactResult(id int, result *big.Rat) error
+	FailExpression(id int, reason string) error
+	// SetExpressionStartedAt records when the first task of the expression
+	// was dispatched; later calls keep the first time.
+	SetExpressionStartedAt(id int, at time.Time) error
+	// SetExpressionCompletedAt records when the expression completed, failed
+	// or was cancelled.
+	SetExpressionCompletedAt(id int, at time.Time) error
+}
+
+// TaskStore keeps the tasks of expressions and the results they produce.
+// SaveTask keeps task.ID when it is set.
+type TaskStore interface {
+	SaveTask(task *models.Task) (int, error)
+	GetUncompletedTasks(expressionID int) ([]*models.Task, error)
+	GetTaskResults(expressionID int) ([]*models.TaskResult, error)
+	GetMaxTaskID() (int, error)
+	SetTaskResult(taskID int, result float64) error
+	SetTaskExactResult(taskID int, result *big.Rat) error
+	SaveResult(resultID string, expressionID int, taskID *int, value float64, completed bool) error
+	GetResult(resultID string) (float64, bool, error)
+	// GetExpressionTasks returns all tasks of the expression ordered by ID,
+	// whether they have finished or not.
+	GetExpressionTasks(expressionID int) ([]*models.TaskRecord, error)
+	// SetTaskDispatched records when and to which agent the task was last
+	// handed out.
+	SetTaskDispatched(taskID int, agentID string, at time.Time) error
+	// ClearTaskDispatched forgets the agent and dispatch time of a task that
+	// went back to the queue.
+	ClearTaskDispatched(taskID int) error
+	// SetTaskFinishedAt records when the result or error of the task came
+	// back.
+	SetTaskFinishedAt(taskID int, at time.Time) error
+}
+
+// Store is a complete storage backend.
+type Store interface {
+	UserStore
+	ExpressionStore
+	TaskStore
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,628 @@
+// Package storetest is the conformance suite every database.Store
+// implementation has to pass.
+package storetest
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// Run runs the suite; open must return a new, empty store on every call.
+func Run(t *testing.T, open func(t *testing.T) database.Store) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, open(t)) })
+	t.Run("Expressions", func(t *testing.T) { testExpressions(t, open(t)) })
+	t.Run("Tasks", func(t *testing.T) { testTasks(t, open(t)) })
+	t.Run("CreateExpression", func(t *testing.T) { testCreateExpression(t, open(t)) })
+	t.Run("ListExpressions", func(t *testing.T) { testListExpressions(t, open(t)) })
+	t.Run("Timestamps", func(t *testing.T) { testTimestamps(t, open(t)) })
+	t.Run("ExpressionTasks", func(t *testing.T) { testExpressionTasks(t, open(t)) })
+}
+
+func testUsers(t *testing.T, store database.Store) {
+	if _, _, err := store.GetUserByLogin("user"); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("несуществующий пользователь должен давать ErrNotFound, получено %v", err)
+	}
+
+	if err := store.CreateUser("user", "hash"); err != nil {
+		t.Fatalf("не удалось создать пользователя: %v", err)
+	}
+	if err := store.CreateUser("user", "other"); !errors.Is(err, database.ErrDuplicate) {
+		t.Errorf("повторный логин должен давать ErrDuplicate, получено %v", err)
+	}
+
+	exists, err := store.CheckUserExists("user")
+	if err != nil || !exists {
+		t.Errorf("пользователь должен существовать: %v", err)
+	}
+
+	id, hash, err := store.GetUserByLogin("user")
+	if err != nil || hash != "hash" {
+		t.Fatalf("ожидался хеш %q, получено %q (%v)", "hash", hash, err)
+	}
+	login, err := store.GetUserLogin(id)
+	if err != nil || login != "user" {
+		t.Errorf("ожидался логин %q, получено %q (%v)", "user", login, err)
+	}
+	if _, err := store.GetUserLogin(id + 1); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("несуществующий ID должен давать ErrNotFound, получено %v", err)
+	}
+}
+
+func testSessions(t *testing.T, store database.Store) {
+	if err := store.CreateUser("user", "hash"); err != nil {
+		t.Fatalf("не удалось создать пользователя: %v", err)
+	}
+	userID, _, err := store.GetUserByLogin("user")
+	if err != nil {
+		t.Fatalf("не удалось найти пользователя: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, id := range []string{"first", "second"} {
+		err := store.CreateSession(&models.Session{
+			ID:         id,
+			UserID:     userID,
+			TokenHash:  id + "-hash",
+			UserAgent:  id + "-agent",
+			CreatedAt:  now,
+			LastUsedAt: now.Add(time.Duration(i) * time.Minute),
+			ExpiresAt:  now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("не удалось создать сессию %s: %v", id, err)
+		}
+	}
+
+	session, err := store.GetSessionByTokenHash("first-hash")
+	if err != nil || session.ID != "first" || session.UserID != userID || session.UserAgent != "first-agent" ||
+		!session.ExpiresAt.Equal(now.Add(time.Hour)) || session.RevokedAt != nil {
+		t.Fatalf("сессия прочитана неверно: %+v (%v)", session, err)
+	}
+	if _, err := store.GetSessionByTokenHash("missing"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("неизвестный токен должен давать ErrNotFound, получено %v", err)
+	}
+
+	sessions, err := store.GetUserSessions(userID)
+	if err != nil || len(sessions) != 2 || sessions[0].ID != "second" || sessions[1].ID != "first" {
+		t.Fatalf("сессии должны идти от последней использованной, получено %+v (%v)", sessions, err)
+	}
+
+	later := now.Add(2 * time.Minute)
+	rotated, err := store.RotateSession("first", "first-hash", "first-new", later, later.Add(time.Hour))
+	if err != nil || !rotated {
+		t.Fatalf("не удалось обновить сессию: %v", err)
+	}
+	rotated, err = store.RotateSession("first", "first-hash", "first-again", later, later.Add(time.Hour))
+	if err != nil || rotated {
+		t.Errorf("обновление со старым хешем не должно проходить: %v", err)
+	}
+	session, err = store.GetSession("first")
+	if err != nil || session.TokenHash != "first-new" || !session.LastUsedAt.Equal(later) || !session.ExpiresAt.Equal(later.Add(time.Hour)) {
+		t.Errorf("обновлённая сессия прочитана неверно: %+v (%v)", session, err)
+	}
+
+	revoked, err := store.RevokeSession(userID+1, "first", later)
+	if err != nil || revoked {
+		t.Errorf("чужую сессию нельзя отозвать: %v", err)
+	}
+	revoked, err = store.RevokeSession(userID, "first", later)
+	if err != nil || !revoked {
+		t.Fatalf("не удалось отозвать сессию: %v", err)
+	}
+	revoked, err = store.RevokeSession(userID, "first", later)
+	if err != nil || revoked {
+		t.Errorf("повторный отзыв не должен ничего менять: %v", err)
+	}
+
+	session, err = store.GetSession("first")
+	if err != nil || session.RevokedAt == nil || !session.RevokedAt.Equal(later) {
+		t.Errorf("у отозванной сессии должно быть время отзыва: %+v (%v)", session, err)
+	}
+	rotated, err = store.RotateSession("first", "first-new", "first-again", later, later.Add(time.Hour))
+	if err != nil || rotated {
+		t.Errorf("отозванную сессию нельзя обновить: %v", err)
+	}
+
+	sessions, err = store.GetUserSessions(userID)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "second" {
+		t.Errorf("в списке должна остаться только активная сессия, получено %+v (%v)", sessions, err)
+	}
+}
+
+func testExpressions(t *testing.T, store database.Store) {
+	if _, err := store.GetExpression(1); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("несуществующее выражение должно давать ErrNotFound, получено %v", err)
+	}
+
+	first, err := store.SaveExpression(1, &models.Expression{
+		Expression: "x+1",
+		Status:     models.StatusProcessing,
+		Mode:       "float",
+		Precision:  10,
+		Variables:  map[string]string{"x": "2"},
+	})
+	if err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+	second, err := store.SaveExpression(1, &models.Expression{Expression: "1/3", Status: models.StatusPending, Mode: "exact", Precision: 10})
+	if err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+	other, err := store.SaveExpression(2, &models.Expression{Expression: "2*2", Status: models.StatusProcessing, Mode: "float", Precision: 10})
+	if err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+	if first == second || second == other || first == other {
+		t.Fatalf("выражения должны получать разные ID: %d, %d, %d", first, second, other)
+	}
+
+	expr, err := store.GetExpression(first)
+	if err != nil || expr.ID != first || expr.UserID != 1 || expr.Expression != "x+1" || expr.Status != models.StatusProcessing ||
+		expr.Mode != "float" || expr.Precision != 10 || expr.Variables["x"] != "2" || expr.Result != nil {
+		t.Fatalf("выражение прочитано неверно: %+v (%v)", expr, err)
+	}
+
+	if err := store.SetExpressionResult(first, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	if err := store.SetExpressionExactResult(second, big.NewRat(1, 3)); err != nil {
+		t.Fatalf("не удалось сохранить точный результат: %v", err)
+	}
+	if err := store.FailExpression(other, "division by zero"); err != nil {
+		t.Fatalf("не удалось отметить ошибку: %v", err)
+	}
+	if err := store.UpdateExpressionStatus(other+100, models.StatusCancelled); err != nil {
+		t.Errorf("обновление несуществующего выражения не должно давать ошибку: %v", err)
+	}
+
+	expressions, err := store.GetUserExpressions(1)
+	if err != nil || len(expressions) != 2 || expressions[0].ID != second || expressions[1].ID != first {
+		t.Fatalf("выражения пользователя должны идти от новых к старым, получено %+v (%v)", expressions, err)
+	}
+	exact := expressions[0]
+	if exact.Status != models.StatusCompleted || exact.ExactResult == nil || exact.ExactResult.Cmp(big.NewRat(1, 3)) != 0 ||
+		exact.Result == nil || *exact.Result != 1.0/3 {
+		t.Errorf("точный результат прочитан неверно: %+v", exact)
+	}
+	if result := expressions[1].Result; expressions[1].Status != models.StatusCompleted || result == nil || *result != 3 {
+		t.Errorf("результат прочитан неверно: %+v", expressions[1])
+	}
+
+	failed, err := store.GetExpression(other)
+	if err != nil || failed.Status != models.StatusFailed || failed.Error != "division by zero" {
+		t.Errorf("ошибка выражения прочитана неверно: %+v (%v)", failed, err)
+	}
+
+	if err := store.StartExpression(other); err != nil {
+		t.Fatalf("не удалось начать выражение: %v", err)
+	}
+	if failed, err := store.GetExpression(other); err != nil || failed.Status != models.StatusFailed {
+		t.Errorf("начало вычисления не должно менять статус failed, получено %+v (%v)", failed, err)
+	}
+	if err := store.UpdateExpressionStatus(other, models.StatusPending); err != nil {
+		t.Fatalf("не удалось обновить статус: %v", err)
+	}
+	if err := store.UpdateExpressionStatus(first, models.StatusPending); err != nil {
+		t.Fatalf("не удалось обновить статус: %v", err)
+	}
+	if err := store.StartExpression(first); err != nil {
+		t.Fatalf("не удалось начать выражение: %v", err)
+	}
+	unfinished, err := store.GetUnfinishedExpressions()
+	if err != nil || len(unfinished) != 2 || unfinished[0].ID != first || unfinished[1].ID != other ||
+		unfinished[1].UserID != 2 || unfinished[1].Expression != "2*2" {
+		t.Errorf("незавершённые выражения прочитаны неверно: %+v (%v)", unfinished, err)
+	}
+
+	counts, err := store.CountExpressionsByStatus()
+	if err != nil || len(counts) != 3 || counts[models.StatusProcessing] != 1 || counts[models.StatusPending] != 1 || counts[models.StatusCompleted] != 1 {
+		t.Errorf("ожидалось по одному выражению в статусах processing, pending и completed, получено %v (%v)", counts, err)
+	}
+}
+
+func testTasks(t *testing.T, store database.Store) {
+	if maxID, err := store.GetMaxTaskID(); err != nil || maxID != 0 {
+		t.Fatalf("в пустом хранилище не должно быть задач, получено %d (%v)", maxID, err)
+	}
+
+	expressionID, err := store.SaveExpression(1, &models.Expression{Expression: "(1+2)*1/3", Status: models.StatusProcessing, Mode: "exact", Precision: 10})
+	if err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+
+	tasks := []*models.Task{
+		{ID: 5, ExpressionID: expressionID, Operation: "+", OperationTime: 10, Args: []interface{}{1.0, 2.0}},
+		{ID: 6, ExpressionID: expressionID, Operation: "/", OperationTime: 20, Args: []interface{}{big.NewRat(1, 1), big.NewRat(3, 1)}},
+		{ID: 7, ExpressionID: expressionID, Operation: "*", OperationTime: 30, Args: []interface{}{"5_5", "5_6"}},
+	}
+	for _, task := range tasks {
+		task.Arg1, task.Arg2 = task.Args[0], task.Args[1]
+		id, err := store.SaveTask(task)
+		if err != nil || id != task.ID {
+			t.Fatalf("задача должна сохраниться с ID=%d, получено %d (%v)", task.ID, id, err)
+		}
+	}
+	if _, err := store.SaveTask(tasks[0]); err == nil {
+		t.Error("задача с занятым ID не должна сохраняться")
+	}
+
+	if maxID, err := store.GetMaxTaskID(); err != nil || maxID != 7 {
+		t.Errorf("ожидался максимальный ID 7, получено %d (%v)", maxID, err)
+	}
+
+	if err := store.SetTaskResult(5, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат задачи: %v", err)
+	}
+	if err := store.SetTaskExactResult(6, big.NewRat(1, 3)); err != nil {
+		t.Fatalf("не удалось сохранить точный результат задачи: %v", err)
+	}
+
+	pending, err := store.GetUncompletedTasks(expressionID)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("ожидалась одна незавершённая задача, получено %+v (%v)", pending, err)
+	}
+	task := pending[0]
+	if task.ID != 7 || task.ExpressionID != expressionID || task.Operation != "*" || task.OperationTime != 30 ||
+		len(task.Args) != 2 || task.Args[0] != "5_5" || task.Args[1] != "5_6" || task.Arg1 != "5_5" {
+		t.Errorf("задача прочитана неверно: %+v", task)
+	}
+
+	results, err := store.GetTaskResults(expressionID)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("ожидалось два результата, получено %+v (%v)", results, err)
+	}
+	if results[0].ID != 5 || results[0].Result != 3 || results[0].ExactResult != nil {
+		t.Errorf("результат задачи прочитан неверно: %+v", results[0])
+	}
+	if results[1].ID != 6 || results[1].ExactResult == nil || results[1].ExactResult.Cmp(big.NewRat(1, 3)) != 0 {
+		t.Errorf("точный результат задачи прочитан неверно: %+v", results[1])
+	}
+
+	taskID := 7
+	if err := store.SaveResult("root", expressionID, &taskID, 0, false); err != nil {
+		t.Fatalf("не удалось сохранить итог: %v", err)
+	}
+	if value, completed, err := store.GetResult("root"); err != nil || value != 0 || completed {
+		t.Errorf("итог прочитан неверно: %v %v (%v)", value, completed, err)
+	}
+	if _, _, err := store.GetResult("missing"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("неизвестный итог должен давать ErrNotFound, получено %v", err)
+	}
+}
+
+func testCreateExpression(t *testing.T, store database.Store) {
+	if _, err := store.SaveTask(&models.Task{ID: 3, ExpressionID: 100, Operation: "+", Args: []interface{}{1.0, 2.0}}); err != nil {
+		t.Fatalf("не удалось сохранить задачу: %v", err)
+	}
+
+	planErr := errors.New("plan failed")
+	_, err := store.CreateExpression(1, &models.Expression{Expression: "1+2", Status: models.StatusProcessing, Mode: "float"},
+		func(int) (*database.ExpressionPlan, error) { return nil, planErr })
+	if !errors.Is(err, planErr) {
+		t.Fatalf("ошибка плана должна возвращаться, получено %v", err)
+	}
+
+	// The second task clashes with the one saved above, so the whole
+	// expression has to be rolled back.
+	_, err = store.CreateExpression(1, &models.Expression{Expression: "(1+2)*3", Status: models.StatusProcessing, Mode: "float"},
+		func(expressionID int) (*database.ExpressionPlan, error) {
+			return &database.ExpressionPlan{
+				Tasks: []*models.Task{
+					{ID: 2, ExpressionID: expressionID, Operation: "+", Args: []interface{}{1.0, 2.0}},
+					{ID: 3, ExpressionID: expressionID, Operation: "*", Args: []interface{}{"r", 3.0}},
+				},
+				RootResultID: "root",
+			}, nil
+		})
+	if err == nil {
+		t.Fatal("выражение с занятым ID задачи не должно сохраняться")
+	}
+
+	expressions, err := store.GetUserExpressions(1)
+	if err != nil || len(expressions) != 0 {
+		t.Fatalf("после неудачи не должно остаться выражений, получено %+v (%v)", expressions, err)
+	}
+	if maxID, err := store.GetMaxTaskID(); err != nil || maxID != 3 {
+		t.Errorf("после неудачи не должно остаться задач, максимальный ID %d (%v)", maxID, err)
+	}
+	if _, _, err := store.GetResult("root"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("после неудачи не должно остаться итога, получено %v", err)
+	}
+
+	var planned int
+	expressionID, err := store.CreateExpression(1, &models.Expression{Expression: "(1+2)*3", Status: models.StatusProcessing, Mode: "float"},
+		func(expressionID int) (*database.ExpressionPlan, error) {
+			planned = expressionID
+			return &database.ExpressionPlan{
+				Tasks: []*models.Task{
+					{ID: 4, ExpressionID: expressionID, Operation: "+", Args: []interface{}{1.0, 2.0}},
+					{ID: 5, ExpressionID: expressionID, Operation: "*", Args: []interface{}{"r", 3.0}},
+				},
+				RootResultID: "root",
+			}, nil
+		})
+	if err != nil || expressionID != planned {
+		t.Fatalf("выражение должно сохраниться под ID из плана %d, получено %d (%v)", planned, expressionID, err)
+	}
+
+	tasks, err := store.GetUncompletedTasks(expressionID)
+	if err != nil || len(tasks) != 2 || tasks[0].ID != 4 || tasks[1].ID != 5 {
+		t.Errorf("задачи выражения сохранены неверно: %+v (%v)", tasks, err)
+	}
+	if _, completed, err := store.GetResult("root"); err != nil || completed {
+		t.Errorf("итог должен сохраниться незавершённым: %v", err)
+	}
+
+	value := 0.5
+	constantID, err := store.CreateExpression(1, &models.Expression{
+		Expression:  "1/2",
+		Status:      models.StatusCompleted,
+		Mode:        "exact",
+		Result:      &value,
+		ExactResult: big.NewRat(1, 2),
+	}, nil)
+	if err != nil {
+		t.Fatalf("не удалось сохранить выражение без задач: %v", err)
+	}
+	constant, err := store.GetExpression(constantID)
+	if err != nil || constant.Status != models.StatusCompleted || constant.Result == nil || *constant.Result != 0.5 ||
+		constant.ExactResult == nil || constant.ExactResult.Cmp(big.NewRat(1, 2)) != 0 {
+		t.Errorf("результат выражения без задач должен сохраняться сразу: %+v (%v)", constant, err)
+	}
+}
+
+func testListExpressions(t *testing.T, store database.Store) {
+	saved := map[string]int{}
+	for _, e := range []struct {
+		userID     int
+		expression string
+		status     models.ExpressionStatus
+	}{
+		{1, "2+2", models.StatusCompleted},
+		{1, "sqrt(16)", models.StatusFailed},
+		{1, "1+sqrt(4)", models.StatusCompleted},
+		{2, "sqrt(9)", models.StatusCompleted},
+		{1, "10/5", models.StatusProcessing},
+		{1, "3*3", models.StatusCompleted},
+	} {
+		id, err := store.SaveExpression(e.userID, &models.Expression{Expression: e.expression, Status: e.status, Mode: "float"})
+		if err != nil {
+			t.Fatalf("не удалось сохранить выражение: %v", err)
+		}
+		saved[e.expression] = id
+	}
+
+	// list pages through the query and returns the expression texts.
+	list := func(query database.ExpressionQuery) ([]string, int) {
+		t.Helper()
+
+		var texts []string
+		total := -1
+		for pages := 0; pages < 10; pages++ {
+			page, count, err := store.ListExpressions(query)
+			if err != nil {
+				t.Fatalf("не удалось получить выражения: %v", err)
+			}
+			if total >= 0 && count != total {
+				t.Errorf("общее число не должно зависеть от страницы: %d и %d", total, count)
+			}
+			total = count
+
+			for _, expr := range page {
+				if expr.UserID != query.UserID {
+					t.Errorf("выражение другого пользователя в выдаче: %+v", expr)
+				}
+				texts = append(texts, expr.Expression)
+			}
+			if len(page) < query.Limit {
+				return texts, total
+			}
+			query.After = query.CursorFor(page[len(page)-1])
+		}
+		t.Fatal("постраничный обход не закончился")
+		return nil, 0
+	}
+
+	equal := func(got []string, want ...string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	texts, total := list(database.ExpressionQuery{UserID: 1, SortBy: database.SortByCreatedAt, Descending: true, Limit: 2})
+	if total != 5 || !equal(texts, "3*3", "10/5", "1+sqrt(4)", "sqrt(16)", "2+2") {
+		t.Errorf("выражения должны идти от новых к старым, получено %v (всего %d)", texts, total)
+	}
+
+	texts, total = list(database.ExpressionQuery{UserID: 1, Search: "sqrt", SortBy: database.SortByExpression, Limit: 1})
+	if total != 2 || !equal(texts, "1+sqrt(4)", "sqrt(16)") {
+		t.Errorf("поиск по подстроке с сортировкой по тексту дал %v (всего %d)", texts, total)
+	}
+
+	texts, total = list(database.ExpressionQuery{
+		UserID:     1,
+		Statuses:   []models.ExpressionStatus{models.StatusCompleted, models.StatusFailed},
+		SortBy:     database.SortByStatus,
+		Descending: true,
+		Limit:      2,
+	})
+	if total != 4 || !equal(texts, "sqrt(16)", "3*3", "1+sqrt(4)", "2+2") {
+		t.Errorf("фильтр по статусу с сортировкой по статусу дал %v (всего %d)", texts, total)
+	}
+
+	now := time.Now()
+	texts, total = list(database.ExpressionQuery{UserID: 1, From: now.Add(-time.Hour), To: now.Add(time.Hour), Limit: 10})
+	if total != 5 || !equal(texts, "2+2", "sqrt(16)", "1+sqrt(4)", "10/5", "3*3") {
+		t.Errorf("диапазон дат, включающий все выражения, дал %v (всего %d)", texts, total)
+	}
+	if texts, total = list(database.ExpressionQuery{UserID: 1, From: now.Add(time.Hour), Limit: 10}); total != 0 || len(texts) != 0 {
+		t.Errorf("диапазон дат в будущем не должен ничего находить, получено %v (всего %d)", texts, total)
+	}
+	if texts, total = list(database.ExpressionQuery{UserID: 1, To: now.Add(-time.Hour), Limit: 10}); total != 0 || len(texts) != 0 {
+		t.Errorf("диапазон дат в прошлом не должен ничего находить, получено %v (всего %d)", texts, total)
+	}
+
+	expr, err := store.GetExpression(saved["2+2"])
+	if err != nil || expr.CreatedAt.IsZero() {
+		t.Errorf("у выражения должно быть время создания: %+v (%v)", expr, err)
+	}
+
+	// Boundaries are compared with full precision, not to the second.
+	created := time.Date(2025, 3, 1, 12, 0, 0, 250_000_000, time.UTC)
+	if _, err := store.SaveExpression(3, &models.Expression{Expression: "1+1", Status: models.StatusCompleted, Mode: "float", CreatedAt: created}); err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+	for _, c := range []struct {
+		from, to time.Time
+		want     int
+	}{
+		{from: created, want: 1},
+		{from: created.Add(time.Millisecond), want: 0},
+		{to: created, want: 0},
+		{to: created.Add(time.Millisecond), want: 1},
+		{from: created.Add(-time.Millisecond).In(time.FixedZone("UTC+3", 3*60*60)), want: 1},
+	} {
+		if _, total := list(database.ExpressionQuery{UserID: 3, From: c.from, To: c.to, Limit: 10}); total != c.want {
+			t.Errorf("диапазон [%v, %v) должен содержать %d выражений, получено %d", c.from, c.to, c.want, total)
+		}
+	}
+}
+
+func testTimestamps(t *testing.T, store database.Store) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	exprID, err := store.CreateExpression(1, &models.Expression{Expression: "1+2", Status: models.StatusProcessing, Mode: "float", CreatedAt: created},
+		func(expressionID int) (*database.ExpressionPlan, error) {
+			return &database.ExpressionPlan{
+				Tasks:        []*models.Task{{ID: 1, ExpressionID: expressionID, Operation: "+", Args: []interface{}{1.0, 2.0}}},
+				RootResultID: "root",
+			}, nil
+		})
+	if err != nil {
+		t.Fatalf("не удалось создать выражение: %v", err)
+	}
+
+	expr, err := store.GetExpression(exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if !expr.CreatedAt.Equal(created) || expr.StartedAt != nil || expr.CompletedAt != nil {
+		t.Errorf("новое выражение должно иметь только время создания, получено %v/%v/%v", expr.CreatedAt, expr.StartedAt, expr.CompletedAt)
+	}
+
+	dispatched := created.Add(1500 * time.Millisecond)
+	if err := store.SetTaskDispatched(1, "agent-1", dispatched); err != nil {
+		t.Fatalf("не удалось сохранить время выдачи задачи: %v", err)
+	}
+	for _, at := range []time.Time{dispatched, dispatched.Add(time.Second)} {
+		if err := store.SetExpressionStartedAt(exprID, at); err != nil {
+			t.Fatalf("не удалось сохранить время начала: %v", err)
+		}
+	}
+
+	tasks, err := store.GetUncompletedTasks(exprID)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("ожидалась одна задача, получено %v (%v)", tasks, err)
+	}
+	if tasks[0].DispatchedAt == nil || !tasks[0].DispatchedAt.Equal(dispatched) || tasks[0].FinishedAt != nil {
+		t.Errorf("ожидалось время выдачи %v, получено %v/%v", dispatched, tasks[0].DispatchedAt, tasks[0].FinishedAt)
+	}
+
+	finished := dispatched.Add(250 * time.Millisecond)
+	if err := store.SetTaskFinishedAt(1, finished); err != nil {
+		t.Fatalf("не удалось сохранить время завершения задачи: %v", err)
+	}
+	if err := store.SetExpressionCompletedAt(exprID, finished); err != nil {
+		t.Fatalf("не удалось сохранить время завершения: %v", err)
+	}
+
+	tasks, err = store.GetUncompletedTasks(exprID)
+	if err != nil || len(tasks) != 1 || tasks[0].FinishedAt == nil || !tasks[0].FinishedAt.Equal(finished) {
+		t.Errorf("ожидалось время завершения задачи %v, получено %v (%v)", finished, tasks, err)
+	}
+
+	expr, err = store.GetExpression(exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.StartedAt == nil || !expr.StartedAt.Equal(dispatched) {
+		t.Errorf("время начала должно быть временем первой выдачи %v, получено %v", dispatched, expr.StartedAt)
+	}
+	if expr.CompletedAt == nil || !expr.CompletedAt.Equal(finished) {
+		t.Errorf("ожидалось время завершения %v, получено %v", finished, expr.CompletedAt)
+	}
+}
+
+func testExpressionTasks(t *testing.T, store database.Store) {
+	exprID, err := store.CreateExpression(1, &models.Expression{Expression: "(1+2)*3", Status: models.StatusProcessing, Mode: "float"},
+		func(expressionID int) (*database.ExpressionPlan, error) {
+			return &database.ExpressionPlan{
+				Tasks: []*models.Task{
+					{ID: 1, ExpressionID: expressionID, Operation: "+", Args: []interface{}{1.0, 2.0}},
+					{ID: 2, ExpressionID: expressionID, Operation: "*", Args: []interface{}{"expr_1_task_1", 3.0}},
+				},
+				RootResultID: "root",
+			}, nil
+		})
+	if err != nil {
+		t.Fatalf("не удалось создать выражение: %v", err)
+	}
+
+	dispatched := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.SetTaskDispatched(1, "agent-1", dispatched); err != nil {
+		t.Fatalf("не удалось сохранить выдачу задачи: %v", err)
+	}
+	if err := store.SetTaskResult(1, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	if err := store.SetTaskFinishedAt(1, dispatched.Add(time.Second)); err != nil {
+		t.Fatalf("не удалось сохранить время завершения: %v", err)
+	}
+
+	tasks, err := store.GetExpressionTasks(exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить задачи: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != 1 || tasks[1].ID != 2 {
+		t.Fatalf("ожидались задачи 1 и 2, получено %+v", tasks)
+	}
+
+	first := tasks[0]
+	if !first.Completed || first.Result != 3 || first.AgentID != "agent-1" || first.DispatchedAt == nil || first.FinishedAt == nil {
+		t.Errorf("первая задача должна быть выполнена агентом agent-1 с результатом 3, получено %+v", first)
+	}
+
+	second := tasks[1]
+	if second.Completed || second.AgentID != "" || second.DispatchedAt != nil || second.Operation != "*" {
+		t.Errorf("вторая задача ещё не выдавалась, получено %+v", second)
+	}
+	if len(second.Args) != 2 || second.Args[0] != "expr_1_task_1" || second.Args[1] != 3.0 {
+		t.Errorf("аргументы второй задачи должны сохраниться, получено %v", second.Args)
+	}
+
+	if err := store.SetTaskDispatched(2, "agent-2", dispatched.Add(2*time.Second)); err != nil {
+		t.Fatalf("не удалось сохранить выдачу задачи: %v", err)
+	}
+	if err := store.ClearTaskDispatched(2); err != nil {
+		t.Fatalf("не удалось вернуть задачу в очередь: %v", err)
+	}
+	tasks, err = store.GetExpressionTasks(exprID)
+	if err != nil || len(tasks) != 2 || tasks[1].AgentID != "" || tasks[1].DispatchedAt != nil {
+		t.Errorf("возвращённая в очередь задача не должна числиться выданной, получено %v (%v)", tasks, err)
+	}
+
+	if tasks, err := store.GetExpressionTasks(exprID + 1); err != nil || len(tasks) != 0 {
+		t.Errorf("у неизвестного выражения нет задач, получено %v (%v)", tasks, err)
+	}
+}
@@ -0,0 +1,183 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AgentAuthEnabled reports whether agents have to present a credential: the
+// pre-shared AGENT_TOKEN or a client certificate signed by GRPC_TLS_CA.
+func AgentAuthEnabled(cfg *config.Config) bool {
+	return cfg.AgentToken != "" || (cfg.GRPCTLSCert != "" && cfg.GRPCTLSCA != "")
+}
+
+// ServerOptions configures TLS (mutual when GRPC_TLS_CA is set) and the
+// token check for the agent server.
+func ServerOptions(cfg *config.Config) ([]grpc.ServerOption, error) {
+	// An incomplete TLS configuration is an error rather than a reason to
+	// fall back to plaintext.
+	if (cfg.GRPCTLSCert == "") != (cfg.GRPCTLSKey == "") {
+		return nil, errors.New("GRPC_TLS_CERT and GRPC_TLS_KEY must be set together")
+	}
+	if cfg.GRPCTLSCA != "" && cfg.GRPCTLSCert == "" {
+		return nil, errors.New("GRPC_TLS_CA requires GRPC_TLS_CERT and GRPC_TLS_KEY")
+	}
+
+	var opts []grpc.ServerOption
+
+	if cfg.GRPCTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if cfg.GRPCTLSCA != "" {
+			pool, err := loadCertPool(cfg.GRPCTLSCA)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	if cfg.AgentToken != "" {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(tokenUnaryInterceptor(cfg.AgentToken)),
+			grpc.ChainStreamInterceptor(tokenStreamInterceptor(cfg.AgentToken)),
+		)
+	}
+
+	return opts, nil
+}
+
+// ClientOptions is the agent side of ServerOptions. Without TLS settings the
+// connection is plaintext; the token, if any, is sent with every call.
+func ClientOptions(cfg *config.Config) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	if cfg.GRPCTLSCA != "" || cfg.GRPCTLSCert != "" {
+		tlsConfig := &tls.Config{
+			ServerName: cfg.GRPCTLSServerName,
+			MinVersion: tls.VersionTLS12,
+		}
+		if cfg.GRPCTLSCA != "" {
+			pool, err := loadCertPool(cfg.GRPCTLSCA)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if cfg.GRPCTLSCert != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	if cfg.AgentToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(cfg.AgentToken)))
+	}
+
+	return opts, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// tokenCredentials sends the pre-shared token as a bearer token. It is
+// allowed over plaintext so that the token can be used without TLS inside a
+// private network.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func tokenUnaryInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkToken(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func tokenStreamInterceptor(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkToken(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		presented, found := strings.CutPrefix(value, "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing agent token")
+}
+
+// callerAgentID returns the identity of the calling agent. With mutual TLS
+// it is the common name of the client certificate and a different claimed ID
+// is rejected; otherwise the claimed ID is taken as is.
+func callerAgentID(ctx context.Context, claimed string) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return claimed, nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return claimed, nil
+	}
+
+	name := info.State.VerifiedChains[0][0].Subject.CommonName
+	if claimed != "" && claimed != name {
+		return "", status.Errorf(codes.PermissionDenied, "certificate of agent %q cannot act as %q", name, claimed)
+	}
+	return name, nil
+}
@@ -0,0 +1,212 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	agentgrpc "github.com/neptship/calc-yandex-go/internal/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAgentTokenRequired(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 5000, AgentToken: "secret"}
+	service, addr := startServer(t, cfg)
+
+	if _, err := service.AddExpression(1, "2+3"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	for name, token := range map[string]string{"без токена": "", "с чужим токеном": "guess"} {
+		t.Run(name, func(t *testing.T) {
+			client := dial(t, addr, &config.Config{AgentToken: token}, "")
+
+			if _, _, err := client.FetchTask(context.Background()); status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("ожидался отказ в доступе к задачам, получено: %v", err)
+			}
+
+			stream, err := client.OpenTaskStream(context.Background())
+			if err == nil {
+				stream.Announce(1)
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("ожидался отказ в открытии потока, получено: %v", err)
+			}
+		})
+	}
+
+	client := dial(t, addr, cfg, "")
+	if _, _, err := client.FetchTask(context.Background()); err != nil {
+		t.Fatalf("агент с верным токеном должен получить задачу: %v", err)
+	}
+}
+
+func TestResultAcceptedOnlyFromLeaseHolder(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 5000, AgentToken: "secret"}
+	service, addr := startServer(t, cfg)
+	ctx := context.Background()
+
+	holder := dial(t, addr, cfg, "agent-1")
+	intruder := dial(t, addr, cfg, "agent-2")
+	for _, client := range []*agentgrpc.GRPCClient{holder, intruder} {
+		if _, err := client.Register(ctx); err != nil {
+			t.Fatalf("не удалось зарегистрировать агента: %v", err)
+		}
+	}
+
+	if _, err := service.AddExpression(1, "2+3"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	_, task, err := holder.FetchTask(ctx)
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	err = intruder.SubmitResult(ctx, int(task.TaskId), task.LeaseId, 42, false, "")
+	if err == nil || !strings.Contains(err.Error(), "another agent") {
+		t.Fatalf("результат чужой задачи должен быть отклонён, получено: %v", err)
+	}
+	if _, err := intruder.ExtendLease(ctx, int(task.TaskId), task.LeaseId); err == nil {
+		t.Fatal("агент не должен продлевать чужую аренду")
+	}
+
+	if err := holder.SubmitResult(ctx, int(task.TaskId), task.LeaseId, 5, false, ""); err != nil {
+		t.Fatalf("результат держателя аренды должен быть принят: %v", err)
+	}
+}
+
+func TestClientCertificateNamesAgent(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCA(t, dir)
+	writeCert(t, dir, "server", ca, caKey, "orchestrator", true)
+	writeCert(t, dir, "agent", ca, caKey, "agent-1", false)
+
+	serverCfg := &config.Config{
+		LeaseGraceMs: 5000,
+		GRPCTLSCert:  filepath.Join(dir, "server.pem"),
+		GRPCTLSKey:   filepath.Join(dir, "server-key.pem"),
+		GRPCTLSCA:    filepath.Join(dir, "ca.pem"),
+	}
+	service, addr := startServer(t, serverCfg)
+
+	agentCfg := &config.Config{
+		GRPCTLSCert:       filepath.Join(dir, "agent.pem"),
+		GRPCTLSKey:        filepath.Join(dir, "agent-key.pem"),
+		GRPCTLSCA:         filepath.Join(dir, "ca.pem"),
+		GRPCTLSServerName: "orchestrator",
+	}
+	ctx := context.Background()
+
+	if _, err := dial(t, addr, agentCfg, "agent-1").Register(ctx); err != nil {
+		t.Fatalf("агент с сертификатом должен зарегистрироваться: %v", err)
+	}
+	if agents := service.Agents(); len(agents) != 1 || agents[0].ID != "agent-1" {
+		t.Fatalf("ожидался агент agent-1 из сертификата, получено %v", agents)
+	}
+
+	if _, err := dial(t, addr, agentCfg, "agent-2").Register(ctx); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("агент не должен выдавать себя за другого, получено: %v", err)
+	}
+
+	noCert := &config.Config{GRPCTLSCA: agentCfg.GRPCTLSCA, GRPCTLSServerName: "orchestrator"}
+	if _, err := dial(t, addr, noCert, "agent-1").Register(ctx); err == nil {
+		t.Fatal("агент без сертификата не должен подключаться")
+	}
+}
+
+func TestIncompleteTLSConfigRejected(t *testing.T) {
+	for _, cfg := range []*config.Config{
+		{GRPCTLSCA: "ca.pem"},
+		{GRPCTLSCA: "ca.pem", GRPCTLSCert: "server.pem"},
+		{GRPCTLSKey: "server-key.pem"},
+	} {
+		if _, err := agentgrpc.ServerOptions(cfg); err == nil {
+			t.Errorf("неполная настройка TLS %+v должна отклоняться", cfg)
+		}
+	}
+}
+
+func writeCA(t *testing.T, dir string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("не удалось создать сертификат: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("не удалось разобрать сертификат: %v", err)
+	}
+	return cert, key
+}
+
+func writeCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string, server bool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{commonName}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("не удалось создать сертификат: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("не удалось сохранить ключ: %v", err)
+	}
+
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("не удалось записать %s: %v", path, err)
+	}
+}
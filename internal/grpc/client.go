@@ -2,54 +2,143 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"sync"
+	"time"
 
+	"github.com/neptship/calc-yandex-go/internal/tracing"
 	pb "github.com/neptship/calc-yandex-go/proto"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	ErrTaskCancelled      = errors.New("task cancelled")
+	ErrAgentNotRegistered = errors.New("agent not registered")
 )
 
 type GRPCClient struct {
-	client pb.AgentServiceClient
-	conn   *grpc.ClientConn
+	client   pb.AgentServiceClient
+	conn     *grpc.ClientConn
+	identity AgentIdentity
 }
 
-func NewGRPCClient(address string) (*GRPCClient, error) {
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// AgentIdentity is what an agent reports about itself on Register. Its ID
+// is sent with every call so the orchestrator can tell agents apart.
+type AgentIdentity struct {
+	ID       string
+	Hostname string
+	Version  string
+	Capacity int
+}
+
+// NewGRPCClient connects on behalf of the agent described by identity. opts
+// must include transport credentials; ClientOptions builds them from the
+// configuration.
+func NewGRPCClient(address string, identity AgentIdentity, opts ...grpc.DialOption) (*GRPCClient, error) {
+	conn, err := grpc.Dial(address, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	client := pb.NewAgentServiceClient(conn)
 	return &GRPCClient{
-		client: client,
-		conn:   conn,
+		client:   client,
+		conn:     conn,
+		identity: identity,
 	}, nil
 }
 
+func (c *GRPCClient) AgentID() string {
+	return c.identity.ID
+}
+
 func (c *GRPCClient) Close() {
 	if c.conn != nil {
 		c.conn.Close()
 	}
 }
 
-func (c *GRPCClient) FetchTask(ctx context.Context) (*pb.TaskResponse, error) {
-	resp, err := c.client.GetTask(ctx, &pb.GetTaskRequest{})
+// Register adds the agent to the registry of the orchestrator and returns
+// how often it expects heartbeats.
+func (c *GRPCClient) Register(ctx context.Context) (time.Duration, error) {
+	resp, err := c.client.Register(ctx, &pb.RegisterRequest{
+		AgentId:  c.identity.ID,
+		Hostname: c.identity.Hostname,
+		Version:  c.identity.Version,
+		Capacity: int32(c.identity.Capacity),
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	return resp, nil
+
+	if !resp.Success {
+		return 0, fmt.Errorf("failed to register agent: %s", resp.Message)
+	}
+
+	return time.Duration(resp.HeartbeatIntervalMs) * time.Millisecond, nil
 }
 
-func (c *GRPCClient) SubmitResult(ctx context.Context, taskID int, result float64, isError bool, errorMsg string) error {
-	req := &pb.TaskResultRequest{
+// Heartbeat returns ErrAgentNotRegistered when the orchestrator no longer
+// knows the agent and Register must be called again.
+func (c *GRPCClient) Heartbeat(ctx context.Context) error {
+	resp, err := c.client.Heartbeat(ctx, &pb.HeartbeatRequest{AgentId: c.identity.ID})
+	if err != nil {
+		return err
+	}
+
+	if resp.Reregister {
+		return ErrAgentNotRegistered
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("heartbeat failed: %s", resp.Message)
+	}
+
+	return nil
+}
+
+// FetchTask returns the next task and ctx continuing the trace of its
+// expression, received in the response header.
+func (c *GRPCClient) FetchTask(ctx context.Context) (context.Context, *pb.TaskResponse, error) {
+	var header metadata.MD
+	resp, err := c.client.GetTask(ctx, &pb.GetTaskRequest{AgentId: c.identity.ID}, grpc.Header(&header))
+	if err != nil {
+		return ctx, nil, err
+	}
+	return tracing.ExtractMetadata(ctx, header), resp, nil
+}
+
+func (c *GRPCClient) SubmitResult(ctx context.Context, taskID int, leaseID string, result float64, isError bool, errorMsg string) error {
+	return c.submit(ctx, &pb.TaskResultRequest{
 		TaskId:       int32(taskID),
 		Result:       result,
 		IsError:      isError,
 		ErrorMessage: errorMsg,
-	}
+		LeaseId:      leaseID,
+		AgentId:      c.identity.ID,
+	})
+}
 
-	resp, err := c.client.SubmitTaskResult(ctx, req)
+// SubmitExactResult sends the result of an exact task; the float field is
+// filled with an approximation for logging on the orchestrator side.
+func (c *GRPCClient) SubmitExactResult(ctx context.Context, taskID int, leaseID string, result *big.Rat) error {
+	value, _ := result.Float64()
+	return c.submit(ctx, &pb.TaskResultRequest{
+		TaskId:      int32(taskID),
+		Result:      value,
+		ExactResult: result.String(),
+		LeaseId:     leaseID,
+		AgentId:     c.identity.ID,
+	})
+}
+
+func (c *GRPCClient) submit(ctx context.Context, req *pb.TaskResultRequest) error {
+	md := metadata.MD{}
+	tracing.InjectMetadata(ctx, md)
+	resp, err := c.client.SubmitTaskResult(metadata.NewOutgoingContext(ctx, md), req)
 	if err != nil {
 		return err
 	}
@@ -60,3 +149,94 @@ func (c *GRPCClient) SubmitResult(ctx context.Context, taskID int, result float6
 
 	return nil
 }
+
+func (c *GRPCClient) ExtendLease(ctx context.Context, taskID int, leaseID string) (time.Time, error) {
+	resp, err := c.client.ExtendLease(ctx, &pb.ExtendLeaseRequest{
+		TaskId:  int32(taskID),
+		LeaseId: leaseID,
+		AgentId: c.identity.ID,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if resp.Cancelled {
+		return time.Time{}, ErrTaskCancelled
+	}
+
+	if !resp.Success {
+		return time.Time{}, fmt.Errorf("failed to extend lease: %s", resp.Message)
+	}
+
+	return time.UnixMilli(resp.LeaseExpiresAt), nil
+}
+
+// TaskStream is the agent side of AgentService.TaskStream. Send methods may be
+// called from several goroutines; Recv must be called from one.
+type TaskStream struct {
+	stream  pb.AgentService_TaskStreamClient
+	agentID string
+	sendMu  sync.Mutex
+}
+
+func (c *GRPCClient) OpenTaskStream(ctx context.Context) (*TaskStream, error) {
+	stream, err := c.client.TaskStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskStream{stream: stream, agentID: c.identity.ID}, nil
+}
+
+// Announce tells the orchestrator that count more tasks can be sent.
+func (s *TaskStream) Announce(count int) error {
+	return s.send(&pb.AgentMessage{
+		Payload: &pb.AgentMessage_Slots{Slots: &pb.SlotsAvailable{Count: int32(count), AgentId: s.agentID}},
+	})
+}
+
+// SubmitResult sends the result without waiting for the orchestrator to
+// accept it; the answer arrives later through Recv. The trace of ctx is sent
+// along with the result.
+func (s *TaskStream) SubmitResult(ctx context.Context, taskID int, leaseID string, result float64, isError bool, errorMsg string) error {
+	return s.submit(ctx, &pb.TaskResultRequest{
+		TaskId:       int32(taskID),
+		Result:       result,
+		IsError:      isError,
+		ErrorMessage: errorMsg,
+		LeaseId:      leaseID,
+	})
+}
+
+func (s *TaskStream) SubmitExactResult(ctx context.Context, taskID int, leaseID string, result *big.Rat) error {
+	value, _ := result.Float64()
+	return s.submit(ctx, &pb.TaskResultRequest{
+		TaskId:      int32(taskID),
+		Result:      value,
+		ExactResult: result.String(),
+		LeaseId:     leaseID,
+	})
+}
+
+func (s *TaskStream) submit(ctx context.Context, req *pb.TaskResultRequest) error {
+	req.TraceContext = tracing.Inject(ctx)
+	return s.send(&pb.AgentMessage{
+		Payload: &pb.AgentMessage_Result{Result: req},
+	})
+}
+
+func (s *TaskStream) send(msg *pb.AgentMessage) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.Send(msg)
+}
+
+// Recv returns the next task or the answer to a submitted result.
+func (s *TaskStream) Recv() (*pb.OrchestratorMessage, error) {
+	return s.stream.Recv()
+}
+
+func (s *TaskStream) Close() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.CloseSend()
+}
@@ -0,0 +1,30 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metricsOptions count every request in metrics.GRPCRequests. They run
+// before the token check so rejected requests are counted too.
+func metricsOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(metricsUnaryInterceptor),
+		grpc.ChainStreamInterceptor(metricsStreamInterceptor),
+	}
+}
+
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	metrics.GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	metrics.GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return err
+}
@@ -2,13 +2,22 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net"
+	"time"
 
+	"github.com/neptship/calc-yandex-go/internal/models"
 	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
 	pb "github.com/neptship/calc-yandex-go/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -22,16 +31,35 @@ func NewAgentServer(service *orchestrator.Service) *AgentServer {
 }
 
 func (s *AgentServer) GetTask(ctx context.Context, req *pb.GetTaskRequest) (*pb.TaskResponse, error) {
-	task, err := s.service.GetNextTask()
+	agentID, err := callerAgentID(ctx, req.AgentId)
 	if err != nil {
 		return nil, err
 	}
 
+	task, err := s.service.AssignTask(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The trace of the expression goes back in the response header.
+	header := metadata.MD{}
+	tracing.InjectMetadata(s.service.TaskContext(ctx, task), header)
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		log.Printf("Failed to send trace context of task ID=%d: %v", task.ID, err)
+	}
+
+	return taskResponse(task), nil
+}
+
+func taskResponse(task *models.Task) *pb.TaskResponse {
 	response := &pb.TaskResponse{
-		TaskId:        int32(task.ID),
-		Operation:     task.Operation,
-		OperationTime: int32(task.OperationTime),
-		ExpressionId:  int32(task.ExpressionID),
+		TaskId:         int32(task.ID),
+		Operation:      task.Operation,
+		OperationTime:  int32(task.OperationTime),
+		ExpressionId:   int32(task.ExpressionID),
+		LeaseId:        task.LeaseID,
+		LeaseExpiresAt: task.LeaseExpires,
+		Exact:          task.Exact,
 	}
 
 	switch v := task.Arg1.(type) {
@@ -48,32 +76,147 @@ func (s *AgentServer) GetTask(ctx context.Context, req *pb.GetTaskRequest) (*pb.
 		response.Arg2 = &pb.TaskResponse_StringArg2{StringArg2: v}
 	}
 
-	return response, nil
+	for _, arg := range task.Args {
+		operand := &pb.Operand{}
+		switch v := arg.(type) {
+		case float64:
+			operand.Value = &pb.Operand_Number{Number: v}
+		case string:
+			operand.Value = &pb.Operand_Ref{Ref: v}
+		case *big.Rat:
+			operand.Value = &pb.Operand_Rational{Rational: v.String()}
+		}
+		response.Args = append(response.Args, operand)
+	}
+
+	return response
 }
 
 func (s *AgentServer) SubmitTaskResult(ctx context.Context, req *pb.TaskResultRequest) (*pb.TaskResultResponse, error) {
-	var err error
-	if req.IsError {
-		err = s.service.SetTaskError(int(req.TaskId), req.ErrorMessage)
-	} else {
-		err = s.service.SetTaskResult(int(req.TaskId), req.Result)
+	agentID, err := callerAgentID(ctx, req.AgentId)
+	if err != nil {
+		return nil, err
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.submitResult(tracing.ExtractMetadata(ctx, md), agentID, req), nil
+}
+
+// submitResult accepts the result only from the agent holding the lease.
+// ctx carries the trace of the agent that calculated it.
+func (s *AgentServer) submitResult(ctx context.Context, agentID string, req *pb.TaskResultRequest) *pb.TaskResultResponse {
+	_, span := tracing.Tracer().Start(ctx, "SubmitTaskResult",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("task.id", int(req.TaskId)),
+			attribute.String("agent.id", agentID),
+			attribute.Bool("task.error", req.IsError),
+		))
+	defer span.End()
+
+	err := s.service.CheckLeaseHolder(int(req.TaskId), req.LeaseId, agentID)
+	switch {
+	case err != nil:
+	case req.IsError:
+		err = s.service.SetTaskError(int(req.TaskId), req.LeaseId, req.ErrorMessage)
+	case req.ExactResult != "":
+		var result *big.Rat
+		result, err = calculation.ParseRat(req.ExactResult)
+		if err == nil {
+			err = s.service.SetTaskExactResult(int(req.TaskId), req.LeaseId, result)
+		}
+	default:
+		err = s.service.SetTaskResult(int(req.TaskId), req.LeaseId, req.Result)
 	}
 
 	if err != nil {
+		tracing.RecordError(span, err)
 		return &pb.TaskResultResponse{
 			Success: false,
 			Message: err.Error(),
-		}, nil
+		}
 	}
 
 	return &pb.TaskResultResponse{
 		Success: true,
 		Message: "Task result saved successfully",
+	}
+}
+
+func (s *AgentServer) ExtendLease(ctx context.Context, req *pb.ExtendLeaseRequest) (*pb.ExtendLeaseResponse, error) {
+	agentID, err := callerAgentID(ctx, req.AgentId)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline time.Time
+	err = s.service.CheckLeaseHolder(int(req.TaskId), req.LeaseId, agentID)
+	if err == nil {
+		deadline, err = s.service.ExtendLease(int(req.TaskId), req.LeaseId)
+	}
+	if err != nil {
+		return &pb.ExtendLeaseResponse{
+			Success:   false,
+			Message:   err.Error(),
+			Cancelled: errors.Is(err, orchestrator.ErrExpressionCancelled) || errors.Is(err, orchestrator.ErrExpressionFailed),
+		}, nil
+	}
+
+	return &pb.ExtendLeaseResponse{
+		Success:        true,
+		Message:        "Lease extended",
+		LeaseExpiresAt: deadline.UnixMilli(),
+	}, nil
+}
+
+func (s *AgentServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	agentID, err := callerAgentID(ctx, req.AgentId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.service.RegisterAgent(orchestrator.AgentInfo{
+		ID:       agentID,
+		Hostname: req.Hostname,
+		Version:  req.Version,
+		Capacity: int(req.Capacity),
+	})
+	if err != nil {
+		return &pb.RegisterResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.RegisterResponse{
+		Success:             true,
+		Message:             "Agent registered",
+		HeartbeatIntervalMs: s.service.HeartbeatInterval().Milliseconds(),
+	}, nil
+}
+
+func (s *AgentServer) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	agentID, err := callerAgentID(ctx, req.AgentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.AgentHeartbeat(agentID); err != nil {
+		return &pb.HeartbeatResponse{
+			Success:    false,
+			Message:    err.Error(),
+			Reregister: errors.Is(err, orchestrator.ErrAgentNotRegistered),
+		}, nil
+	}
+
+	return &pb.HeartbeatResponse{
+		Success: true,
+		Message: "Heartbeat received",
 	}, nil
 }
 
-func StartGRPCServer(orchService *orchestrator.Service, lis net.Listener) error {
-	s := grpc.NewServer()
+func StartGRPCServer(orchService *orchestrator.Service, lis net.Listener, opts ...grpc.ServerOption) error {
+	s := grpc.NewServer(append(metricsOptions(), opts...)...)
 
 	pb.RegisterAgentServiceServer(s, NewAgentServer(orchService))
 
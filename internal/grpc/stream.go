@@ -0,0 +1,177 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	pb "github.com/neptship/calc-yandex-go/proto"
+)
+
+// TaskStream pushes tasks to the agent as soon as they become ready, never
+// more than the slots it has announced, and accepts results on the same
+// stream on behalf of the agent named in the announcements. Leases still
+// held by the agent when the stream ends are released, so its tasks go to
+// another agent without waiting for the lease to expire.
+func (s *AgentServer) TaskStream(stream pb.AgentService_TaskStreamServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	var (
+		sendMu  sync.Mutex
+		mu      sync.Mutex
+		free    int
+		agentID string
+		leases  = make(map[int]string)
+	)
+	slots := make(chan struct{}, 1)
+	recvErr := make(chan error, 1)
+
+	send := func(msg *pb.OrchestratorMessage) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(msg)
+	}
+
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for taskID, leaseID := range leases {
+			s.service.ReleaseTask(taskID, leaseID)
+		}
+	}()
+
+	// Tasks of cancelled or failed expressions are withdrawn right away
+	// instead of waiting for the agent to extend their leases.
+	revoked, stopWatching := s.service.WatchRevokedLeases()
+	defer stopWatching()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case r := <-revoked:
+				mu.Lock()
+				held := leases[r.TaskID] == r.LeaseID
+				if held {
+					delete(leases, r.TaskID)
+				}
+				mu.Unlock()
+				if !held {
+					continue
+				}
+
+				err := send(&pb.OrchestratorMessage{
+					Payload: &pb.OrchestratorMessage_Cancel{Cancel: &pb.TaskCancel{
+						TaskId:  int32(r.TaskID),
+						LeaseId: r.LeaseID,
+					}},
+				})
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer cancel()
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+
+			switch payload := msg.Payload.(type) {
+			case *pb.AgentMessage_Slots:
+				caller, err := callerAgentID(ctx, payload.Slots.AgentId)
+				if err != nil {
+					recvErr <- err
+					return
+				}
+
+				mu.Lock()
+				free += int(payload.Slots.Count)
+				if caller != "" {
+					agentID = caller
+				}
+				mu.Unlock()
+
+				select {
+				case slots <- struct{}{}:
+				default:
+				}
+			case *pb.AgentMessage_Result:
+				mu.Lock()
+				caller := agentID
+				if leases[int(payload.Result.TaskId)] == payload.Result.LeaseId {
+					delete(leases, int(payload.Result.TaskId))
+				}
+				mu.Unlock()
+
+				resp := s.submitResult(tracing.Extract(ctx, payload.Result.TraceContext), caller, payload.Result)
+				resp.TaskId = payload.Result.TaskId
+				err := send(&pb.OrchestratorMessage{
+					Payload: &pb.OrchestratorMessage_Result{Result: resp},
+				})
+				if err != nil {
+					recvErr <- err
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		mu.Lock()
+		available, agent := free, agentID
+		mu.Unlock()
+
+		if available <= 0 {
+			select {
+			case <-slots:
+				continue
+			case <-ctx.Done():
+				return streamError(ctx, recvErr)
+			}
+		}
+
+		task, err := s.service.WaitForTask(ctx, agent)
+		if err != nil {
+			return streamError(ctx, recvErr)
+		}
+
+		mu.Lock()
+		free--
+		leases[task.ID] = task.LeaseID
+		mu.Unlock()
+
+		// The stream has no per-task metadata, so the trace travels in the
+		// message.
+		response := taskResponse(task)
+		response.TraceContext = tracing.Inject(s.service.TaskContext(ctx, task))
+		err = send(&pb.OrchestratorMessage{
+			Payload: &pb.OrchestratorMessage_Task{Task: response},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamError reports why the stream ended; an agent closing its side is
+// not an error.
+func streamError(ctx context.Context, recvErr <-chan error) error {
+	select {
+	case err := <-recvErr:
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	default:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,207 @@
+package grpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+	agentgrpc "github.com/neptship/calc-yandex-go/internal/grpc"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	pb "github.com/neptship/calc-yandex-go/proto"
+	"google.golang.org/grpc"
+)
+
+func startAgentServer(t *testing.T) (*orchestrator.Service, *agentgrpc.GRPCClient) {
+	t.Helper()
+
+	cfg := &config.Config{LeaseGraceMs: 5000, AgentToken: "secret"}
+	service, addr := startServer(t, cfg)
+	return service, dial(t, addr, cfg, "")
+}
+
+func startServer(t *testing.T, cfg *config.Config) (*orchestrator.Service, string) {
+	t.Helper()
+
+	service, err := orchestrator.NewService(cfg, memory.New())
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	opts, err := agentgrpc.ServerOptions(cfg)
+	if err != nil {
+		t.Fatalf("не удалось настроить сервер: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("не удалось открыть порт: %v", err)
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterAgentServiceServer(server, agentgrpc.NewAgentServer(service))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return service, lis.Addr().String()
+}
+
+func dial(t *testing.T, addr string, cfg *config.Config, agentID string) *agentgrpc.GRPCClient {
+	t.Helper()
+
+	opts, err := agentgrpc.ClientOptions(cfg)
+	if err != nil {
+		t.Fatalf("не удалось настроить клиента: %v", err)
+	}
+
+	client, err := agentgrpc.NewGRPCClient(addr, agentgrpc.AgentIdentity{ID: agentID, Capacity: 1}, opts...)
+	if err != nil {
+		t.Fatalf("не удалось подключиться к серверу: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+func receiveTask(t *testing.T, stream *agentgrpc.TaskStream) *pb.TaskResponse {
+	t.Helper()
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("поток задач прервался: %v", err)
+		}
+		if result := msg.GetResult(); result != nil && !result.Success {
+			t.Fatalf("результат задачи ID=%d отклонён: %s", result.TaskId, result.Message)
+		}
+		if task := msg.GetTask(); task != nil {
+			return task
+		}
+	}
+}
+
+func TestTaskStreamPushesReadyTasks(t *testing.T) {
+	service, client := startAgentServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.OpenTaskStream(ctx)
+	if err != nil {
+		t.Fatalf("не удалось открыть поток задач: %v", err)
+	}
+	if err := stream.Announce(1); err != nil {
+		t.Fatalf("не удалось объявить слоты: %v", err)
+	}
+
+	exprID, err := service.AddExpression(1, "2+3*4")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	first := receiveTask(t, stream)
+	if first.Operation != "*" {
+		t.Fatalf("первой должна прийти задача '*', получено '%s'", first.Operation)
+	}
+	if err := stream.SubmitResult(ctx, int(first.TaskId), first.LeaseId, 12, false, ""); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+	if err := stream.Announce(1); err != nil {
+		t.Fatalf("не удалось объявить слоты: %v", err)
+	}
+
+	second := receiveTask(t, stream)
+	if second.Operation != "+" {
+		t.Fatalf("второй должна прийти задача '+', получено '%s'", second.Operation)
+	}
+	if err := stream.SubmitResult(ctx, int(second.TaskId), second.LeaseId, 14, false, ""); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		expr, err := service.GetExpressionByID(1, exprID)
+		if err != nil {
+			t.Fatalf("не удалось получить выражение: %v", err)
+		}
+		if expr.Status == models.StatusCompleted {
+			if *expr.Result != 14 {
+				t.Fatalf("ожидался результат 14, получено %v", *expr.Result)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("выражение не завершилось после отправки результатов через поток")
+}
+
+func TestTaskStreamReleasesLeasesOnDisconnect(t *testing.T) {
+	service, client := startAgentServer(t)
+
+	if _, err := service.AddExpression(1, "2+3"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.OpenTaskStream(ctx)
+	if err != nil {
+		t.Fatalf("не удалось открыть поток задач: %v", err)
+	}
+	if err := stream.Announce(2); err != nil {
+		t.Fatalf("не удалось объявить слоты: %v", err)
+	}
+	taken := receiveTask(t, stream)
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if task, err := service.GetNextTask(); err == nil {
+			if task.ID != int(taken.TaskId) || task.LeaseID == taken.LeaseId {
+				t.Fatalf("ожидалась та же задача с новой арендой, получено ID=%d аренда=%s", task.ID, task.LeaseID)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("задача отключившегося агента не вернулась в очередь")
+}
+
+func TestTaskStreamWithdrawsTasksOfCancelledExpression(t *testing.T) {
+	service, client := startAgentServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.OpenTaskStream(ctx)
+	if err != nil {
+		t.Fatalf("не удалось открыть поток задач: %v", err)
+	}
+	if err := stream.Announce(1); err != nil {
+		t.Fatalf("не удалось объявить слоты: %v", err)
+	}
+
+	exprID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	task := receiveTask(t, stream)
+
+	if _, err := service.CancelExpression(1, exprID); err != nil {
+		t.Fatalf("не удалось отменить выражение: %v", err)
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("поток задач прервался: %v", err)
+	}
+	withdrawn := msg.GetCancel()
+	if withdrawn == nil {
+		t.Fatalf("ожидалась отмена задачи, получено %v", msg)
+	}
+	if withdrawn.TaskId != task.TaskId || withdrawn.LeaseId != task.LeaseId {
+		t.Fatalf("отменена задача ID=%d с арендой %s, ожидалась ID=%d с арендой %s",
+			withdrawn.TaskId, withdrawn.LeaseId, task.TaskId, task.LeaseId)
+	}
+}
@@ -0,0 +1,123 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+// waitForSpan returns the first ended span with the given name.
+func waitForSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("span %q не записан", name)
+	return nil
+}
+
+func TestTraceFollowsTaskThroughGetTask(t *testing.T) {
+	recorder := recordSpans(t)
+	service, client := startAgentServer(t)
+
+	ctx, root := tracing.Tracer().Start(context.Background(), "request")
+	if _, err := service.AddExpressionWithOptions(ctx, 1, "2+3", orchestrator.ExpressionOptions{}); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	root.End()
+	traceID := root.SpanContext().TraceID()
+
+	for _, name := range []string{"parse expression", "create tasks"} {
+		span := waitForSpan(t, recorder, name)
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Fatalf("span %q должен быть дочерним для запроса", name)
+		}
+	}
+
+	taskCtx, task, err := client.FetchTask(context.Background())
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if got := trace.SpanContextFromContext(taskCtx).TraceID(); got != traceID {
+		t.Fatalf("задача должна продолжать трассу %s, получено %s", traceID, got)
+	}
+
+	execCtx, execute := tracing.Tracer().Start(taskCtx, "execute")
+	if err := client.SubmitResult(execCtx, int(task.TaskId), task.LeaseId, 5, false, ""); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+	execute.End()
+
+	submit := waitForSpan(t, recorder, "SubmitTaskResult")
+	if submit.SpanContext().TraceID() != traceID {
+		t.Fatalf("приём результата должен быть в трассе %s, получено %s", traceID, submit.SpanContext().TraceID())
+	}
+	if submit.Parent().SpanID() != execute.SpanContext().SpanID() {
+		t.Fatal("приём результата должен быть дочерним для выполнения задачи на агенте")
+	}
+}
+
+func TestTraceFollowsTaskThroughStream(t *testing.T) {
+	recorder := recordSpans(t)
+	service, client := startAgentServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.OpenTaskStream(ctx)
+	if err != nil {
+		t.Fatalf("не удалось открыть поток задач: %v", err)
+	}
+	if err := stream.Announce(1); err != nil {
+		t.Fatalf("не удалось объявить слоты: %v", err)
+	}
+
+	requestCtx, root := tracing.Tracer().Start(ctx, "request")
+	if _, err := service.AddExpressionWithOptions(requestCtx, 1, "2+3", orchestrator.ExpressionOptions{}); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	root.End()
+	traceID := root.SpanContext().TraceID()
+
+	task := receiveTask(t, stream)
+	taskCtx := tracing.Extract(ctx, task.TraceContext)
+	if got := trace.SpanContextFromContext(taskCtx).TraceID(); got != traceID {
+		t.Fatalf("задача должна продолжать трассу %s, получено %s", traceID, got)
+	}
+
+	execCtx, execute := tracing.Tracer().Start(taskCtx, "execute")
+	if err := stream.SubmitResult(execCtx, int(task.TaskId), task.LeaseId, 5, false, ""); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+	execute.End()
+
+	submit := waitForSpan(t, recorder, "SubmitTaskResult")
+	if submit.Parent().SpanID() != execute.SpanContext().SpanID() || submit.SpanContext().TraceID() != traceID {
+		t.Fatal("приём результата должен быть дочерним для выполнения задачи на агенте")
+	}
+}
@@ -0,0 +1,88 @@
+// Package metrics defines the Prometheus metrics of the orchestrator and the
+// agent. Metrics are registered by the binary that serves them, so each one
+// only exposes its own.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "calc"
+
+// Orchestrator metrics. The task queue and expression counts are collected
+// from the scheduler on every scrape, see orchestrator.Service.Collector.
+var (
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Time from handing a task to an agent until its result or error came back, by operation.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 1.5, 2, 3, 5, 10, 30},
+	}, []string{"operation"})
+
+	GRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "gRPC requests handled by the orchestrator, by method and status code.",
+	}, []string{"method", "code"})
+
+	DatabaseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_errors_total",
+		Help:      "Failed storage operations, by store method.",
+	}, []string{"method"})
+)
+
+// Agent metrics.
+var (
+	AgentBusyWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "busy_workers",
+		Help:      "Workers currently calculating a task.",
+	})
+
+	AgentTasksCompleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "tasks_completed_total",
+		Help:      "Tasks whose result or calculation error was delivered to the orchestrator.",
+	})
+
+	AgentFetchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "fetch_errors_total",
+		Help:      "Failed attempts to get tasks: GetTask errors and broken task streams.",
+	})
+
+	AgentSubmitErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "submit_errors_total",
+		Help:      "Results that could not be sent to the orchestrator.",
+	})
+)
+
+// OrchestratorCollectors are the metrics the orchestrator updates itself.
+func OrchestratorCollectors() []prometheus.Collector {
+	return []prometheus.Collector{TaskDuration, GRPCRequests, DatabaseErrors}
+}
+
+// AgentCollectors are the metrics of an agent.
+func AgentCollectors() []prometheus.Collector {
+	return []prometheus.Collector{AgentBusyWorkers, AgentTasksCompleted, AgentFetchErrors, AgentSubmitErrors}
+}
+
+// Handler serves the given collectors along with the Go runtime and process
+// metrics in the Prometheus text format.
+func Handler(cs ...prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	registry.MustRegister(cs...)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
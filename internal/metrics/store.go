@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// CountingStore counts the errors of a store in DatabaseErrors. Missing
+// records and duplicates are answers rather than failures and are not
+// counted.
+type CountingStore struct {
+	store database.Store
+}
+
+var _ database.Store = (*CountingStore)(nil)
+
+func NewCountingStore(store database.Store) *CountingStore {
+	return &CountingStore{store: store}
+}
+
+func (s *CountingStore) count(method string, err error) error {
+	if err != nil && !errors.Is(err, database.ErrNotFound) && !errors.Is(err, database.ErrDuplicate) {
+		DatabaseErrors.WithLabelValues(method).Inc()
+	}
+	return err
+}
+
+func (s *CountingStore) CreateUser(login, passwordHash string) error {
+	return s.count("CreateUser", s.store.CreateUser(login, passwordHash))
+}
+
+func (s *CountingStore) CheckUserExists(login string) (bool, error) {
+	exists, err := s.store.CheckUserExists(login)
+	return exists, s.count("CheckUserExists", err)
+}
+
+func (s *CountingStore) GetUserByLogin(login string) (int, string, error) {
+	id, passwordHash, err := s.store.GetUserByLogin(login)
+	return id, passwordHash, s.count("GetUserByLogin", err)
+}
+
+func (s *CountingStore) GetUserLogin(id int) (string, error) {
+	login, err := s.store.GetUserLogin(id)
+	return login, s.count("GetUserLogin", err)
+}
+
+func (s *CountingStore) CreateSession(session *models.Session) error {
+	return s.count("CreateSession", s.store.CreateSession(session))
+}
+
+func (s *CountingStore) GetSession(id string) (*models.Session, error) {
+	session, err := s.store.GetSession(id)
+	return session, s.count("GetSession", err)
+}
+
+func (s *CountingStore) GetSessionByTokenHash(tokenHash string) (*models.Session, error) {
+	session, err := s.store.GetSessionByTokenHash(tokenHash)
+	return session, s.count("GetSessionByTokenHash", err)
+}
+
+func (s *CountingStore) GetUserSessions(userID int) ([]*models.Session, error) {
+	sessions, err := s.store.GetUserSessions(userID)
+	return sessions, s.count("GetUserSessions", err)
+}
+
+func (s *CountingStore) RotateSession(id, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	rotated, err := s.store.RotateSession(id, oldHash, newHash, usedAt, expiresAt)
+	return rotated, s.count("RotateSession", err)
+}
+
+func (s *CountingStore) RevokeSession(userID int, id string, revokedAt time.Time) (bool, error) {
+	revoked, err := s.store.RevokeSession(userID, id, revokedAt)
+	return revoked, s.count("RevokeSession", err)
+}
+
+func (s *CountingStore) SaveExpression(userID int, expr *models.Expression) (int, error) {
+	id, err := s.store.SaveExpression(userID, expr)
+	return id, s.count("SaveExpression", err)
+}
+
+func (s *CountingStore) CreateExpression(userID int, expr *models.Expression, plan func(expressionID int) (*database.ExpressionPlan, error)) (int, error) {
+	id, err := s.store.CreateExpression(userID, expr, plan)
+	return id, s.count("CreateExpression", err)
+}
+
+func (s *CountingStore) GetExpression(id int) (*models.Expression, error) {
+	expr, err := s.store.GetExpression(id)
+	return expr, s.count("GetExpression", err)
+}
+
+func (s *CountingStore) GetUserExpressions(userID int) ([]*models.Expression, error) {
+	expressions, err := s.store.GetUserExpressions(userID)
+	return expressions, s.count("GetUserExpressions", err)
+}
+
+func (s *CountingStore) ListExpressions(query database.ExpressionQuery) ([]*models.Expression, int, error) {
+	expressions, total, err := s.store.ListExpressions(query)
+	return expressions, total, s.count("ListExpressions", err)
+}
+
+func (s *CountingStore) CountExpressionsByStatus() (map[models.ExpressionStatus]int, error) {
+	counts, err := s.store.CountExpressionsByStatus()
+	return counts, s.count("CountExpressionsByStatus", err)
+}
+
+func (s *CountingStore) GetUnfinishedExpressions() ([]*models.Expression, error) {
+	expressions, err := s.store.GetUnfinishedExpressions()
+	return expressions, s.count("GetUnfinishedExpressions", err)
+}
+
+func (s *CountingStore) UpdateExpressionStatus(id int, status models.ExpressionStatus) error {
+	return s.count("UpdateExpressionStatus", s.store.UpdateExpressionStatus(id, status))
+}
+
+func (s *CountingStore) StartExpression(id int) error {
+	return s.count("StartExpression", s.store.StartExpression(id))
+}
+
+func (s *CountingStore) SetExpressionResult(id int, result float64) error {
+	return s.count("SetExpressionResult", s.store.SetExpressionResult(id, result))
+}
+
+func (s *CountingStore) SetExpressionExactResult(id int, result *big.Rat) error {
+	return s.count("SetExpressionExactResult", s.store.SetExpressionExactResult(id, result))
+}
+
+func (s *CountingStore) FailExpression(id int, reason string) error {
+	return s.count("FailExpression", s.store.FailExpression(id, reason))
+}
+
+func (s *CountingStore) SetExpressionStartedAt(id int, at time.Time) error {
+	return s.count("SetExpressionStartedAt", s.store.SetExpressionStartedAt(id, at))
+}
+
+func (s *CountingStore) SetExpressionCompletedAt(id int, at time.Time) error {
+	return s.count("SetExpressionCompletedAt", s.store.SetExpressionCompletedAt(id, at))
+}
+
+func (s *CountingStore) SaveTask(task *models.Task) (int, error) {
+	id, err := s.store.SaveTask(task)
+	return id, s.count("SaveTask", err)
+}
+
+func (s *CountingStore) GetUncompletedTasks(expressionID int) ([]*models.Task, error) {
+	tasks, err := s.store.GetUncompletedTasks(expressionID)
+	return tasks, s.count("GetUncompletedTasks", err)
+}
+
+func (s *CountingStore) GetTaskResults(expressionID int) ([]*models.TaskResult, error) {
+	results, err := s.store.GetTaskResults(expressionID)
+	return results, s.count("GetTaskResults", err)
+}
+
+func (s *CountingStore) GetMaxTaskID() (int, error) {
+	id, err := s.store.GetMaxTaskID()
+	return id, s.count("GetMaxTaskID", err)
+}
+
+func (s *CountingStore) SetTaskResult(taskID int, result float64) error {
+	return s.count("SetTaskResult", s.store.SetTaskResult(taskID, result))
+}
+
+func (s *CountingStore) SetTaskExactResult(taskID int, result *big.Rat) error {
+	return s.count("SetTaskExactResult", s.store.SetTaskExactResult(taskID, result))
+}
+
+func (s *CountingStore) SaveResult(resultID string, expressionID int, taskID *int, value float64, completed bool) error {
+	return s.count("SaveResult", s.store.SaveResult(resultID, expressionID, taskID, value, completed))
+}
+
+func (s *CountingStore) GetResult(resultID string) (float64, bool, error) {
+	value, completed, err := s.store.GetResult(resultID)
+	return value, completed, s.count("GetResult", err)
+}
+
+func (s *CountingStore) GetExpressionTasks(expressionID int) ([]*models.TaskRecord, error) {
+	tasks, err := s.store.GetExpressionTasks(expressionID)
+	return tasks, s.count("GetExpressionTasks", err)
+}
+
+func (s *CountingStore) SetTaskDispatched(taskID int, agentID string, at time.Time) error {
+	return s.count("SetTaskDispatched", s.store.SetTaskDispatched(taskID, agentID, at))
+}
+
+func (s *CountingStore) ClearTaskDispatched(taskID int) error {
+	return s.count("ClearTaskDispatched", s.store.ClearTaskDispatched(taskID))
+}
+
+func (s *CountingStore) SetTaskFinishedAt(taskID int, at time.Time) error {
+	return s.count("SetTaskFinishedAt", s.store.SetTaskFinishedAt(taskID, at))
+}
@@ -0,0 +1,45 @@
+package metrics_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type brokenStore struct {
+	*memory.Store
+}
+
+func (s brokenStore) SetExpressionResult(id int, result float64) error {
+	return errors.New("disk I/O error")
+}
+
+func TestCountingStoreCountsFailures(t *testing.T) {
+	store := metrics.NewCountingStore(brokenStore{memory.New()})
+
+	if _, err := store.GetExpression(1); err == nil {
+		t.Fatal("несуществующее выражение должно давать ошибку")
+	}
+	if err := store.CreateUser("user", "hash"); err != nil {
+		t.Fatalf("не удалось создать пользователя: %v", err)
+	}
+	if err := store.CreateUser("user", "hash"); err == nil {
+		t.Fatal("повторная регистрация должна давать ошибку")
+	}
+	if err := store.SetExpressionResult(1, 2); err == nil {
+		t.Fatal("ошибка хранилища должна возвращаться")
+	}
+	if _, err := store.SaveExpression(1, &models.Expression{Expression: "1+1", Status: models.StatusPending}); err != nil {
+		t.Fatalf("не удалось сохранить выражение: %v", err)
+	}
+
+	for method, want := range map[string]float64{"GetExpression": 0, "CreateUser": 0, "SetExpressionResult": 1, "SaveExpression": 0} {
+		if got := testutil.ToFloat64(metrics.DatabaseErrors.WithLabelValues(method)); got != want {
+			t.Errorf("для %s ожидалось ошибок: %v, получено %v", method, want, got)
+		}
+	}
+}
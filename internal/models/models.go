@@ -1,5 +1,10 @@
 package models
 
+import (
+	"math/big"
+	"time"
+)
+
 type ExpressionStatus string
 
 const (
@@ -7,27 +12,67 @@ const (
 	StatusProcessing ExpressionStatus = "processing"
 	StatusCompleted  ExpressionStatus = "completed"
 	StatusFailed     ExpressionStatus = "failed"
+	StatusCancelled  ExpressionStatus = "cancelled"
 )
 
 type Expression struct {
-	ID         int              `json:"id"`
-	Expression string           `json:"expression"`
-	Status     ExpressionStatus `json:"status"`
-	Result     *float64         `json:"result,omitempty"`
+	ID          int               `json:"id"`
+	Expression  string            `json:"expression"`
+	Status      ExpressionStatus  `json:"status"`
+	Result      *float64          `json:"result,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	Precision   int               `json:"precision,omitempty"`
+	ExactResult *big.Rat          `json:"exact_result,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	UserID      int               `json:"-"`
 }
 
 type Task struct {
-	ID            int         `json:"id"`
-	Arg1          interface{} `json:"arg1"`
-	Arg2          interface{} `json:"arg2"`
-	Operation     string      `json:"operation"`
-	OperationTime int         `json:"operation_time"`
-	ExpressionID  int         `json:"-"`
+	ID            int           `json:"id"`
+	Arg1          interface{}   `json:"arg1"`
+	Arg2          interface{}   `json:"arg2"`
+	Args          []interface{} `json:"args"`
+	Operation     string        `json:"operation"`
+	OperationTime int           `json:"operation_time"`
+	Exact         bool          `json:"exact,omitempty"`
+	LeaseID       string        `json:"lease_id,omitempty"`
+	LeaseExpires  int64         `json:"lease_expires_at,omitempty"`
+	AgentID       string        `json:"agent_id,omitempty"`
+	DispatchedAt  *time.Time    `json:"dispatched_at,omitempty"`
+	FinishedAt    *time.Time    `json:"finished_at,omitempty"`
+	ExpressionID  int           `json:"-"`
+}
+
+// TaskRecord is a stored task with its outcome. A task that failed has
+// FinishedAt set but is not Completed.
+type TaskRecord struct {
+	Task
+	Completed   bool
+	Result      float64
+	ExactResult *big.Rat
 }
 
 type TaskResult struct {
-	ID     int     `json:"id"`
-	Result float64 `json:"result"`
+	ID          int      `json:"id"`
+	Result      float64  `json:"result"`
+	ExactResult *big.Rat `json:"exact_result,omitempty"`
+}
+
+// Session is one login of a user. Only a hash of its refresh token is
+// stored; RevokedAt is nil while the session is active.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	TokenHash  string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
 }
 
 type Response struct {
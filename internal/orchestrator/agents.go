@@ -0,0 +1,194 @@
+package orchestrator
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidAgent       = errors.New("invalid agent")
+	ErrAgentNotRegistered = errors.New("agent not registered")
+)
+
+// throughputWindow is the period over which TasksPerMinute is measured.
+const throughputWindow = time.Minute
+
+// AgentInfo describes a registered agent. Tasks, CompletedTasks, FailedTasks
+// and TasksPerMinute are filled in by Agents.
+type AgentInfo struct {
+	ID             string    `json:"id"`
+	Hostname       string    `json:"hostname"`
+	Version        string    `json:"version"`
+	Capacity       int       `json:"capacity"`
+	RegisteredAt   time.Time `json:"registered_at"`
+	LastSeen       time.Time `json:"last_seen"`
+	Tasks          []int     `json:"tasks"`
+	CompletedTasks int       `json:"completed_tasks"`
+	FailedTasks    int       `json:"failed_tasks"`
+	TasksPerMinute int       `json:"tasks_per_minute"`
+}
+
+type registeredAgent struct {
+	info     AgentInfo
+	finished []time.Time
+}
+
+// RegisterAgent adds the agent to the registry or, if it is already there,
+// updates its description and keeps its statistics.
+func (s *Service) RegisterAgent(info AgentInfo) error {
+	if info.ID == "" || info.Capacity <= 0 {
+		return ErrInvalidAgent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if agent, exists := s.agents[info.ID]; exists {
+		agent.info.Hostname = info.Hostname
+		agent.info.Version = info.Version
+		agent.info.Capacity = info.Capacity
+		agent.info.LastSeen = now
+		return nil
+	}
+
+	s.agents[info.ID] = &registeredAgent{
+		info: AgentInfo{
+			ID:           info.ID,
+			Hostname:     info.Hostname,
+			Version:      info.Version,
+			Capacity:     info.Capacity,
+			RegisteredAt: now,
+			LastSeen:     now,
+		},
+	}
+	log.Printf("Agent %s registered from %s (version %s, %d workers)", info.ID, info.Hostname, info.Version, info.Capacity)
+	return nil
+}
+
+func (s *Service) AgentHeartbeat(agentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agent, exists := s.agents[agentID]
+	if !exists {
+		return ErrAgentNotRegistered
+	}
+	agent.info.LastSeen = time.Now()
+	return nil
+}
+
+// HeartbeatInterval is how often agents should call AgentHeartbeat so that a
+// single lost heartbeat does not expire them.
+func (s *Service) HeartbeatInterval() time.Duration {
+	return time.Duration(s.config.AgentTimeoutMs/3) * time.Millisecond
+}
+
+// Agents lists registered agents ordered by ID with the tasks they hold.
+func (s *Service) Agents() []AgentInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	agents := make([]AgentInfo, 0, len(s.agents))
+	for _, agent := range s.agents {
+		agent.pruneFinished(now)
+
+		info := agent.info
+		info.Tasks = []int{}
+		info.TasksPerMinute = len(agent.finished)
+		agents = append(agents, info)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	index := make(map[string]int, len(agents))
+	for i, info := range agents {
+		index[info.ID] = i
+	}
+	for taskID, l := range s.leases {
+		if i, exists := index[l.AgentID]; exists {
+			agents[i].Tasks = append(agents[i].Tasks, taskID)
+		}
+	}
+	for i := range agents {
+		sort.Ints(agents[i].Tasks)
+	}
+
+	return agents
+}
+
+func (a *registeredAgent) pruneFinished(now time.Time) {
+	cutoff := now.Add(-throughputWindow)
+	i := 0
+	for i < len(a.finished) && a.finished[i].Before(cutoff) {
+		i++
+	}
+	a.finished = a.finished[i:]
+}
+
+// registeredAgentID must be called with s.mu held. Leases are only attributed
+// to agents the registry knows, so that expiring an agent releases them.
+func (s *Service) registeredAgentID(agentID string) string {
+	if _, exists := s.agents[agentID]; exists {
+		return agentID
+	}
+	return ""
+}
+
+// finishLease must be called with s.mu held once the task holding the lease
+// has reported a result or an error.
+func (s *Service) finishLease(taskID int, failed bool) {
+	l, exists := s.leases[taskID]
+	if !exists {
+		return
+	}
+	delete(s.leases, taskID)
+
+	agent, exists := s.agents[l.AgentID]
+	if !exists {
+		return
+	}
+	if failed {
+		agent.info.FailedTasks++
+	} else {
+		agent.info.CompletedTasks++
+	}
+
+	now := time.Now()
+	agent.finished = append(agent.finished, now)
+	agent.pruneFinished(now)
+}
+
+// expireAgents removes agents that have not sent a heartbeat within
+// AgentTimeoutMs and returns their tasks to the queue.
+func (s *Service) expireAgents(now time.Time) {
+	if s.config.AgentTimeoutMs <= 0 {
+		return
+	}
+	timeout := time.Duration(s.config.AgentTimeoutMs) * time.Millisecond
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for agentID, agent := range s.agents {
+		if now.Sub(agent.info.LastSeen) < timeout {
+			continue
+		}
+		delete(s.agents, agentID)
+
+		released := 0
+		for taskID, l := range s.leases {
+			if l.AgentID != agentID {
+				continue
+			}
+			delete(s.leases, taskID)
+			if task, exists := s.tasks[taskID]; exists {
+				s.requeueTask(task)
+				released++
+			}
+		}
+		log.Printf("Agent %s expired after %v without heartbeat, %d tasks returned to queue", agentID, timeout, released)
+	}
+}
@@ -0,0 +1,213 @@
+package orchestrator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// Event types pushed to /api/v1/expressions/stream.
+const (
+	EventExpression = "expression"
+	EventTask       = "task"
+)
+
+const (
+	eventHistorySize     = 1024
+	subscriberBufferSize = 64
+)
+
+// Event is a status transition of an expression or the completion of one of
+// its tasks. IDs grow monotonically and are sent as SSE ids so a client can
+// resume with Last-Event-ID.
+type Event struct {
+	ID             int64    `json:"id"`
+	Type           string   `json:"type"`
+	ExpressionID   int      `json:"expression_id"`
+	Status         string   `json:"status,omitempty"`
+	Result         *float64 `json:"result,omitempty"`
+	Fraction       string   `json:"fraction,omitempty"`
+	Error          string   `json:"error,omitempty"`
+	TaskID         int      `json:"task_id,omitempty"`
+	Operation      string   `json:"operation,omitempty"`
+	CompletedTasks int      `json:"completed_tasks,omitempty"`
+	TotalTasks     int      `json:"total_tasks,omitempty"`
+
+	userID int
+}
+
+// EventHub fans events out to the subscribers of each user and keeps a short
+// history for reconnecting clients. A subscriber that cannot keep up is
+// disconnected rather than slowing down the scheduler; it can resume from the
+// last event it received.
+type EventHub struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []Event
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	userID int
+	events chan Event
+}
+
+// Subscription is the state of a client right after subscribing. Backlog
+// holds the events published after the Last-Event-ID the client sent.
+// Complete is false when that ID is older than the kept history (or the
+// client sent none), in which case the caller should send a snapshot;
+// Position is the ID of the latest event at the time of subscribing.
+type Subscription struct {
+	Backlog  []Event
+	Complete bool
+	Position int64
+	Events   <-chan Event
+
+	hub *EventHub
+	sub *subscriber
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		// IDs of a new process start above those of the previous one, so a
+		// client reconnecting after a restart gets a snapshot instead of
+		// silently missing what happened in between.
+		nextID:      time.Now().UnixMilli() * 1000,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+func (h *EventHub) Publish(userID int, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	event.ID = h.nextID
+	event.userID = userID
+
+	h.history = append(h.history, event)
+	if len(h.history) > eventHistorySize {
+		h.history = append(h.history[:0], h.history[len(h.history)-eventHistorySize:]...)
+	}
+
+	for sub := range h.subscribers {
+		if sub.userID != userID {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe starts delivering the events of userID. The Events channel is
+// closed by Close or when the subscriber falls behind.
+func (h *EventHub) Subscribe(userID int, lastEventID int64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	oldest := h.nextID + 1
+	if len(h.history) > 0 {
+		oldest = h.history[0].ID
+	}
+
+	sub := &subscriber{
+		userID: userID,
+		events: make(chan Event, subscriberBufferSize),
+	}
+	h.subscribers[sub] = struct{}{}
+
+	subscription := &Subscription{
+		Complete: lastEventID > 0 && lastEventID >= oldest-1,
+		Position: h.nextID,
+		Events:   sub.events,
+		hub:      h,
+		sub:      sub,
+	}
+
+	if subscription.Complete {
+		for _, event := range h.history {
+			if event.ID > lastEventID && event.userID == userID {
+				subscription.Backlog = append(subscription.Backlog, event)
+			}
+		}
+	}
+
+	return subscription
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, exists := s.hub.subscribers[s.sub]; exists {
+		delete(s.hub.subscribers, s.sub)
+		close(s.sub.events)
+	}
+}
+
+// Events returns the hub that streams status changes to clients.
+func (s *Service) Events() *EventHub {
+	return s.events
+}
+
+func expressionEvent(expr *models.Expression) Event {
+	event := Event{
+		Type:         EventExpression,
+		ExpressionID: expr.ID,
+		Status:       string(expr.Status),
+		Error:        expr.Error,
+	}
+	if expr.Status == models.StatusCompleted {
+		event.Result = expr.Result
+		if expr.ExactResult != nil {
+			event.Fraction = expr.ExactResult.String()
+		}
+	}
+	return event
+}
+
+// publishExpression must be called with s.mu held.
+func (s *Service) publishExpression(expr *models.Expression) {
+	s.events.Publish(expr.UserID, expressionEvent(expr))
+}
+
+// publishTask must be called with s.mu held, after the task's result (or
+// failure) has been recorded so the progress counts include it.
+func (s *Service) publishTask(task *models.Task, status models.ExpressionStatus) {
+	expr, err := s.loadExpression(task.ExpressionID)
+	if err != nil {
+		return
+	}
+
+	completed, total := s.taskProgress(task.ExpressionID)
+	s.events.Publish(expr.UserID, Event{
+		Type:           EventTask,
+		ExpressionID:   task.ExpressionID,
+		Status:         string(status),
+		TaskID:         task.ID,
+		Operation:      task.Operation,
+		CompletedTasks: completed,
+		TotalTasks:     total,
+	})
+}
+
+// taskProgress must be called with s.mu held.
+func (s *Service) taskProgress(expressionID int) (completed, total int) {
+	for _, task := range s.tasks {
+		if task.ExpressionID != expressionID {
+			continue
+		}
+
+		total++
+		if result, exists := s.results[getResultID(expressionID, task.ID)]; exists && result.Completed {
+			completed++
+		}
+	}
+	return completed, total
+}
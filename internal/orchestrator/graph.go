@@ -0,0 +1,246 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+)
+
+// TaskGraph is the DAG an expression was split into. Operands that come
+// from other tasks name them, which gives the edges of the graph; the root
+// task produces the result of the expression.
+type TaskGraph struct {
+	ExpressionID int         `json:"expression_id"`
+	Expression   string      `json:"expression"`
+	Status       string      `json:"status"`
+	RootTaskID   int         `json:"root_task_id,omitempty"`
+	Tasks        []*TaskNode `json:"tasks"`
+}
+
+// TaskNode is one task of the graph. A task is processing once it was
+// handed to an agent, and cancelled if the expression stopped before it
+// finished.
+type TaskNode struct {
+	ID           int           `json:"id"`
+	Operation    string        `json:"operation"`
+	Operands     []TaskOperand `json:"operands"`
+	Status       string        `json:"status"`
+	Result       *float64      `json:"result,omitempty"`
+	Fraction     string        `json:"fraction,omitempty"`
+	AgentID      string        `json:"agent_id,omitempty"`
+	DispatchedAt *time.Time    `json:"dispatched_at,omitempty"`
+	FinishedAt   *time.Time    `json:"finished_at,omitempty"`
+	DurationMs   *int64        `json:"duration_ms,omitempty"`
+}
+
+// TaskOperand is a number of the expression or the result of the task
+// TaskID. Value is a float64, or a fraction string in exact mode, and is
+// missing while the task it comes from has not completed.
+type TaskOperand struct {
+	TaskID int         `json:"task_id,omitempty"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// TaskGraph returns the tasks of an expression of the user with their
+// operands resolved as far as they are known.
+func (s *Service) TaskGraph(userID, expressionID int) (*TaskGraph, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expr, err := s.getUserExpression(userID, expressionID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.store.GetExpressionTasks(expressionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	return newTaskGraph(expr, records), nil
+}
+
+func newTaskGraph(expr *models.Expression, records []*models.TaskRecord) *TaskGraph {
+	graph := &TaskGraph{
+		ExpressionID: expr.ID,
+		Expression:   expr.Expression,
+		Status:       string(expr.Status),
+		Tasks:        make([]*TaskNode, len(records)),
+	}
+	if len(records) > 0 {
+		graph.RootTaskID = records[len(records)-1].ID
+	}
+
+	producers := make(map[string]*models.TaskRecord, len(records))
+	for _, record := range records {
+		producers[getResultID(expr.ID, record.ID)] = record
+	}
+
+	for i, record := range records {
+		node := &TaskNode{
+			ID:           record.ID,
+			Operation:    record.Operation,
+			Operands:     make([]TaskOperand, len(record.Args)),
+			Status:       string(taskStatus(expr, record)),
+			AgentID:      record.AgentID,
+			DispatchedAt: record.DispatchedAt,
+			FinishedAt:   record.FinishedAt,
+		}
+
+		for j, arg := range record.Args {
+			ref, isRef := arg.(string)
+			if !isRef {
+				node.Operands[j] = TaskOperand{Value: operandValue(arg)}
+				continue
+			}
+			if producer, exists := producers[ref]; exists {
+				node.Operands[j].TaskID = producer.ID
+				if producer.Completed {
+					node.Operands[j].Value = recordValue(producer)
+				}
+			}
+		}
+
+		if record.Completed {
+			result := record.Result
+			node.Result = &result
+			if record.ExactResult != nil {
+				node.Fraction = record.ExactResult.String()
+			}
+		}
+		if record.DispatchedAt != nil && record.FinishedAt != nil {
+			node.DurationMs = millisecondsBetween(*record.DispatchedAt, *record.FinishedAt)
+		}
+
+		graph.Tasks[i] = node
+	}
+
+	return graph
+}
+
+func taskStatus(expr *models.Expression, record *models.TaskRecord) models.ExpressionStatus {
+	switch {
+	case record.Completed:
+		return models.StatusCompleted
+	case record.FinishedAt != nil:
+		return models.StatusFailed
+	case expr.Status == models.StatusCancelled || expr.Status == models.StatusFailed:
+		return models.StatusCancelled
+	case record.DispatchedAt != nil:
+		return models.StatusProcessing
+	default:
+		return models.StatusPending
+	}
+}
+
+func recordValue(record *models.TaskRecord) interface{} {
+	if record.ExactResult != nil {
+		return record.ExactResult.RatString()
+	}
+	return record.Result
+}
+
+func operandValue(arg interface{}) interface{} {
+	if rat, isRat := arg.(*big.Rat); isRat {
+		return rat.RatString()
+	}
+	return arg
+}
+
+// DOT renders the graph for Graphviz, with edges from each task to the
+// tasks that use its result.
+func (g *TaskGraph) DOT() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph expression_%d {\n", g.ExpressionID)
+	b.WriteString("    rankdir=BT;\n")
+	b.WriteString("    node [shape=box];\n")
+	for _, node := range g.Tasks {
+		fmt.Fprintf(&b, "    task_%d [label=\"%s\"];\n", node.ID, dotEscape(node.label("\n")))
+	}
+	for _, node := range g.Tasks {
+		for _, operand := range node.Operands {
+			if operand.TaskID != 0 {
+				fmt.Fprintf(&b, "    task_%d -> task_%d;\n", operand.TaskID, node.ID)
+			}
+		}
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart.
+func (g *TaskGraph) Mermaid() string {
+	var b strings.Builder
+
+	b.WriteString("flowchart BT\n")
+	for _, node := range g.Tasks {
+		fmt.Fprintf(&b, "    task_%d[\"%s\"]\n", node.ID, mermaidEscape(node.label("<br/>")))
+	}
+	for _, node := range g.Tasks {
+		for _, operand := range node.Operands {
+			if operand.TaskID != 0 {
+				fmt.Fprintf(&b, "    task_%d --> task_%d\n", operand.TaskID, node.ID)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// label describes the node in a few lines joined by newline, e.g.
+// "#2: #1 * 3", "= 9", "completed by agent-1".
+func (n *TaskNode) label(newline string) string {
+	args := make([]string, len(n.Operands))
+	for i, operand := range n.Operands {
+		switch value := operand.Value.(type) {
+		case nil:
+			args[i] = "#" + strconv.Itoa(operand.TaskID)
+		case float64:
+			args[i] = strconv.FormatFloat(value, 'g', -1, 64)
+		default:
+			args[i] = fmt.Sprint(value)
+		}
+	}
+
+	lines := []string{fmt.Sprintf("#%d: %s", n.ID, formatOperation(n.Operation, args))}
+	if n.Fraction != "" {
+		lines = append(lines, "= "+n.Fraction)
+	} else if n.Result != nil {
+		lines = append(lines, "= "+strconv.FormatFloat(*n.Result, 'g', -1, 64))
+	}
+	status := n.Status
+	if n.AgentID != "" {
+		status += " by " + n.AgentID
+	}
+	lines = append(lines, status)
+
+	return strings.Join(lines, newline)
+}
+
+// formatOperation writes binary operators between their operands and
+// functions with their arguments in parentheses.
+func formatOperation(operation string, args []string) string {
+	if _, isFunction := calculation.LookupFunction(operation); !isFunction && len(args) == 2 {
+		return args[0] + " " + operation + " " + args[1]
+	}
+	return operation + "(" + strings.Join(args, ", ") + ")"
+}
+
+var dotReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotEscape(s string) string {
+	return dotReplacer.Replace(s)
+}
+
+var mermaidReplacer = strings.NewReplacer(`"`, "#quot;", "<br/>", "<br/>", "<", "#lt;", ">", "#gt;")
+
+func mermaidEscape(s string) string {
+	return mermaidReplacer.Replace(s)
+}
@@ -0,0 +1,178 @@
+package orchestrator_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+)
+
+func TestTaskGraph(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	exprID, err := service.AddExpression(1, "(1+2)*3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	if err := service.RegisterAgent(orchestrator.AgentInfo{ID: "agent-1", Capacity: 1}); err != nil {
+		t.Fatalf("не удалось зарегистрировать агента: %v", err)
+	}
+	task, err := service.AssignTask("agent-1")
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := service.SetTaskResult(task.ID, task.LeaseID, 3); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+
+	graph, err := service.TaskGraph(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить граф задач: %v", err)
+	}
+	if len(graph.Tasks) != 2 || graph.RootTaskID != graph.Tasks[1].ID {
+		t.Fatalf("ожидалось две задачи с корнем во второй, получено %+v", graph)
+	}
+
+	first, second := graph.Tasks[0], graph.Tasks[1]
+	if first.Operation != "+" || first.Status != string(models.StatusCompleted) || first.Result == nil || *first.Result != 3 ||
+		first.AgentID != "agent-1" || first.DispatchedAt == nil || first.FinishedAt == nil || first.DurationMs == nil {
+		t.Errorf("первая задача должна быть выполнена agent-1 с результатом 3, получено %+v", first)
+	}
+	if second.Operation != "*" || second.Status != string(models.StatusPending) || second.Result != nil {
+		t.Errorf("вторая задача должна ждать выдачи, получено %+v", second)
+	}
+	if len(second.Operands) != 2 || second.Operands[0].TaskID != first.ID || second.Operands[0].Value != 3.0 || second.Operands[1].Value != 3.0 {
+		t.Errorf("первый операнд второй задачи — результат первой, получено %+v", second.Operands)
+	}
+
+	if _, err := service.TaskGraph(2, exprID); err != orchestrator.ErrUnauthorized {
+		t.Errorf("чужое выражение должно быть недоступно, получено %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", 1)
+		return c.Next()
+	})
+	app.Get("/expressions/:id/tasks", orchestrator.GetTaskGraphHandler(service))
+
+	get := func(query string) (int, string) {
+		t.Helper()
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/expressions/"+strconv.Itoa(exprID)+"/tasks"+query, nil))
+		if err != nil {
+			t.Fatalf("не удалось выполнить запрос: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("не удалось прочитать ответ: %v", err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	edge := "task_" + strconv.Itoa(first.ID) + " -> task_" + strconv.Itoa(second.ID)
+	if status, body := get("?format=dot"); status != http.StatusOK || !strings.HasPrefix(body, "digraph") || !strings.Contains(body, edge) {
+		t.Errorf("ожидался граф DOT с ребром %q, получено %d: %s", edge, status, body)
+	}
+
+	edge = "task_" + strconv.Itoa(first.ID) + " --> task_" + strconv.Itoa(second.ID)
+	if status, body := get("?format=mermaid"); status != http.StatusOK || !strings.HasPrefix(body, "flowchart") || !strings.Contains(body, edge) {
+		t.Errorf("ожидалась диаграмма Mermaid с ребром %q, получено %d: %s", edge, status, body)
+	}
+
+	if status, _ := get("?format=svg"); status != http.StatusBadRequest {
+		t.Errorf("неизвестный формат должен отклоняться, получено %d", status)
+	}
+}
+
+func TestTaskGraphOmitsUnregisteredAgent(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	exprID, err := service.AddExpression(1, "1+2")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := service.AssignTask("unknown-agent"); err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	graph, err := service.TaskGraph(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить граф задач: %v", err)
+	}
+	if task := graph.Tasks[0]; task.AgentID != "" || task.DispatchedAt == nil {
+		t.Errorf("задача незарегистрированного агента должна быть выдана без агента, получено %+v", task)
+	}
+}
+
+func TestTaskGraphShowsRequeuedTaskAsPending(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 20, LeaseReaperMs: 10})
+
+	exprID, err := service.AddExpression(1, "1+2")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if err := service.RegisterAgent(orchestrator.AgentInfo{ID: "agent-1", Capacity: 1}); err != nil {
+		t.Fatalf("не удалось зарегистрировать агента: %v", err)
+	}
+	if _, err := service.AssignTask("agent-1"); err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunLeaseReaper(ctx)
+
+	var node *orchestrator.TaskNode
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		graph, err := service.TaskGraph(1, exprID)
+		if err != nil {
+			t.Fatalf("не удалось получить граф задач: %v", err)
+		}
+		if node = graph.Tasks[0]; node.Status == string(models.StatusPending) {
+			break
+		}
+	}
+
+	if node.Status != string(models.StatusPending) || node.AgentID != "" || node.DispatchedAt != nil {
+		t.Errorf("задача с истёкшей арендой должна снова ожидать выдачи, получено %+v", node)
+	}
+}
+
+func TestTaskGraphShowsTaskDispatchedBeforeRestartAsPending(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 1000}
+	dbPath := filepath.Join(t.TempDir(), "calculator.db")
+
+	before := openTestService(t, cfg, dbPath)
+	exprID, err := before.AddExpression(1, "1+2")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := before.GetNextTask(); err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	after := openTestService(t, cfg, dbPath)
+	graph, err := after.TaskGraph(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить граф задач: %v", err)
+	}
+	if node := graph.Tasks[0]; node.Status != string(models.StatusPending) || node.DispatchedAt != nil {
+		t.Errorf("после перезапуска задача должна снова ожидать выдачи, получено %+v", node)
+	}
+}
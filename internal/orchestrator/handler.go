@@ -1,16 +1,38 @@
 package orchestrator
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// CalculateRequest accepts variable values as JSON numbers or numeric
+// strings; they are kept as text so exact mode reads them without rounding.
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string                 `json:"expression"`
+	Mode       string                 `json:"mode"`
+	Precision  int                    `json:"precision"`
+	Variables  map[string]json.Number `json:"variables"`
+}
+
+type ParseErrorDetails struct {
+	Message  string `json:"message"`
+	Offset   int    `json:"offset"`
+	Expected string `json:"expected"`
+	Found    string `json:"found"`
+	Snippet  string `json:"snippet"`
+	Variable string `json:"variable,omitempty"`
 }
 
 type CalculateResponse struct {
@@ -25,10 +47,24 @@ type ExpressionResponse struct {
 	Expression *ExpressionWithoutDuplication `json:"expression"`
 }
 
+// ExpressionWithoutDuplication is the API view of an expression. Exact-mode
+// results additionally carry the reduced fraction and its decimal rendering.
+// QueueWaitMs is the time until the first task was dispatched and ComputeMs
+// the time from then until the expression finished.
 type ExpressionWithoutDuplication struct {
-	ID     int      `json:"id"`
-	Status string   `json:"status"`
-	Result *float64 `json:"result,omitempty"`
+	ID          int               `json:"id"`
+	Status      string            `json:"status"`
+	Result      *float64          `json:"result,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	Fraction    string            `json:"fraction,omitempty"`
+	Decimal     string            `json:"decimal,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	QueueWaitMs *int64            `json:"queue_wait_ms,omitempty"`
+	ComputeMs   *int64            `json:"compute_ms,omitempty"`
 }
 
 type TaskResponse struct {
@@ -36,15 +72,37 @@ type TaskResponse struct {
 }
 
 type TaskResultRequest struct {
-	ID      int     `json:"id"`
-	Result  float64 `json:"result"`
-	IsError bool    `json:"isError"`
+	ID          int     `json:"id"`
+	LeaseID     string  `json:"lease_id"`
+	Result      float64 `json:"result"`
+	ExactResult string  `json:"exact_result,omitempty"`
+	IsError     bool    `json:"isError"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type ExtendLeaseRequest struct {
+	ID      int    `json:"id"`
+	LeaseID string `json:"lease_id"`
+}
+
+type ExtendLeaseResponse struct {
+	LeaseExpiresAt int64 `json:"lease_expires_at"`
 }
 
+// CalculateHandler starts the trace of the expression; its tasks continue it
+// on the agents.
 func CalculateHandler(service *Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(int)
 
+		ctx, span := tracing.Tracer().Start(c.UserContext(), "CalculateHandler",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.Int("user.id", userID)))
+		defer func() {
+			span.SetAttributes(attribute.Int("http.response.status_code", c.Response().StatusCode()))
+			span.End()
+		}()
+
 		var req CalculateRequest
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -58,7 +116,19 @@ func CalculateHandler(service *Service) fiber.Handler {
 			})
 		}
 
-		if matched, _ := regexp.MatchString(`^-?\d+(\.\d+)?$`, req.Expression); matched {
+		if req.Mode != "" && req.Mode != calculation.ModeFloat && req.Mode != calculation.ModeExact {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Mode must be \"float\" or \"exact\"",
+			})
+		}
+
+		if req.Precision < 0 || req.Precision > MaxPrecision {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Precision must be between 0 and %d", MaxPrecision),
+			})
+		}
+
+		if matched, _ := regexp.MatchString(`^-?\d+(\.\d+)?$`, req.Expression); matched && req.Mode != calculation.ModeExact && len(req.Variables) == 0 {
 			id, err := service.AddSimpleExpression(userID, req.Expression)
 			if err != nil {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -71,17 +141,62 @@ func CalculateHandler(service *Service) fiber.Handler {
 			})
 		}
 
-		id, err := service.AddExpression(userID, req.Expression)
+		var variables map[string]string
+		if len(req.Variables) > 0 {
+			variables = make(map[string]string, len(req.Variables))
+			for name, value := range req.Variables {
+				variables[name] = value.String()
+			}
+		}
+
+		id, err := service.AddExpressionWithOptions(ctx, userID, req.Expression, ExpressionOptions{
+			Mode:      req.Mode,
+			Precision: req.Precision,
+			Variables: variables,
+		})
 		if err != nil {
+			if errors.Is(err, ErrInvalidMode) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
 			if errors.Is(err, ErrInvalidExpression) {
-				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				span.SetStatus(codes.Error, "invalid expression")
+				response := fiber.Map{
 					"error": "invalid expression",
-				})
+				}
+
+				var parseErr *calculation.ParseError
+				if errors.As(err, &parseErr) {
+					details := ParseErrorDetails{
+						Message:  parseErr.Error(),
+						Offset:   parseErr.Offset,
+						Expected: parseErr.Expected,
+						Found:    parseErr.Found,
+						Snippet:  parseErr.Snippet(),
+					}
+
+					var unbound *calculation.UnboundVariableError
+					if errors.As(err, &unbound) {
+						response["error"] = unbound.Error()
+						details.Variable = unbound.Name
+					}
+
+					response["details"] = details
+				}
+
+				if errors.Is(err, calculation.ErrInvalidVariable) {
+					response["error"] = err.Error()
+				}
+
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
 			}
+			tracing.RecordError(span, err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "internal server error",
 			})
 		}
+		span.SetAttributes(attribute.Int("expression.id", id))
 
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 			"id": id,
@@ -93,24 +208,41 @@ func GetExpressionsHandler(service *Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userID := c.Locals("userID").(int)
 
-		expressions, err := service.GetAllExpressions(userID)
+		precision, err := precisionParam(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		query, err := historyQuery(c, userID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		page, err := service.ListExpressions(query)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to get expressions",
 			})
 		}
 
-		cleanExpressions := make([]*ExpressionWithoutDuplication, len(expressions))
-		for i, expr := range expressions {
-			cleanExpressions[i] = &ExpressionWithoutDuplication{
-				ID:     expr.ID,
-				Status: string(expr.Status),
-				Result: expr.Result,
-			}
+		cleanExpressions := make([]*ExpressionWithoutDuplication, len(page.Expressions))
+		for i, expr := range page.Expressions {
+			cleanExpressions[i] = newExpressionView(expr, precision)
+		}
+
+		var nextCursor *string
+		if page.NextCursor != "" {
+			nextCursor = &page.NextCursor
 		}
 
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"expressions": cleanExpressions,
+			"next_cursor": nextCursor,
+			"total":       page.Total,
 		})
 	}
 }
@@ -127,6 +259,13 @@ func GetExpressionHandler(service *Service) fiber.Handler {
 			})
 		}
 
+		precision, err := precisionParam(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
 		expression, err := service.GetExpressionByID(userID, id)
 		if err != nil {
 			if err == ErrExpressionNotFound {
@@ -143,18 +282,159 @@ func GetExpressionHandler(service *Service) fiber.Handler {
 			})
 		}
 
-		cleanExpression := &ExpressionWithoutDuplication{
-			ID:     expression.ID,
-			Status: string(expression.Status),
-			Result: expression.Result,
+		return c.Status(fiber.StatusOK).JSON(ExpressionResponse{
+			Expression: newExpressionView(expression, precision),
+		})
+	}
+}
+
+func CancelExpressionHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": "Invalid expression ID",
+			})
+		}
+
+		expression, err := service.CancelExpression(userID, id)
+		if err != nil {
+			switch err {
+			case ErrExpressionNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Expression not found",
+				})
+			case ErrUnauthorized:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Access denied",
+				})
+			case ErrExpressionFinished:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Expression already finished",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
 		}
 
 		return c.Status(fiber.StatusOK).JSON(ExpressionResponse{
-			Expression: cleanExpression,
+			Expression: newExpressionView(expression, 0),
 		})
 	}
 }
 
+// GetTaskGraphHandler returns the tasks of an expression as JSON, or with
+// ?format=dot or ?format=mermaid rendered as a graph.
+func GetTaskGraphHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": "Invalid expression ID",
+			})
+		}
+
+		format := c.Query("format", "json")
+		if format != "json" && format != "dot" && format != "mermaid" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "format must be json, dot or mermaid",
+			})
+		}
+
+		graph, err := service.TaskGraph(userID, id)
+		if err != nil {
+			switch err {
+			case ErrExpressionNotFound:
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Expression not found",
+				})
+			case ErrUnauthorized:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Access denied",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		switch format {
+		case "dot":
+			c.Set(fiber.HeaderContentType, "text/vnd.graphviz; charset=utf-8")
+			return c.Status(fiber.StatusOK).SendString(graph.DOT())
+		case "mermaid":
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			return c.Status(fiber.StatusOK).SendString(graph.Mermaid())
+		}
+		return c.Status(fiber.StatusOK).JSON(graph)
+	}
+}
+
+// newExpressionView renders exact results at the given number of decimal
+// places; 0 falls back to the precision requested with the expression.
+func newExpressionView(expr *models.Expression, precision int) *ExpressionWithoutDuplication {
+	view := &ExpressionWithoutDuplication{
+		ID:          expr.ID,
+		Status:      string(expr.Status),
+		Result:      expr.Result,
+		Variables:   expr.Variables,
+		Error:       expr.Error,
+		CreatedAt:   expr.CreatedAt,
+		StartedAt:   expr.StartedAt,
+		CompletedAt: expr.CompletedAt,
+	}
+
+	if expr.StartedAt != nil {
+		view.QueueWaitMs = millisecondsBetween(expr.CreatedAt, *expr.StartedAt)
+		if expr.CompletedAt != nil {
+			view.ComputeMs = millisecondsBetween(*expr.StartedAt, *expr.CompletedAt)
+		}
+	}
+
+	if expr.Mode == calculation.ModeExact {
+		view.Mode = expr.Mode
+	}
+
+	if expr.ExactResult != nil {
+		if precision == 0 {
+			precision = expr.Precision
+		}
+		if precision == 0 {
+			precision = DefaultPrecision
+		}
+		view.Fraction = expr.ExactResult.String()
+		view.Decimal = expr.ExactResult.FloatString(precision)
+	}
+
+	return view
+}
+
+func millisecondsBetween(from, to time.Time) *int64 {
+	ms := to.Sub(from).Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	return &ms
+}
+
+func precisionParam(c *fiber.Ctx) (int, error) {
+	value := c.Query("precision")
+	if value == "" {
+		return 0, nil
+	}
+
+	precision, err := strconv.Atoi(value)
+	if err != nil || precision < 1 || precision > MaxPrecision {
+		return 0, fmt.Errorf("precision must be between 1 and %d", MaxPrecision)
+	}
+	return precision, nil
+}
+
 func GetTaskHandler(service *Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		task, err := service.GetNextTask()
@@ -184,19 +464,45 @@ func SubmitTaskResultHandler(service *Service) fiber.Handler {
 			})
 		}
 
-		var err error
-		if req.IsError {
-			err = service.SetTaskError(req.ID, "Calculation error")
-		} else {
-			err = service.SetTaskResult(req.ID, req.Result)
+		// HTTP agents are not in the registry, so leases of registered
+		// agents cannot be used here.
+		err := service.CheckLeaseHolder(req.ID, req.LeaseID, "")
+		switch {
+		case err != nil:
+		case req.IsError:
+			reason := req.Error
+			if reason == "" {
+				reason = "Calculation error"
+			}
+			err = service.SetTaskError(req.ID, req.LeaseID, reason)
+		case req.ExactResult != "":
+			result, parseErr := calculation.ParseRat(req.ExactResult)
+			if parseErr != nil {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+					"error": "Invalid task result",
+				})
+			}
+			err = service.SetTaskExactResult(req.ID, req.LeaseID, result)
+		default:
+			err = service.SetTaskResult(req.ID, req.LeaseID, req.Result)
 		}
 
 		if err != nil {
+			if err == ErrLeaseNotHeld {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
 			if err == ErrTaskNotFound {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 					"error": "Task not found",
 				})
 			}
+			if err == ErrLeaseExpired || err == ErrTaskAlreadyCompleted || err == ErrExpressionCancelled || err == ErrExpressionFailed {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
 			if err == ErrInvalidTaskResult {
 				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
 					"error": "Invalid task result",
@@ -212,3 +518,54 @@ func SubmitTaskResultHandler(service *Service) fiber.Handler {
 		})
 	}
 }
+
+func ExtendLeaseHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ExtendLeaseRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+
+		var deadline time.Time
+		err := service.CheckLeaseHolder(req.ID, req.LeaseID, "")
+		if err == nil {
+			deadline, err = service.ExtendLease(req.ID, req.LeaseID)
+		}
+		if err != nil {
+			if err == ErrLeaseNotHeld {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			if err == ErrTaskNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Task not found",
+				})
+			}
+			if err == ErrLeaseExpired || err == ErrTaskAlreadyCompleted || err == ErrExpressionCancelled || err == ErrExpressionFailed {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(ExtendLeaseResponse{
+			LeaseExpiresAt: deadline.UnixMilli(),
+		})
+	}
+}
+
+// AgentsHandler lists the agents in the registry with the tasks they hold
+// and how many tasks each finished during the last minute.
+func AgentsHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"agents": service.Agents(),
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package orchestrator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ExpressionPage is one page of the expression history of a user.
+// NextCursor is empty on the last page.
+type ExpressionPage struct {
+	Expressions []*models.Expression
+	NextCursor  string
+	Total       int
+}
+
+// historyCursor is what a cursor string encodes. Sort is kept so a cursor
+// is not silently reused with a different sort order.
+type historyCursor struct {
+	Sort  string `json:"s"`
+	ID    int    `json:"id"`
+	Value string `json:"v,omitempty"`
+}
+
+// ListExpressions returns a page of the expressions of the user. The store
+// is asked for one expression more than the limit to know whether another
+// page follows.
+func (s *Service) ListExpressions(query database.ExpressionQuery) (*ExpressionPage, error) {
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	expressions, total, err := s.store.ListExpressions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ExpressionPage{Expressions: expressions, Total: total}
+	if len(expressions) > limit {
+		page.Expressions = expressions[:limit]
+		page.NextCursor = encodeCursor(sortName(query), query.CursorFor(page.Expressions[limit-1]))
+	}
+	return page, nil
+}
+
+// sortName is the value of the sort parameter for the query.
+func sortName(query database.ExpressionQuery) string {
+	if query.Descending {
+		return "-" + query.SortBy
+	}
+	return query.SortBy
+}
+
+func encodeCursor(sort string, cursor *database.ExpressionCursor) string {
+	data, _ := json.Marshal(historyCursor{Sort: sort, ID: cursor.ID, Value: cursor.Value})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(sort, value string) (*database.ExpressionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor historyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &database.ExpressionCursor{ID: cursor.ID, Value: cursor.Value}, nil
+}
+
+// historyQuery reads the query parameters of GET /api/v1/expressions.
+func historyQuery(c *fiber.Ctx, userID int) (database.ExpressionQuery, error) {
+	query := database.ExpressionQuery{
+		UserID:     userID,
+		SortBy:     database.SortByCreatedAt,
+		Descending: true,
+		Limit:      DefaultHistoryLimit,
+		Search:     c.Query("q"),
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxHistoryLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", MaxHistoryLimit)
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("sort"); value != "" {
+		field := strings.TrimPrefix(value, "-")
+		switch field {
+		case database.SortByCreatedAt, database.SortByExpression, database.SortByStatus:
+		default:
+			return query, fmt.Errorf("unknown sort %q", value)
+		}
+		query.SortBy = field
+		query.Descending = strings.HasPrefix(value, "-")
+	}
+
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			switch status := models.ExpressionStatus(strings.TrimSpace(status)); status {
+			case models.StatusPending, models.StatusProcessing, models.StatusCompleted,
+				models.StatusFailed, models.StatusCancelled:
+				query.Statuses = append(query.Statuses, status)
+			default:
+				return query, fmt.Errorf("unknown status %q", status)
+			}
+		}
+	}
+
+	var err error
+	if query.From, err = timeParam(c, "from"); err != nil {
+		return query, err
+	}
+	if query.To, err = timeParam(c, "to"); err != nil {
+		return query, err
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		if query.After, err = decodeCursor(sortName(query), value); err != nil {
+			return query, err
+		}
+	}
+
+	return query, nil
+}
+
+// timeParam accepts an RFC 3339 time or a date, which means its midnight
+// in UTC.
+func timeParam(c *fiber.Ctx, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
+}
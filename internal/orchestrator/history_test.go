@@ -0,0 +1,102 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+)
+
+type historyResponse struct {
+	Expressions []orchestrator.ExpressionWithoutDuplication `json:"expressions"`
+	NextCursor  *string                                     `json:"next_cursor"`
+	Total       int                                         `json:"total"`
+}
+
+func getHistory(t *testing.T, app *fiber.App, params url.Values) (int, historyResponse) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/expressions?"+params.Encode(), nil))
+	if err != nil {
+		t.Fatalf("не удалось выполнить запрос: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body historyResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("не удалось разобрать ответ: %v", err)
+		}
+	}
+	return resp.StatusCode, body
+}
+
+func TestExpressionHistoryPages(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", 1)
+		return c.Next()
+	})
+	app.Get("/expressions", orchestrator.GetExpressionsHandler(service))
+
+	var ids []int
+	for _, expression := range []string{"-(1)", "-(2)", "-(3)", "-(4)", "-(5)"} {
+		id, err := service.AddExpression(1, expression)
+		if err != nil {
+			t.Fatalf("не удалось добавить выражение: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := service.AddExpression(2, "-(6)"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	var got []int
+	params := url.Values{"limit": {"2"}}
+	for {
+		status, page := getHistory(t, app, params)
+		if status != http.StatusOK {
+			t.Fatalf("ожидался ответ 200, получено %d", status)
+		}
+		if page.Total != len(ids) {
+			t.Errorf("ожидалось всего %d выражений, получено %d", len(ids), page.Total)
+		}
+		for _, expr := range page.Expressions {
+			got = append(got, expr.ID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		params.Set("cursor", *page.NextCursor)
+	}
+
+	if len(got) != len(ids) {
+		t.Fatalf("ожидалось %d выражений, получено %v", len(ids), got)
+	}
+	for i, id := range got {
+		if id != ids[len(ids)-1-i] {
+			t.Fatalf("выражения должны идти от новых к старым, получено %v", got)
+		}
+	}
+
+	_, first := getHistory(t, app, url.Values{"limit": {"2"}})
+	for _, params := range []url.Values{
+		{"cursor": {*first.NextCursor}, "sort": {"expression"}},
+		{"cursor": {"not a cursor"}},
+		{"limit": {"0"}},
+		{"status": {"done"}},
+		{"sort": {"id"}},
+		{"from": {"yesterday"}},
+	} {
+		if status, _ := getHistory(t, app, params); status != http.StatusBadRequest {
+			t.Errorf("запрос %v должен отклоняться, получено %d", params, status)
+		}
+	}
+}
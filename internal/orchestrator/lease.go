@@ -0,0 +1,180 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+type lease struct {
+	ID       string
+	TaskID   int
+	AgentID  string
+	Deadline time.Time
+}
+
+// RevokedLease is a lease withdrawn because the expression of its task was
+// cancelled or failed.
+type RevokedLease struct {
+	TaskID  int
+	LeaseID string
+}
+
+// revocationBufferSize bounds the revocations queued for a watcher. One that
+// falls behind misses some; its agent still learns about them from
+// ExtendLease.
+const revocationBufferSize = 64
+
+func newLeaseID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Service) leaseDuration(operationTime int) time.Duration {
+	return time.Duration(operationTime+s.config.LeaseGraceMs) * time.Millisecond
+}
+
+// checkLease must be called with s.mu held.
+func (s *Service) checkLease(taskID int, leaseID string) error {
+	task, exists := s.tasks[taskID]
+	if !exists {
+		return ErrTaskNotFound
+	}
+
+	if result, exists := s.results[getResultID(task.ExpressionID, taskID)]; exists && result.Completed {
+		return ErrTaskAlreadyCompleted
+	}
+
+	if err := s.expressionStopped(task.ExpressionID); err != nil {
+		return err
+	}
+
+	l, exists := s.leases[taskID]
+	if !exists || l.ID != leaseID {
+		return ErrLeaseExpired
+	}
+
+	return nil
+}
+
+func (s *Service) ExtendLease(taskID int, leaseID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkLease(taskID, leaseID); err != nil {
+		return time.Time{}, err
+	}
+
+	l := s.leases[taskID]
+	deadline := time.Now().Add(time.Duration(s.config.LeaseGraceMs) * time.Millisecond)
+	if deadline.After(l.Deadline) {
+		l.Deadline = deadline
+	}
+
+	return l.Deadline, nil
+}
+
+func (s *Service) RunLeaseReaper(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.LeaseReaperMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expireAgents(now)
+			s.requeueExpiredLeases(now)
+		}
+	}
+}
+
+func (s *Service) requeueExpiredLeases(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for taskID, l := range s.leases {
+		if now.Before(l.Deadline) {
+			continue
+		}
+
+		delete(s.leases, taskID)
+
+		task, exists := s.tasks[taskID]
+		if !exists {
+			continue
+		}
+
+		s.requeueTask(task)
+		log.Printf("Lease %s for task ID=%d expired, task returned to queue", l.ID, taskID)
+	}
+}
+
+// WatchRevokedLeases delivers the leases revoked from now on, so an open task
+// stream can tell its agent to stop right away. stop must be called once the
+// channel is no longer read.
+func (s *Service) WatchRevokedLeases() (revoked <-chan RevokedLease, stop func()) {
+	ch := make(chan RevokedLease, revocationBufferSize)
+
+	s.mu.Lock()
+	s.watchers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.watchers, ch)
+		s.mu.Unlock()
+	}
+}
+
+// revokeLease must be called with s.mu held.
+func (s *Service) revokeLease(l *lease) {
+	delete(s.leases, l.TaskID)
+
+	for ch := range s.watchers {
+		select {
+		case ch <- RevokedLease{TaskID: l.TaskID, LeaseID: l.ID}:
+		default:
+		}
+	}
+}
+
+// ReleaseTask gives up a lease before it expires, for example when the
+// stream of the agent holding it breaks, so the task is assigned again
+// right away.
+func (s *Service) ReleaseTask(taskID int, leaseID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, exists := s.leases[taskID]
+	if !exists || l.ID != leaseID {
+		return
+	}
+	delete(s.leases, taskID)
+
+	if task, exists := s.tasks[taskID]; exists {
+		s.requeueTask(task)
+		log.Printf("Lease %s for task ID=%d released, task returned to queue", l.ID, taskID)
+	}
+}
+
+// CheckLeaseHolder returns ErrLeaseNotHeld when the lease was given to an
+// agent other than agentID. A lease given to an agent outside the registry
+// is proven by its ID alone. Stale leases are not reported here; the call
+// that uses the lease rejects them.
+func (s *Service) CheckLeaseHolder(taskID int, leaseID, agentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, exists := s.leases[taskID]
+	if !exists || l.ID != leaseID || l.AgentID == "" {
+		return nil
+	}
+	if l.AgentID != agentID {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
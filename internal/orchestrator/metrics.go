@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"log"
+
+	"github.com/neptship/calc-yandex-go/internal/metrics"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pendingTasksDesc = prometheus.NewDesc("calc_tasks_pending",
+		"Tasks waiting for the results of other tasks.", nil, nil)
+	readyTasksDesc = prometheus.NewDesc("calc_tasks_ready",
+		"Tasks in the ready queue, waiting for an agent.", nil, nil)
+	leasesDesc = prometheus.NewDesc("calc_leases_in_flight",
+		"Tasks handed to agents whose result has not come back yet.", nil, nil)
+	expressionsDesc = prometheus.NewDesc("calc_expressions",
+		"Expressions of all users by status.", []string{"status"}, nil)
+)
+
+var expressionStatuses = []models.ExpressionStatus{
+	models.StatusPending,
+	models.StatusProcessing,
+	models.StatusCompleted,
+	models.StatusFailed,
+	models.StatusCancelled,
+}
+
+// Collector reports the state of the scheduler on every scrape.
+func (s *Service) Collector() prometheus.Collector {
+	return stateCollector{s}
+}
+
+type stateCollector struct {
+	s *Service
+}
+
+func (c stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingTasksDesc
+	ch <- readyTasksDesc
+	ch <- leasesDesc
+	ch <- expressionsDesc
+}
+
+func (c stateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.mu.Lock()
+	pending, ready, leases := len(c.s.waiting), c.s.ready.count(c.s.dispatchable), len(c.s.leases)
+	c.s.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(pendingTasksDesc, prometheus.GaugeValue, float64(pending))
+	ch <- prometheus.MustNewConstMetric(readyTasksDesc, prometheus.GaugeValue, float64(ready))
+	ch <- prometheus.MustNewConstMetric(leasesDesc, prometheus.GaugeValue, float64(leases))
+
+	counts, err := c.s.store.CountExpressionsByStatus()
+	if err != nil {
+		log.Printf("Error counting expressions for metrics: %v", err)
+		ch <- prometheus.NewInvalidMetric(expressionsDesc, err)
+		return
+	}
+	for _, status := range expressionStatuses {
+		ch <- prometheus.MustNewConstMetric(expressionsDesc, prometheus.GaugeValue, float64(counts[status]), string(status))
+	}
+}
+
+// observeTask must be called with s.mu held once the task has finished.
+func (s *Service) observeTask(task *models.Task) {
+	if task.DispatchedAt == nil || task.FinishedAt == nil {
+		return
+	}
+	metrics.TaskDuration.WithLabelValues(task.Operation).Observe(task.FinishedAt.Sub(*task.DispatchedAt).Seconds())
+}
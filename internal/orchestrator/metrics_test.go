@@ -0,0 +1,69 @@
+package orchestrator_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStateMetrics(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	if _, err := service.AddExpression(1, "(1+2)*3"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := service.AddExpression(1, "-(5)"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := service.AssignTask("agent-1"); err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	expected := `
+# HELP calc_expressions Expressions of all users by status.
+# TYPE calc_expressions gauge
+calc_expressions{status="cancelled"} 0
+calc_expressions{status="completed"} 1
+calc_expressions{status="failed"} 0
+calc_expressions{status="pending"} 0
+calc_expressions{status="processing"} 1
+# HELP calc_leases_in_flight Tasks handed to agents whose result has not come back yet.
+# TYPE calc_leases_in_flight gauge
+calc_leases_in_flight 1
+# HELP calc_tasks_pending Tasks waiting for the results of other tasks.
+# TYPE calc_tasks_pending gauge
+calc_tasks_pending 1
+# HELP calc_tasks_ready Tasks in the ready queue, waiting for an agent.
+# TYPE calc_tasks_ready gauge
+calc_tasks_ready 0
+`
+	if err := testutil.CollectAndCompare(service.Collector(), strings.NewReader(expected)); err != nil {
+		t.Errorf("метрики планировщика не совпали: %v", err)
+	}
+}
+
+func TestReadyMetricSkipsCancelledExpressions(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	cancelled, err := service.AddExpression(1, "1+2+3*4")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := service.AddExpression(1, "5+6"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	if _, err := service.CancelExpression(1, cancelled); err != nil {
+		t.Fatalf("не удалось отменить выражение: %v", err)
+	}
+
+	expected := `
+# HELP calc_tasks_ready Tasks in the ready queue, waiting for an agent.
+# TYPE calc_tasks_ready gauge
+calc_tasks_ready 1
+`
+	if err := testutil.CollectAndCompare(service.Collector(), strings.NewReader(expected), "calc_tasks_ready"); err != nil {
+		t.Errorf("задачи отменённого выражения не должны считаться готовыми: %v", err)
+	}
+}
@@ -1,9 +1,390 @@
 package orchestrator_test
 
 import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/database/memory"
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
 )
 
+func newTestService(t *testing.T, cfg *config.Config) *orchestrator.Service {
+	t.Helper()
+
+	service, err := orchestrator.NewService(cfg, memory.New())
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	return service
+}
+
+// openTestService keeps its state in SQLite at dbPath, for tests that
+// restart the service.
+func openTestService(t *testing.T, cfg *config.Config, dbPath string) *orchestrator.Service {
+	t.Helper()
+
+	db, err := database.NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("не удалось создать базу данных: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	service, err := orchestrator.NewService(cfg, db)
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	return service
+}
+
+func TestLeaseExpirationRequeuesTask(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 20, LeaseReaperMs: 5}
+	service := newTestService(t, cfg)
+
+	exprID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	lost, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Fatalf("задача под арендой не должна выдаваться повторно, получено: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.RunLeaseReaper(ctx)
+		close(done)
+	}()
+
+	var reassigned *models.Task
+	deadline := time.Now().Add(time.Second)
+	for reassigned == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		reassigned, _ = service.GetNextTask()
+	}
+	cancel()
+	<-done
+
+	if reassigned == nil {
+		t.Fatal("просроченная задача не вернулась в очередь")
+	}
+	if reassigned.ID != lost.ID || reassigned.LeaseID == lost.LeaseID {
+		t.Fatalf("ожидалась та же задача с новой арендой, получено ID=%d аренда=%s", reassigned.ID, reassigned.LeaseID)
+	}
+
+	if err := service.SetTaskResult(lost.ID, lost.LeaseID, 5); !errors.Is(err, orchestrator.ErrLeaseExpired) {
+		t.Errorf("результат по старой аренде должен отклоняться, получено: %v", err)
+	}
+	if err := service.SetTaskResult(reassigned.ID, reassigned.LeaseID, 5); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	if err := service.SetTaskResult(reassigned.ID, reassigned.LeaseID, 5); !errors.Is(err, orchestrator.ErrTaskAlreadyCompleted) {
+		t.Errorf("повторный результат не должен применяться, получено: %v", err)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != 5 {
+		t.Errorf("ожидалось завершённое выражение с результатом 5, получено %s", expr.Status)
+	}
+}
+
+func TestTaskBecomesReadyAfterDependencies(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+
+	if _, err := service.AddExpression(1, "(1+2)*(3+4)"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	left, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить первую задачу: %v", err)
+	}
+	right, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить вторую задачу: %v", err)
+	}
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Fatalf("умножение не должно быть готово до сложений, получено: %v", err)
+	}
+
+	if err := service.SetTaskResult(left.ID, left.LeaseID, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Fatalf("умножение не должно быть готово без второго операнда, получено: %v", err)
+	}
+
+	if err := service.SetTaskResult(right.ID, right.LeaseID, 7); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	mul, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("умножение не стало готовым: %v", err)
+	}
+	if mul.Operation != "*" || mul.Arg1 != 3.0 || mul.Arg2 != 7.0 {
+		t.Errorf("ожидалась задача 3 * 7, получено %v %s %v", mul.Arg1, mul.Operation, mul.Arg2)
+	}
+}
+
+func TestWaitForTaskWakesUpWhenTaskBecomesReady(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+
+	if _, err := service.AddExpression(1, "(1+2)*3"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	sum, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	waited := make(chan *models.Task, 1)
+	go func() {
+		task, err := service.WaitForTask(context.Background(), "")
+		if err != nil {
+			t.Errorf("ожидание задачи завершилось ошибкой: %v", err)
+		}
+		waited <- task
+	}()
+
+	select {
+	case task := <-waited:
+		t.Fatalf("умножение выдано до готовности операндов: %v", task)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := service.SetTaskResult(sum.ID, sum.LeaseID, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	select {
+	case task := <-waited:
+		if task == nil || task.Operation != "*" {
+			t.Fatalf("ожидалась задача умножения, получено %v", task)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ожидающий агент не получил ставшую готовой задачу")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := service.WaitForTask(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ожидалось истечение контекста, получено: %v", err)
+	}
+}
+
+func TestAgentRegistryExpiresSilentAgents(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 10000, LeaseReaperMs: 5, AgentTimeoutMs: 50}
+	service := newTestService(t, cfg)
+
+	if err := service.RegisterAgent(orchestrator.AgentInfo{ID: "agent-1", Hostname: "host", Version: "dev", Capacity: 2}); err != nil {
+		t.Fatalf("не удалось зарегистрировать агента: %v", err)
+	}
+	if err := service.RegisterAgent(orchestrator.AgentInfo{ID: "agent-2"}); !errors.Is(err, orchestrator.ErrInvalidAgent) {
+		t.Fatalf("агент без мощности не должен регистрироваться, получено: %v", err)
+	}
+	if err := service.AgentHeartbeat("unknown"); !errors.Is(err, orchestrator.ErrAgentNotRegistered) {
+		t.Fatalf("ожидалась ошибка незарегистрированного агента, получено: %v", err)
+	}
+
+	if _, err := service.AddExpression(1, "(1+2)*(3+4)"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	done, err := service.AssignTask("agent-1")
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	held, err := service.AssignTask("agent-1")
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := service.SetTaskResult(done.ID, done.LeaseID, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	agents := service.Agents()
+	if len(agents) != 1 {
+		t.Fatalf("ожидался один агент, получено %d", len(agents))
+	}
+	agent := agents[0]
+	if len(agent.Tasks) != 1 || agent.Tasks[0] != held.ID {
+		t.Errorf("ожидалось, что агент держит задачу ID=%d, получено %v", held.ID, agent.Tasks)
+	}
+	if agent.CompletedTasks != 1 || agent.TasksPerMinute != 1 {
+		t.Errorf("ожидалась одна выполненная задача, получено %d (за минуту %d)", agent.CompletedTasks, agent.TasksPerMinute)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunLeaseReaper(ctx)
+
+	var reassigned *models.Task
+	deadline := time.Now().Add(time.Second)
+	for reassigned == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		reassigned, _ = service.GetNextTask()
+	}
+
+	if reassigned == nil || reassigned.ID != held.ID {
+		t.Fatalf("задача молчащего агента не вернулась в очередь: %v", reassigned)
+	}
+	if len(service.Agents()) != 0 {
+		t.Error("молчащий агент должен быть удалён из реестра")
+	}
+	if err := service.AgentHeartbeat("agent-1"); !errors.Is(err, orchestrator.ErrAgentNotRegistered) {
+		t.Errorf("удалённый агент должен зарегистрироваться заново, получено: %v", err)
+	}
+}
+
+func TestFunctionTaskCarriesAllArguments(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000, MaxMs: 300})
+
+	if _, err := service.AddExpression(1, "max(1, 5, 3)*2"); err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	task, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if task.Operation != "max" || len(task.Args) != 3 || task.Args[1] != 5.0 {
+		t.Fatalf("ожидалась задача max(1, 5, 3), получено %s%v", task.Operation, task.Args)
+	}
+	if task.OperationTime != 300 {
+		t.Errorf("ожидалось время операции 300 мс, получено %d", task.OperationTime)
+	}
+}
+
+func TestCancelExpression(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+
+	exprID, err := service.AddExpression(1, "(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	inFlight, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	if _, err := service.CancelExpression(2, exprID); !errors.Is(err, orchestrator.ErrUnauthorized) {
+		t.Errorf("чужое выражение не должно отменяться, получено: %v", err)
+	}
+
+	expr, err := service.CancelExpression(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось отменить выражение: %v", err)
+	}
+	if expr.Status != models.StatusCancelled {
+		t.Errorf("ожидался статус %s, получен %s", models.StatusCancelled, expr.Status)
+	}
+
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Errorf("задачи отменённого выражения не должны выдаваться, получено: %v", err)
+	}
+	if err := service.SetTaskResult(inFlight.ID, inFlight.LeaseID, 3); !errors.Is(err, orchestrator.ErrExpressionCancelled) {
+		t.Errorf("результат отменённой задачи должен игнорироваться, получено: %v", err)
+	}
+	if _, err := service.CancelExpression(1, exprID); !errors.Is(err, orchestrator.ErrExpressionFinished) {
+		t.Errorf("повторная отмена должна завершаться ошибкой, получено: %v", err)
+	}
+
+	stored, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if stored.Status != models.StatusCancelled {
+		t.Errorf("в базе ожидался статус %s, получен %s", models.StatusCancelled, stored.Status)
+	}
+}
+
+func TestConstantExpressionCompletesImmediately(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	exprID, err := service.AddExpression(1, "-(5)")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != -5 {
+		t.Errorf("ожидался завершённый результат -5, получено %s/%v", expr.Status, expr.Result)
+	}
+
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Errorf("для константы не должно создаваться задач, получено: %v", err)
+	}
+}
+
+func TestServiceRestoresStateAfterRestart(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 1000}
+	dbPath := filepath.Join(t.TempDir(), "calculator.db")
+
+	before := openTestService(t, cfg, dbPath)
+	exprID, err := before.AddExpression(1, "2+3*4")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	task, err := before.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := before.SetTaskResult(task.ID, task.LeaseID, 12); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	after := openTestService(t, cfg, dbPath)
+
+	next, err := after.GetNextTask()
+	if err != nil {
+		t.Fatalf("после перезапуска задача не восстановлена: %v", err)
+	}
+	if next.Operation != "+" || next.Arg1 != 2.0 || next.Arg2 != 12.0 {
+		t.Fatalf("ожидалась задача 2 + 12, получено %v %s %v", next.Arg1, next.Operation, next.Arg2)
+	}
+
+	otherID, err := after.AddExpression(1, "1-1")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение после перезапуска: %v", err)
+	}
+	if otherID == exprID {
+		t.Fatalf("идентификатор выражения повторился: %d", otherID)
+	}
+
+	if err := after.SetTaskResult(next.ID, next.LeaseID, 14); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	expr, err := after.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != 14 {
+		t.Errorf("ожидался результат 14, статус %s", expr.Status)
+	}
+}
+
 func TestTaskProcessingFlow(t *testing.T) {
 	t.Log("Проверяем поток обработки задач")
 
@@ -115,3 +496,307 @@ func TestPerformanceMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestExactExpressionSurvivesRestart(t *testing.T) {
+	cfg := &config.Config{LeaseGraceMs: 1000}
+	dbPath := filepath.Join(t.TempDir(), "calculator.db")
+
+	before := openTestService(t, cfg, dbPath)
+	exprID, err := before.AddExpressionWithOptions(context.Background(), 1, "(0.1+0.2)*3", orchestrator.ExpressionOptions{
+		Mode:      calculation.ModeExact,
+		Precision: 5,
+	})
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	sum, err := before.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if !sum.Exact || len(sum.Args) != 2 || sum.Args[0].(*big.Rat).Cmp(big.NewRat(1, 10)) != 0 {
+		t.Fatalf("ожидалась точная задача с операндом 1/10, получено %+v", sum)
+	}
+	if err := before.SetTaskResult(sum.ID, sum.LeaseID, 0.3); !errors.Is(err, orchestrator.ErrInvalidTaskResult) {
+		t.Errorf("приближённый результат точной задачи должен отклоняться, получено: %v", err)
+	}
+	if err := before.SetTaskExactResult(sum.ID, sum.LeaseID, big.NewRat(3, 10)); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	after := openTestService(t, cfg, dbPath)
+
+	product, err := after.GetNextTask()
+	if err != nil {
+		t.Fatalf("после перезапуска задача не восстановлена: %v", err)
+	}
+	if !product.Exact || product.Args[0].(*big.Rat).Cmp(big.NewRat(3, 10)) != 0 {
+		t.Fatalf("ожидалась точная задача 3/10 * 3, получено %+v", product)
+	}
+	if err := after.SetTaskExactResult(product.ID, product.LeaseID, big.NewRat(9, 10)); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	expr, err := after.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Status != models.StatusCompleted || expr.ExactResult == nil || expr.ExactResult.String() != "9/10" {
+		t.Errorf("ожидался точный результат 9/10, получено %s/%v", expr.Status, expr.ExactResult)
+	}
+	if expr.Mode != calculation.ModeExact || expr.Precision != 5 {
+		t.Errorf("режим и точность не сохранены: %s, %d", expr.Mode, expr.Precision)
+	}
+}
+
+func TestExactModeRejectsInexactFunctions(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	_, err := service.AddExpressionWithOptions(context.Background(), 1, "sin(1)+1", orchestrator.ExpressionOptions{Mode: calculation.ModeExact})
+	if !errors.Is(err, orchestrator.ErrInvalidExpression) || !errors.Is(err, calculation.ErrInexact) {
+		t.Errorf("ожидалась ошибка неточной функции, получено: %v", err)
+	}
+
+	if _, err := service.AddExpressionWithOptions(context.Background(), 1, "1+1", orchestrator.ExpressionOptions{Mode: "decimal"}); !errors.Is(err, orchestrator.ErrInvalidMode) {
+		t.Errorf("ожидалась ошибка неизвестного режима, получено: %v", err)
+	}
+}
+
+func TestExpressionVariables(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	exprID, err := service.AddExpressionWithOptions(context.Background(), 1, "rate*amount+fee", orchestrator.ExpressionOptions{
+		Variables: map[string]string{"rate": "0.5", "amount": "200", "fee": "3", "unused": "1"},
+	})
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	task, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if task.Operation != "*" || task.Arg1 != 0.5 || task.Arg2 != 200.0 {
+		t.Errorf("ожидалась задача 0.5 * 200, получено %v %s %v", task.Arg1, task.Operation, task.Arg2)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Expression != "rate*amount+fee" {
+		t.Errorf("ожидался исходный шаблон, получено %s", expr.Expression)
+	}
+	if len(expr.Variables) != 3 || expr.Variables["rate"] != "0.5" || expr.Variables["fee"] != "3" {
+		t.Errorf("ожидались использованные привязки rate, amount, fee, получено %v", expr.Variables)
+	}
+
+	_, err = service.AddExpressionWithOptions(context.Background(), 1, "rate*amount", orchestrator.ExpressionOptions{
+		Variables: map[string]string{"rate": "0.5"},
+	})
+	var unbound *calculation.UnboundVariableError
+	if !errors.Is(err, orchestrator.ErrInvalidExpression) || !errors.As(err, &unbound) || unbound.Name != "amount" {
+		t.Errorf("ожидалась ошибка о переменной amount, получено: %v", err)
+	}
+}
+
+func TestTaskErrorFailsExpression(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+
+	exprID, err := service.AddExpression(1, "1/0+2*3-4")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	division, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	product, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	if err := service.SetTaskError(division.ID, division.LeaseID, "division by zero"); err != nil {
+		t.Fatalf("не удалось сообщить об ошибке: %v", err)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.Status != models.StatusFailed {
+		t.Errorf("ожидался статус %s, получен %s", models.StatusFailed, expr.Status)
+	}
+	if expr.Error != "1 / 0: division by zero" {
+		t.Errorf("ожидалась причина '1 / 0: division by zero', получено '%s'", expr.Error)
+	}
+
+	if err := service.SetTaskResult(product.ID, product.LeaseID, 6); !errors.Is(err, orchestrator.ErrExpressionFailed) {
+		t.Errorf("результат задачи упавшего выражения должен отклоняться, получено: %v", err)
+	}
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Errorf("оставшиеся задачи должны сниматься с очереди, получено: %v", err)
+	}
+}
+
+// failingStore fails to create the next expression after its plan was built,
+// the way a write error inside the transaction would.
+type failingStore struct {
+	*memory.Store
+	fail bool
+}
+
+func (s *failingStore) CreateExpression(userID int, expr *models.Expression, plan func(int) (*database.ExpressionPlan, error)) (int, error) {
+	if s.fail {
+		s.fail = false
+		if plan != nil {
+			if _, err := plan(1000); err != nil {
+				return 0, err
+			}
+		}
+		return 0, errors.New("disk full")
+	}
+	return s.Store.CreateExpression(userID, expr, plan)
+}
+
+func TestFailedExpressionLeavesNoTasks(t *testing.T) {
+	store := &failingStore{Store: memory.New(), fail: true}
+	service, err := orchestrator.NewService(&config.Config{LeaseGraceMs: 1000}, store)
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	if _, err := service.AddExpression(1, "(1+2)*3"); err == nil {
+		t.Fatal("ошибка хранилища должна возвращаться")
+	}
+	if _, err := service.GetNextTask(); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Fatalf("задачи несохранённого выражения не должны выдаваться, получено: %v", err)
+	}
+	if expressions, _ := service.GetAllExpressions(1); len(expressions) != 0 {
+		t.Fatalf("несохранённое выражение не должно появляться, получено %+v", expressions)
+	}
+
+	exprID, err := service.AddExpression(1, "(1+2)*3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	task, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := service.SetTaskResult(task.ID, task.LeaseID, 3); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+	task, err = service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := service.SetTaskResult(task.ID, task.LeaseID, 9); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil || expr.Status != models.StatusCompleted || expr.Result == nil || *expr.Result != 9 {
+		t.Errorf("следующее выражение должно вычисляться как обычно: %+v (%v)", expr, err)
+	}
+}
+
+func TestExpressionTimestamps(t *testing.T) {
+	service := newTestService(t, &config.Config{})
+
+	exprID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.CreatedAt.IsZero() || expr.StartedAt != nil || expr.CompletedAt != nil {
+		t.Fatalf("до выдачи задач известно только время создания, получено %v/%v/%v", expr.CreatedAt, expr.StartedAt, expr.CompletedAt)
+	}
+
+	task, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+	if err := service.SetTaskResult(task.ID, task.LeaseID, 5); err != nil {
+		t.Fatalf("не удалось отправить результат: %v", err)
+	}
+
+	expr, err = service.GetExpressionByID(1, exprID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if expr.StartedAt == nil || expr.CompletedAt == nil {
+		t.Fatalf("у завершённого выражения должны быть время начала и завершения, получено %v/%v", expr.StartedAt, expr.CompletedAt)
+	}
+	if expr.StartedAt.Before(expr.CreatedAt) || expr.CompletedAt.Before(*expr.StartedAt) {
+		t.Errorf("время должно идти по порядку: %v, %v, %v", expr.CreatedAt, *expr.StartedAt, *expr.CompletedAt)
+	}
+
+	constID, err := service.AddExpression(1, "-(5)")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	constant, err := service.GetExpressionByID(1, constID)
+	if err != nil {
+		t.Fatalf("не удалось получить выражение: %v", err)
+	}
+	if constant.StartedAt == nil || constant.CompletedAt == nil {
+		t.Errorf("константа завершается сразу, получено %v/%v", constant.StartedAt, constant.CompletedAt)
+	}
+}
+
+// statusWriteStore counts writes of the expression status.
+type statusWriteStore struct {
+	*memory.Store
+	writes int
+}
+
+func (s *statusWriteStore) UpdateExpressionStatus(id int, status models.ExpressionStatus) error {
+	s.writes++
+	return s.Store.UpdateExpressionStatus(id, status)
+}
+
+func (s *statusWriteStore) StartExpression(id int) error {
+	s.writes++
+	return s.Store.StartExpression(id)
+}
+
+func TestPartialResultsDoNotRewriteStatus(t *testing.T) {
+	store := &statusWriteStore{Store: memory.New()}
+	service, err := orchestrator.NewService(&config.Config{LeaseGraceMs: 1000}, store)
+	if err != nil {
+		t.Fatalf("не удалось создать сервис: %v", err)
+	}
+
+	exprID, err := service.AddExpression(1, "(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	expr, err := service.GetExpressionByID(1, exprID)
+	if err != nil || expr.Status != models.StatusPending {
+		t.Fatalf("до выдачи задач выражение должно ожидать, получено %+v (%v)", expr, err)
+	}
+
+	for _, result := range []float64{3, 7} {
+		task, err := service.GetNextTask()
+		if err != nil {
+			t.Fatalf("не удалось получить задачу: %v", err)
+		}
+		if err := service.SetTaskResult(task.ID, task.LeaseID, result); err != nil {
+			t.Fatalf("не удалось сохранить результат: %v", err)
+		}
+	}
+
+	if store.writes != 1 {
+		t.Errorf("статус должен записываться только при первой выдаче задачи, записей: %d", store.writes)
+	}
+	expr, err = service.GetExpressionByID(1, exprID)
+	if err != nil || expr.Status != models.StatusProcessing {
+		t.Errorf("выражение должно вычисляться, получено %+v (%v)", expr, err)
+	}
+}
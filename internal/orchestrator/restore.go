@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+)
+
+func (s *Service) restoreState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxTaskID, err := s.store.GetMaxTaskID()
+	if err != nil {
+		return fmt.Errorf("failed to load last task ID: %w", err)
+	}
+	s.nextTaskID = maxTaskID + 1
+
+	expressions, err := s.store.GetUnfinishedExpressions()
+	if err != nil {
+		return fmt.Errorf("failed to load unfinished expressions: %w", err)
+	}
+
+	for _, expr := range expressions {
+		if err := s.restoreExpression(expr); err != nil {
+			return fmt.Errorf("expression ID=%d: %w", expr.ID, err)
+		}
+	}
+
+	if len(expressions) > 0 {
+		log.Printf("Restored %d unfinished expressions: %d tasks ready, %d waiting for inputs",
+			len(expressions), s.ready.len(), len(s.waiting))
+	}
+
+	return nil
+}
+
+func (s *Service) restoreExpression(expr *models.Expression) error {
+	results, err := s.store.GetTaskResults(expr.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load task results: %w", err)
+	}
+
+	for _, result := range results {
+		s.tasks[result.ID] = &models.Task{
+			ID:           result.ID,
+			ExpressionID: expr.ID,
+		}
+		s.results[getResultID(expr.ID, result.ID)] = &ExpressionResult{
+			Value:     result.Result,
+			Exact:     result.ExactResult,
+			Completed: true,
+		}
+	}
+
+	pending, err := s.store.GetUncompletedTasks(expr.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load uncompleted tasks: %w", err)
+	}
+
+	for _, task := range pending {
+		task.Exact = expr.Mode == calculation.ModeExact
+		// Leases do not survive a restart, so a task that was handed out
+		// waits in the queue again.
+		if task.DispatchedAt != nil {
+			task.AgentID = ""
+			task.DispatchedAt = nil
+			if err := s.store.ClearTaskDispatched(task.ID); err != nil {
+				return fmt.Errorf("failed to clear dispatch of task ID=%d: %w", task.ID, err)
+			}
+		}
+		s.tasks[task.ID] = task
+		s.enqueueTask(task)
+	}
+
+	if len(results) == 0 && len(pending) == 0 {
+		log.Printf("Expression ID=%d has no tasks, marking as failed", expr.ID)
+		return s.store.FailExpression(expr.ID, "no tasks found after restart")
+	}
+
+	s.results[getRootResultID(expr.ID)] = &ExpressionResult{}
+	s.expressions[expr.ID] = expr
+
+	s.checkExpressionCompletion(expr.ID)
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package orchestrator
+
+import (
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+type taskQueue struct {
+	items []*models.Task
+	head  int
+}
+
+func (q *taskQueue) push(task *models.Task) {
+	q.items = append(q.items, task)
+}
+
+func (q *taskQueue) pop() (*models.Task, bool) {
+	if q.head == len(q.items) {
+		return nil, false
+	}
+
+	task := q.items[q.head]
+	q.items[q.head] = nil
+	q.head++
+
+	if q.head == len(q.items) {
+		q.items = q.items[:0]
+		q.head = 0
+	} else if q.head > len(q.items)/2 {
+		q.items = append(q.items[:0], q.items[q.head:]...)
+		q.head = 0
+	}
+
+	return task, true
+}
+
+func (q *taskQueue) len() int {
+	return len(q.items) - q.head
+}
+
+// count returns how many queued tasks match.
+func (q *taskQueue) count(match func(*models.Task) bool) int {
+	n := 0
+	for _, task := range q.items[q.head:] {
+		if match(task) {
+			n++
+		}
+	}
+	return n
+}
+
+// enqueueTask must be called with s.mu held. A task goes straight to the
+// ready queue when all of its inputs are known, otherwise it waits until
+// resolveDependents is called for the last missing one.
+func (s *Service) enqueueTask(task *models.Task) {
+	missing := 0
+	for _, arg := range task.Args {
+		ref, isRef := arg.(string)
+		if !isRef {
+			continue
+		}
+		if result, exists := s.results[ref]; exists && result.Completed {
+			continue
+		}
+		s.dependents[ref] = append(s.dependents[ref], task.ID)
+		missing++
+	}
+
+	if missing > 0 {
+		s.waiting[task.ID] = missing
+		return
+	}
+
+	s.markReady(task)
+}
+
+// resolveDependents must be called with s.mu held once resultID is completed.
+func (s *Service) resolveDependents(resultID string) {
+	for _, taskID := range s.dependents[resultID] {
+		s.waiting[taskID]--
+		if s.waiting[taskID] > 0 {
+			continue
+		}
+
+		delete(s.waiting, taskID)
+		if task, exists := s.tasks[taskID]; exists {
+			s.markReady(task)
+		}
+	}
+
+	delete(s.dependents, resultID)
+}
+
+// markReady must be called with s.mu held. It queues the task and wakes up
+// everyone blocked in WaitForTask.
+func (s *Service) markReady(task *models.Task) {
+	s.ready.push(task)
+	close(s.readySignal)
+	s.readySignal = make(chan struct{})
+}
+
+func (s *Service) resolveArg(arg interface{}) interface{} {
+	if ref, isRef := arg.(string); isRef {
+		if result, exists := s.results[ref]; exists && result.Completed {
+			if result.Exact != nil {
+				return result.Exact
+			}
+			return result.Value
+		}
+	}
+	return arg
+}
+
+// dropPendingTasks must be called with s.mu held. Tasks already in the ready
+// queue are skipped by nextTask, so only the bookkeeping is removed here.
+func (s *Service) dropPendingTasks(expressionID int) {
+	for taskID, task := range s.tasks {
+		if task.ExpressionID != expressionID {
+			continue
+		}
+
+		delete(s.waiting, taskID)
+		if l, exists := s.leases[taskID]; exists {
+			s.revokeLease(l)
+		}
+		delete(s.dependents, getResultID(expressionID, taskID))
+	}
+}
+
+// dispatchable must be called with s.mu held. The ready queue can still hold
+// tasks that were completed after their lease had been requeued and tasks of
+// stopped expressions; they are skipped when reached rather than removed.
+func (s *Service) dispatchable(task *models.Task) bool {
+	if result, exists := s.results[getResultID(task.ExpressionID, task.ID)]; exists && result.Completed {
+		return false
+	}
+	return s.expressionStopped(task.ExpressionID) == nil
+}
+
+// expressionStopped reports whether the tasks of the expression should no
+// longer run because it was cancelled or one of its tasks failed.
+func (s *Service) expressionStopped(expressionID int) error {
+	expr, exists := s.expressions[expressionID]
+	if !exists {
+		return nil
+	}
+
+	switch expr.Status {
+	case models.StatusCancelled:
+		return ErrExpressionCancelled
+	case models.StatusFailed:
+		return ErrExpressionFailed
+	}
+	return nil
+}
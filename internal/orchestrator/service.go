@@ -1,78 +1,235 @@
 package orchestrator
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/neptship/calc-yandex-go/internal/config"
 	"github.com/neptship/calc-yandex-go/internal/database"
 	"github.com/neptship/calc-yandex-go/internal/models"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
 	"github.com/neptship/calc-yandex-go/pkg/calculation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	ErrExpressionNotFound = errors.New("expression not found")
-	ErrTaskNotFound       = errors.New("task not found")
-	ErrInvalidExpression  = errors.New("invalid expression")
-	ErrInvalidTaskResult  = errors.New("invalid task result")
-	ErrUnauthorized       = errors.New("unauthorized")
+	ErrExpressionNotFound   = errors.New("expression not found")
+	ErrTaskNotFound         = errors.New("task not found")
+	ErrInvalidExpression    = errors.New("invalid expression")
+	ErrInvalidTaskResult    = errors.New("invalid task result")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrLeaseExpired         = errors.New("task lease expired or was reassigned")
+	ErrTaskAlreadyCompleted = errors.New("task already completed")
+	ErrLeaseNotHeld         = errors.New("lease held by another agent")
+	ErrExpressionCancelled  = errors.New("expression cancelled")
+	ErrExpressionFailed     = errors.New("expression failed")
+	ErrExpressionFinished   = errors.New("expression already finished")
+	ErrInvalidMode          = errors.New("unknown calculation mode")
 )
 
+// DefaultPrecision is the number of decimal places used to render exact
+// results when the request does not specify one.
+const (
+	DefaultPrecision = 10
+	MaxPrecision     = 1000
+)
+
+// ExpressionResult holds a task result. Exact is set instead of relying on
+// Value for expressions calculated in exact mode.
 type ExpressionResult struct {
 	Value     float64
+	Exact     *big.Rat
 	Completed bool
 }
 
+// ExpressionOptions are the per-request settings of an expression.
+// Variables bind identifiers of the expression to number literals.
+type ExpressionOptions struct {
+	Mode      string
+	Precision int
+	Variables map[string]string
+}
+
+// Store is what the orchestrator keeps expressions and their tasks in.
+type Store interface {
+	database.ExpressionStore
+	database.TaskStore
+}
+
 type Service struct {
-	db     *database.Database
+	store  Store
 	config *config.Config
 	mu     sync.Mutex
 
-	tasks        map[int]*models.Task
-	pendingTasks []*models.Task
-	results      map[string]*ExpressionResult
-	expressions  map[int]*models.Expression
-	nextTaskID   int
+	tasks       map[int]*models.Task
+	waiting     map[int]int
+	dependents  map[string][]int
+	ready       taskQueue
+	readySignal chan struct{}
+	results     map[string]*ExpressionResult
+	expressions map[int]*models.Expression
+	leases      map[int]*lease
+	nextTaskID  int
+	agents      map[string]*registeredAgent
+	// traces holds the span that created each expression in flight, so its
+	// tasks continue that trace on the agents.
+	traces map[int]trace.SpanContext
+	// watchers are the open task streams, told about revoked leases.
+	watchers map[chan RevokedLease]struct{}
+
+	events *EventHub
 }
 
-func NewService(cfg *config.Config, db *database.Database) *Service {
-	return &Service{
-		db:           db,
-		config:       cfg,
-		tasks:        make(map[int]*models.Task),
-		pendingTasks: make([]*models.Task, 0),
-		results:      make(map[string]*ExpressionResult),
-		expressions:  make(map[int]*models.Expression),
-		nextTaskID:   1,
+func NewService(cfg *config.Config, store Store) (*Service, error) {
+	s := &Service{
+		store:       store,
+		config:      cfg,
+		tasks:       make(map[int]*models.Task),
+		waiting:     make(map[int]int),
+		dependents:  make(map[string][]int),
+		results:     make(map[string]*ExpressionResult),
+		expressions: make(map[int]*models.Expression),
+		leases:      make(map[int]*lease),
+		readySignal: make(chan struct{}),
+		watchers:    make(map[chan RevokedLease]struct{}),
+		agents:      make(map[string]*registeredAgent),
+		traces:      make(map[int]trace.SpanContext),
+		nextTaskID:  1,
+		events:      NewEventHub(),
 	}
+
+	if err := s.restoreState(); err != nil {
+		return nil, fmt.Errorf("failed to restore scheduler state: %w", err)
+	}
+
+	return s, nil
 }
 
 func (s *Service) AddExpression(userID int, expressionStr string) (int, error) {
+	return s.AddExpressionWithOptions(context.Background(), userID, expressionStr, ExpressionOptions{})
+}
+
+// AddExpressionWithOptions parses the expression and schedules its tasks.
+// The tasks continue the trace of ctx on the agents.
+func (s *Service) AddExpressionWithOptions(ctx context.Context, userID int, expressionStr string, opts ExpressionOptions) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	ops, err := calculation.ParseExpression(expressionStr)
+	if opts.Mode == "" {
+		opts.Mode = calculation.ModeFloat
+	}
+	if opts.Mode != calculation.ModeFloat && opts.Mode != calculation.ModeExact {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMode, opts.Mode)
+	}
+	if opts.Precision <= 0 {
+		opts.Precision = DefaultPrecision
+	}
+	exact := opts.Mode == calculation.ModeExact
+
+	node, ops, err := parseExpression(ctx, expressionStr, &opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ops) == 0 {
+		result := &ExpressionResult{Completed: true}
+		if exact {
+			result.Exact, err = calculation.EvaluateExact(node)
+			if result.Exact != nil {
+				result.Value, _ = result.Exact.Float64()
+			}
+		} else {
+			result.Value, err = calculation.Evaluate(node)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalidExpression, err)
+		}
+		return s.saveConstantExpression(userID, expressionStr, opts, result)
+	}
+
+	return s.createTasks(ctx, userID, expressionStr, opts, ops)
+}
+
+// parseExpression binds the variables of opts, keeping only the used ones,
+// and compiles the expression into operations.
+func parseExpression(ctx context.Context, expressionStr string, opts *ExpressionOptions) (calculation.Node, []calculation.Operation, error) {
+	_, span := tracing.Tracer().Start(ctx, "parse expression", trace.WithAttributes(
+		attribute.String("expression.mode", opts.Mode),
+		attribute.Int("expression.variables", len(opts.Variables)),
+	))
+	defer span.End()
+
+	template, err := calculation.Parse(expressionStr)
 	if err != nil {
 		log.Printf("Error parsing expression: %v", err)
-		return 0, ErrInvalidExpression
+		tracing.RecordError(span, err)
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidExpression, err)
+	}
+
+	node, err := calculation.ParseWithVariables(expressionStr, opts.Variables)
+	if err != nil {
+		log.Printf("Error binding variables: %v", err)
+		tracing.RecordError(span, err)
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidExpression, err)
 	}
+	opts.Variables = usedVariables(template, opts.Variables)
 
-	expressionID, err := s.db.SaveExpression(userID, expressionStr, models.StatusProcessing)
+	var ops []calculation.Operation
+	if opts.Mode == calculation.ModeExact {
+		ops, err = calculation.CompileExact(node)
+	} else {
+		ops, err = calculation.Compile(node)
+	}
+	if err != nil {
+		log.Printf("Error compiling expression: %v", err)
+		tracing.RecordError(span, err)
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidExpression, err)
+	}
+
+	span.SetAttributes(attribute.Int("expression.operations", len(ops)))
+	return node, ops, nil
+}
+
+// createTasks must be called with s.mu held.
+func (s *Service) createTasks(ctx context.Context, userID int, expressionStr string, opts ExpressionOptions, ops []calculation.Operation) (int, error) {
+	parent := trace.SpanContextFromContext(ctx)
+	_, span := tracing.Tracer().Start(ctx, "create tasks")
+	defer span.End()
+
+	expr := newExpression(expressionStr, models.StatusPending, opts)
+	expr.UserID = userID
+	exact := opts.Mode == calculation.ModeExact
+
+	// The scheduler only learns about the tasks once the store has committed
+	// them, so a failed write leaves nothing behind in either place.
+	var tasks []*models.Task
+	expressionID, err := s.store.CreateExpression(userID, expr, func(expressionID int) (*database.ExpressionPlan, error) {
+		tasks = s.planTasks(expressionID, exact, ops)
+		return &database.ExpressionPlan{Tasks: tasks, RootResultID: getRootResultID(expressionID)}, nil
+	})
 	if err != nil {
 		log.Printf("Error saving expression: %v", err)
+		tracing.RecordError(span, err)
 		return 0, fmt.Errorf("failed to save expression: %w", err)
 	}
+	expr.ID = expressionID
+	span.SetAttributes(attribute.Int("expression.id", expressionID), attribute.Int("expression.tasks", len(tasks)))
 
-	log.Printf("Added expression ID=%d for user ID=%d: %s", expressionID, userID, expressionStr)
+	log.Printf("Added %s expression ID=%d for user ID=%d: %s", opts.Mode, expressionID, userID, expressionStr)
 
-	err = s.createTasksFromOperations(userID, expressionID, ops)
-	if err != nil {
-		log.Printf("Error creating tasks for expression ID=%d: %v", expressionID, err)
-		return 0, fmt.Errorf("failed to create tasks: %w", err)
+	s.scheduleTasks(expressionID, tasks)
+	s.expressions[expressionID] = expr
+	if parent.IsValid() {
+		s.traces[expressionID] = parent
 	}
+	s.publishExpression(expr)
 
 	return expressionID, nil
 }
@@ -86,202 +243,312 @@ func (s *Service) AddSimpleExpression(userID int, expressionStr string) (int, er
 		return 0, ErrInvalidExpression
 	}
 
-	expressionID, err := s.db.SaveExpression(userID, expressionStr, models.StatusCompleted)
+	opts := ExpressionOptions{Mode: calculation.ModeFloat, Precision: DefaultPrecision}
+	return s.saveConstantExpression(userID, expressionStr, opts, &ExpressionResult{Value: value, Completed: true})
+}
+
+func (s *Service) saveConstantExpression(userID int, expressionStr string, opts ExpressionOptions, result *ExpressionResult) (int, error) {
+	expr := newExpression(expressionStr, models.StatusCompleted, opts)
+	expr.UserID = userID
+	expr.Result = &result.Value
+	expr.ExactResult = result.Exact
+	// A constant has nothing to wait for or compute.
+	expr.StartedAt = &expr.CreatedAt
+	expr.CompletedAt = &expr.CreatedAt
+
+	expressionID, err := s.store.CreateExpression(userID, expr, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to save expression: %w", err)
 	}
 
-	err = s.db.SetExpressionResult(expressionID, value)
-	if err != nil {
-		return 0, fmt.Errorf("failed to set expression result: %w", err)
-	}
+	expr.ID = expressionID
+	s.publishExpression(expr)
 
-	log.Printf("Added simple expression ID=%d for user ID=%d: %s = %f", expressionID, userID, expressionStr, value)
+	log.Printf("Added simple expression ID=%d for user ID=%d: %s = %f", expressionID, userID, expressionStr, result.Value)
 	return expressionID, nil
 }
 
+func newExpression(expressionStr string, status models.ExpressionStatus, opts ExpressionOptions) *models.Expression {
+	return &models.Expression{
+		Expression: expressionStr,
+		Status:     status,
+		Mode:       opts.Mode,
+		Precision:  opts.Precision,
+		Variables:  opts.Variables,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// usedVariables keeps only the bindings the expression refers to, so the
+// stored record shows exactly which inputs produced the result.
+func usedVariables(template calculation.Node, variables map[string]string) map[string]string {
+	names := calculation.Variables(template)
+	if len(names) == 0 {
+		return nil
+	}
+
+	used := make(map[string]string, len(names))
+	for _, name := range names {
+		used[name] = variables[name]
+	}
+	return used
+}
+
 func (s *Service) GetExpressionByID(userID, expressionID int) (*models.Expression, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	expr, err := s.db.GetExpression(expressionID)
+	return s.getUserExpression(userID, expressionID)
+}
+
+func (s *Service) getUserExpression(userID, expressionID int) (*models.Expression, error) {
+	expr, err := s.store.GetExpression(expressionID)
 	if err != nil {
 		return nil, ErrExpressionNotFound
 	}
 
-	var exprUserID int
-	err = s.db.GetDB().QueryRow("SELECT user_id FROM expressions WHERE id = ?", expressionID).Scan(&exprUserID)
+	if expr.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	return expr, nil
+}
+
+func (s *Service) CancelExpression(userID, expressionID int) (*models.Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expr, err := s.getUserExpression(userID, expressionID)
 	if err != nil {
-		return nil, ErrExpressionNotFound
+		return nil, err
 	}
 
-	if exprUserID != userID {
-		return nil, ErrUnauthorized
+	if expr.Status != models.StatusPending && expr.Status != models.StatusProcessing {
+		return nil, ErrExpressionFinished
 	}
 
+	if err := s.store.UpdateExpressionStatus(expressionID, models.StatusCancelled); err != nil {
+		return nil, fmt.Errorf("failed to cancel expression: %w", err)
+	}
+
+	expr.Status = models.StatusCancelled
+	s.markCompleted(expr, time.Now())
+	s.expressions[expressionID] = expr
+	s.dropPendingTasks(expressionID)
+	s.publishExpression(expr)
+
+	log.Printf("Expression ID=%d cancelled by user ID=%d", expressionID, userID)
 	return expr, nil
 }
 
 func (s *Service) GetAllExpressions(userID int) ([]*models.Expression, error) {
-	return s.db.GetUserExpressions(userID)
+	return s.store.GetUserExpressions(userID)
 }
 
 func (s *Service) GetNextTask() (*models.Task, error) {
+	return s.AssignTask("")
+}
+
+// AssignTask is GetNextTask for an agent from the registry; the lease is
+// attributed to it and released if the agent stops sending heartbeats.
+func (s *Service) AssignTask(agentID string) (*models.Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for i, task := range s.pendingTasks {
-		canExecute := true
+	return s.nextTask(agentID)
+}
 
-		var arg1 interface{} = task.Arg1
-		if arg1ID, isString := task.Arg1.(string); isString {
-			if result, exists := s.results[arg1ID]; !exists || !result.Completed {
-				canExecute = false
-			} else {
-				arg1 = result.Value
-			}
+// WaitForTask is AssignTask for streaming agents: instead of returning
+// ErrTaskNotFound it blocks until a task becomes ready or ctx is done.
+func (s *Service) WaitForTask(ctx context.Context, agentID string) (*models.Task, error) {
+	for {
+		s.mu.Lock()
+		task, err := s.nextTask(agentID)
+		signal := s.readySignal
+		s.mu.Unlock()
+
+		if !errors.Is(err, ErrTaskNotFound) {
+			return task, err
 		}
 
-		var arg2 interface{} = task.Arg2
-		if arg2ID, isString := task.Arg2.(string); isString {
-			if result, exists := s.results[arg2ID]; !exists || !result.Completed {
-				canExecute = false
-			} else {
-				arg2 = result.Value
-			}
+		select {
+		case <-signal:
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
+	}
+}
 
-		if canExecute {
-			s.pendingTasks = append(s.pendingTasks[:i], s.pendingTasks[i+1:]...)
-
-			taskToExecute := &models.Task{
-				ID:           task.ID,
-				Operation:    task.Operation,
-				Arg1:         arg1,
-				Arg2:         arg2,
-				ExpressionID: task.ExpressionID,
-			}
+// nextTask must be called with s.mu held.
+func (s *Service) nextTask(agentID string) (*models.Task, error) {
+	for {
+		task, ok := s.ready.pop()
+		if !ok {
+			return nil, ErrTaskNotFound
+		}
 
-			switch task.Operation {
-			case "+":
-				taskToExecute.OperationTime = s.config.AdditionMs
-			case "-":
-				taskToExecute.OperationTime = s.config.SubtractionMs
-			case "*":
-				taskToExecute.OperationTime = s.config.MultiplicationMs
-			case "/":
-				taskToExecute.OperationTime = s.config.DivisionMs
-			}
+		if !s.dispatchable(task) {
+			continue
+		}
 
-			log.Printf("Task ID=%d, operation=%s for expression ID=%d assigned",
-				taskToExecute.ID, taskToExecute.Operation, taskToExecute.ExpressionID)
-			return taskToExecute, nil
+		taskToExecute := &models.Task{
+			ID:            task.ID,
+			Operation:     task.Operation,
+			Args:          make([]interface{}, len(task.Args)),
+			OperationTime: s.operationTime(task.Operation),
+			Exact:         task.Exact,
+			ExpressionID:  task.ExpressionID,
 		}
+		for i, arg := range task.Args {
+			taskToExecute.Args[i] = s.resolveArg(arg)
+		}
+		taskToExecute.Arg1, taskToExecute.Arg2 = firstArgs(taskToExecute.Args)
+
+		// The task records the same agent as the lease, so the task graph
+		// never names an agent that is not in the registry.
+		holder := s.registeredAgentID(agentID)
+		l := &lease{
+			ID:       newLeaseID(),
+			TaskID:   task.ID,
+			AgentID:  holder,
+			Deadline: time.Now().Add(s.leaseDuration(taskToExecute.OperationTime)),
+		}
+		s.leases[task.ID] = l
+		s.markDispatched(task, holder, time.Now())
+		taskToExecute.LeaseID = l.ID
+		taskToExecute.LeaseExpires = l.Deadline.UnixMilli()
+
+		log.Printf("Task ID=%d, operation=%s for expression ID=%d assigned with lease %s",
+			taskToExecute.ID, taskToExecute.Operation, taskToExecute.ExpressionID, l.ID)
+		return taskToExecute, nil
 	}
+}
 
-	return nil, ErrTaskNotFound
+func (s *Service) SetTaskResult(id int, leaseID string, result float64) error {
+	return s.setTaskResult(id, leaseID, &ExpressionResult{Value: result, Completed: true})
 }
 
-func (s *Service) SetTaskResult(id int, result float64) error {
+// SetTaskExactResult accepts the result of a task of an exact-mode expression.
+func (s *Service) SetTaskExactResult(id int, leaseID string, result *big.Rat) error {
+	value, _ := result.Float64()
+	return s.setTaskResult(id, leaseID, &ExpressionResult{Value: value, Exact: result, Completed: true})
+}
+
+func (s *Service) setTaskResult(id int, leaseID string, result *ExpressionResult) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	task, exists := s.tasks[id]
-	if !exists {
-		return ErrTaskNotFound
+	if err := s.checkLease(id, leaseID); err != nil {
+		return err
 	}
+	task := s.tasks[id]
 
-	err := s.db.SetTaskResult(id, result)
+	if task.Exact != (result.Exact != nil) {
+		return ErrInvalidTaskResult
+	}
+
+	var err error
+	if result.Exact != nil {
+		err = s.store.SetTaskExactResult(id, result.Exact)
+	} else {
+		err = s.store.SetTaskResult(id, result.Value)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to save task result: %w", err)
 	}
+	s.finishLease(id, false)
+	s.markFinished(task, time.Now())
 
 	resultID := getResultID(task.ExpressionID, id)
-	s.results[resultID] = &ExpressionResult{
-		Value:     result,
-		Completed: true,
-	}
+	s.results[resultID] = result
+
+	s.resolveDependents(resultID)
+	s.publishTask(task, models.StatusCompleted)
 
-	log.Printf("Received result for task ID=%d: %f", id, result)
+	log.Printf("Received result for task ID=%d: %f", id, result.Value)
 
 	s.checkExpressionCompletion(task.ExpressionID)
 
 	return nil
 }
 
-func (s *Service) createTasksFromOperations(userID, expressionID int, ops []calculation.Operation) error {
+// planTasks turns the compiled operations into tasks without touching the
+// scheduler. Task IDs continue from s.nextTaskID; scheduleTasks claims them.
+func (s *Service) planTasks(expressionID int, exact bool, ops []calculation.Operation) []*models.Task {
+	tasks := make([]*models.Task, len(ops))
 	opToTaskMap := make(map[int]int)
 
 	for i, op := range ops {
-		taskID := s.nextTaskID
-		s.nextTaskID++
+		taskID := s.nextTaskID + i
 
 		task := &models.Task{
 			ID:           taskID,
 			Operation:    op.Operator,
+			Exact:        exact,
 			ExpressionID: expressionID,
 		}
 
 		opToTaskMap[i+1] = taskID
 
-		if leftID, isLeftTaskID := op.Left.(int); isLeftTaskID {
-			actualTaskID := opToTaskMap[leftID]
-			leftTaskResultID := getResultID(expressionID, actualTaskID)
-			task.Arg1 = leftTaskResultID
-		} else {
-			task.Arg1 = op.Left
+		task.Args = make([]interface{}, len(op.Args))
+		for j, arg := range op.Args {
+			if argID, isTaskID := arg.(int); isTaskID {
+				task.Args[j] = getResultID(expressionID, opToTaskMap[argID])
+			} else {
+				task.Args[j] = arg
+			}
 		}
+		task.Arg1, task.Arg2 = firstArgs(task.Args)
 
-		if rightID, isRightTaskID := op.Right.(int); isRightTaskID {
-			actualTaskID := opToTaskMap[rightID]
-			rightTaskResultID := getResultID(expressionID, actualTaskID)
-			task.Arg2 = rightTaskResultID
-		} else {
-			task.Arg2 = op.Right
-		}
+		tasks[i] = task
+	}
 
-		s.tasks[taskID] = task
-		s.pendingTasks = append(s.pendingTasks, task)
+	return tasks
+}
 
-		dbTaskID, err := s.db.SaveTask(task)
-		if err != nil {
-			return fmt.Errorf("failed to save task to database: %w", err)
-		}
+// scheduleTasks must be called with s.mu held, after the tasks of planTasks
+// were stored.
+func (s *Service) scheduleTasks(expressionID int, tasks []*models.Task) {
+	for _, task := range tasks {
+		s.tasks[task.ID] = task
+		s.enqueueTask(task)
 
-		if dbTaskID != taskID {
-			log.Printf("Warning: memory taskID %d differs from database taskID %d", taskID, dbTaskID)
+		if task.ID >= s.nextTaskID {
+			s.nextTaskID = task.ID + 1
 		}
 
 		log.Printf("Created task ID=%d (%s) for expression ID=%d",
-			taskID, task.Operation, expressionID)
-
-		if i == len(ops)-1 {
-			rootID := getRootResultID(expressionID)
-			s.results[rootID] = &ExpressionResult{
-				Value:     0,
-				Completed: false,
-			}
+			task.ID, task.Operation, expressionID)
+	}
 
-			err := s.db.SaveResult(rootID, expressionID, &taskID, 0, false)
-			if err != nil {
-				return fmt.Errorf("failed to save root result: %w", err)
-			}
+	if len(tasks) > 0 {
+		s.results[getRootResultID(expressionID)] = &ExpressionResult{
+			Value:     0,
+			Completed: false,
 		}
 	}
+}
 
-	return nil
+// loadExpression must be called with s.mu held. It returns the cached
+// expression, loading it from the database on first use.
+func (s *Service) loadExpression(expressionID int) (*models.Expression, error) {
+	if expr, exists := s.expressions[expressionID]; exists {
+		return expr, nil
+	}
+
+	expr, err := s.store.GetExpression(expressionID)
+	if err != nil {
+		return nil, err
+	}
+	s.expressions[expressionID] = expr
+	return expr, nil
 }
 
 func (s *Service) checkExpressionCompletion(expressionID int) {
-	expr, exists := s.expressions[expressionID]
-	if !exists {
-		dbExpr, err := s.db.GetExpression(expressionID)
-		if err != nil {
-			log.Printf("Error loading expression ID=%d: %v", expressionID, err)
-			return
-		}
-		expr = dbExpr
-		s.expressions[expressionID] = expr
+	expr, err := s.loadExpression(expressionID)
+	if err != nil {
+		log.Printf("Error loading expression ID=%d: %v", expressionID, err)
+		return
 	}
 
 	var lastTaskID int
@@ -298,55 +565,82 @@ func (s *Service) checkExpressionCompletion(expressionID int) {
 		if exists && result.Completed {
 			expr.Status = models.StatusCompleted
 			expr.Result = &result.Value
+			expr.ExactResult = result.Exact
+			s.markCompleted(expr, time.Now())
 
-			err := s.db.SetExpressionResult(expressionID, result.Value)
+			var err error
+			if result.Exact != nil {
+				err = s.store.SetExpressionExactResult(expressionID, result.Exact)
+			} else {
+				err = s.store.SetExpressionResult(expressionID, result.Value)
+			}
 			if err != nil {
 				log.Printf("Error updating expression result in database: %v", err)
 			}
 
+			s.publishExpression(expr)
+
 			log.Printf("Expression ID=%d completed successfully, result=%f",
 				expressionID, result.Value)
 			return
 		}
 	}
 
-	totalTasks := 0
-	completedTasks := 0
-
-	for _, task := range s.tasks {
-		if task.ExpressionID == expressionID {
-			totalTasks++
-			resultID := getResultID(expressionID, task.ID)
-			result, exists := s.results[resultID]
-			if exists && result.Completed {
-				completedTasks++
-			}
-		}
-	}
+	completedTasks, totalTasks := s.taskProgress(expressionID)
 
 	if totalTasks > 0 && completedTasks == totalTasks && expr.Status != models.StatusCompleted {
-		expr.Status = models.StatusFailed
-
-		err := s.db.UpdateExpressionStatus(expressionID, models.StatusFailed)
-		if err != nil {
-			log.Printf("Error updating expression status in database: %v", err)
-		}
-
-		log.Printf("Expression ID=%d marked as FAILED: all tasks completed but no final result",
-			expressionID)
+		s.failExpression(expressionID, "all tasks completed but no final result")
 	} else if completedTasks < totalTasks {
-		expr.Status = models.StatusProcessing
-
-		err := s.db.UpdateExpressionStatus(expressionID, models.StatusProcessing)
-		if err != nil {
-			log.Printf("Error updating expression status in database: %v", err)
-		}
-
 		log.Printf("Expression ID=%d in progress: %d/%d tasks completed",
 			expressionID, completedTasks, totalTasks)
 	}
 }
 
+func (s *Service) operationTime(operation string) int {
+	switch operation {
+	case "+":
+		return s.config.AdditionMs
+	case "-":
+		return s.config.SubtractionMs
+	case "*":
+		return s.config.MultiplicationMs
+	case "/":
+		return s.config.DivisionMs
+	case "^":
+		return s.config.PowerMs
+	case "sqrt":
+		return s.config.SqrtMs
+	case "abs":
+		return s.config.AbsMs
+	case "sin":
+		return s.config.SinMs
+	case "cos":
+		return s.config.CosMs
+	case "log":
+		return s.config.LogMs
+	case "min":
+		return s.config.MinMs
+	case "max":
+		return s.config.MaxMs
+	case "round":
+		return s.config.RoundMs
+	}
+	return 0
+}
+
+// firstArgs fills the legacy arg1/arg2 fields read by agents that predate
+// variable-arity operations.
+func firstArgs(args []interface{}) (interface{}, interface{}) {
+	var arg1, arg2 interface{}
+	if len(args) > 0 {
+		arg1 = args[0]
+	}
+	if len(args) > 1 {
+		arg2 = args[1]
+	}
+	return arg1, arg2
+}
+
 func getResultID(expressionID, taskID int) string {
 	return fmt.Sprintf("expr_%d_task_%d", expressionID, taskID)
 }
@@ -355,14 +649,18 @@ func getRootResultID(expressionID int) string {
 	return fmt.Sprintf("expr_%d_root", expressionID)
 }
 
-func (s *Service) SetTaskError(id int, errorMsg string) error {
+// SetTaskError fails the whole expression: its remaining tasks are dropped
+// and the reason, prefixed with the failing operation, is stored with it.
+func (s *Service) SetTaskError(id int, leaseID string, errorMsg string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	task, exists := s.tasks[id]
-	if !exists {
-		return ErrTaskNotFound
+	if err := s.checkLease(id, leaseID); err != nil {
+		return err
 	}
+	task := s.tasks[id]
+	s.finishLease(id, true)
+	s.markFinished(task, time.Now())
 
 	resultID := getResultID(task.ExpressionID, id)
 	s.results[resultID] = &ExpressionResult{
@@ -370,22 +668,119 @@ func (s *Service) SetTaskError(id int, errorMsg string) error {
 		Completed: true,
 	}
 
-	err := s.db.SaveResult(resultID, task.ExpressionID, &id, 0, true)
+	err := s.store.SaveResult(resultID, task.ExpressionID, &id, 0, true)
 	if err != nil {
 		log.Printf("Error saving result to database: %v", err)
 	}
 
 	log.Printf("Task ID=%d failed with error: %s", id, errorMsg)
+	s.publishTask(task, models.StatusFailed)
 
-	expr, exists := s.expressions[task.ExpressionID]
-	if exists {
+	if errorMsg == "" {
+		errorMsg = "calculation error"
+	}
+	s.failExpression(task.ExpressionID, s.describeTask(task)+": "+errorMsg)
+
+	return nil
+}
+
+// failExpression must be called with s.mu held.
+func (s *Service) failExpression(expressionID int, reason string) {
+	if err := s.store.FailExpression(expressionID, reason); err != nil {
+		log.Printf("Error updating expression status in database: %v", err)
+	}
+
+	if expr, err := s.loadExpression(expressionID); err == nil {
 		expr.Status = models.StatusFailed
+		expr.Error = reason
+		s.markCompleted(expr, time.Now())
+		s.publishExpression(expr)
+	}
+	s.dropPendingTasks(expressionID)
 
-		err := s.db.UpdateExpressionStatus(task.ExpressionID, models.StatusFailed)
-		if err != nil {
+	log.Printf("Expression ID=%d marked as FAILED: %s", expressionID, reason)
+}
+
+// markDispatched must be called with s.mu held. An expression starts when
+// the first of its tasks is dispatched.
+func (s *Service) markDispatched(task *models.Task, agentID string, at time.Time) {
+	at = at.UTC()
+	task.AgentID = agentID
+	task.DispatchedAt = &at
+
+	if err := s.store.SetTaskDispatched(task.ID, agentID, at); err != nil {
+		log.Printf("Error saving dispatch time of task ID=%d: %v", task.ID, err)
+	}
+	if err := s.store.SetExpressionStartedAt(task.ExpressionID, at); err != nil {
+		log.Printf("Error saving start time of expression ID=%d: %v", task.ExpressionID, err)
+	}
+	expr, exists := s.expressions[task.ExpressionID]
+	if !exists {
+		return
+	}
+	if expr.StartedAt == nil {
+		expr.StartedAt = &at
+	}
+	// Only the first dispatch moves the expression out of pending; later
+	// ones leave the stored status alone.
+	if expr.Status == models.StatusPending {
+		expr.Status = models.StatusProcessing
+		if err := s.store.StartExpression(task.ExpressionID); err != nil {
 			log.Printf("Error updating expression status in database: %v", err)
 		}
+		s.publishExpression(expr)
 	}
+}
 
-	return nil
+// requeueTask must be called with s.mu held, once the lease of the task is
+// gone. The task counts as not dispatched until it is handed out again.
+func (s *Service) requeueTask(task *models.Task) {
+	task.AgentID = ""
+	task.DispatchedAt = nil
+
+	if err := s.store.ClearTaskDispatched(task.ID); err != nil {
+		log.Printf("Error clearing dispatch of task ID=%d: %v", task.ID, err)
+	}
+	s.markReady(task)
+}
+
+// markFinished must be called with s.mu held.
+func (s *Service) markFinished(task *models.Task, at time.Time) {
+	at = at.UTC()
+	task.FinishedAt = &at
+
+	if err := s.store.SetTaskFinishedAt(task.ID, at); err != nil {
+		log.Printf("Error saving finish time of task ID=%d: %v", task.ID, err)
+	}
+	s.observeTask(task)
+}
+
+// markCompleted must be called with s.mu held, when the expression has
+// completed, failed or been cancelled.
+func (s *Service) markCompleted(expr *models.Expression, at time.Time) {
+	at = at.UTC()
+	expr.CompletedAt = &at
+	delete(s.traces, expr.ID)
+
+	if err := s.store.SetExpressionCompletedAt(expr.ID, at); err != nil {
+		log.Printf("Error saving completion time of expression ID=%d: %v", expr.ID, err)
+	}
+}
+
+// describeTask renders the operation of a task with its known operands,
+// e.g. "5 / 0" or "sqrt(-1)".
+func (s *Service) describeTask(task *models.Task) string {
+	args := make([]string, len(task.Args))
+	for i, arg := range task.Args {
+		switch v := s.resolveArg(arg).(type) {
+		case float64:
+			args[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case *big.Rat:
+			args[i] = v.RatString()
+		default:
+			args[i] = fmt.Sprint(v)
+		}
+	}
+
+	return formatOperation(task.Operation, args)
 }
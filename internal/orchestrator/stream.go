@@ -0,0 +1,237 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/database"
+	"github.com/neptship/calc-yandex-go/internal/models"
+)
+
+// streamHeartbeat keeps proxies from closing idle streams and lets the
+// server notice clients that went away.
+const streamHeartbeat = 15 * time.Second
+
+const (
+	// wsReadLimit caps messages from WebSocket clients, which are not
+	// expected to send anything but control frames.
+	wsReadLimit = 512
+	// wsCloseTimeout is how long the server waits for the client to answer
+	// its close frame.
+	wsCloseTimeout = 5 * time.Second
+)
+
+// A snapshot holds the unfinished expressions of the user and only the
+// latest finished ones, so reconnecting does not load the whole history.
+const (
+	snapshotUnfinishedLimit = 1000
+	snapshotFinishedLimit   = 50
+)
+
+// StreamHandler pushes expression events of the authenticated user. Clients
+// that send a WebSocket upgrade get JSON text messages; everyone else gets
+// Server-Sent Events. A reconnecting client passes the last event ID it saw
+// in the Last-Event-ID header (sent automatically by EventSource) or in the
+// last_event_id query parameter and receives what it missed; if that is no
+// longer known, it first receives the current state of all its expressions.
+func StreamHandler(service *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("userID").(int)
+
+		lastEventID, err := lastEventIDParam(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid Last-Event-ID",
+			})
+		}
+
+		if websocket.IsWebSocketUpgrade(c) {
+			return websocket.New(func(conn *websocket.Conn) {
+				service.streamWebSocket(userID, lastEventID, conn)
+			})(c)
+		}
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			fmt.Fprint(w, "retry: 1000\n\n")
+			if w.Flush() != nil {
+				return
+			}
+
+			service.streamEvents(userID, lastEventID, nil, func(event Event) error {
+				if err := writeSSE(w, event); err != nil {
+					return err
+				}
+				return w.Flush()
+			}, func() error {
+				fmt.Fprint(w, ": heartbeat\n\n")
+				return w.Flush()
+			})
+		})
+
+		return nil
+	}
+}
+
+// streamWebSocket sends events as JSON text messages. Messages from the
+// client are discarded; a missing pong or a close frame ends the stream,
+// which is closed with the full closing handshake.
+func (s *Service) streamWebSocket(userID int, lastEventID int64, conn *websocket.Conn) {
+	done := make(chan struct{})
+
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s.streamEvents(userID, lastEventID, done, func(event Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(streamHeartbeat))
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamHeartbeat))
+	})
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(wsCloseTimeout)) != nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(wsCloseTimeout):
+	}
+}
+
+// streamEvents delivers a snapshot or backlog followed by live events until
+// send fails, done is closed or the subscriber falls behind. heartbeat may be
+// nil for transports with their own keep-alive.
+func (s *Service) streamEvents(userID int, lastEventID int64, done <-chan struct{}, send func(Event) error, heartbeat func() error) {
+	sub := s.events.Subscribe(userID, lastEventID)
+	defer sub.Close()
+
+	initial := sub.Backlog
+	if !sub.Complete {
+		snapshot, err := s.snapshotEvents(userID, sub.Position)
+		if err != nil {
+			log.Printf("Error loading expressions for stream of user ID=%d: %v", userID, err)
+			return
+		}
+		initial = snapshot
+	}
+
+	for _, event := range initial {
+		if send(event) != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if send(event) != nil {
+				return
+			}
+		case <-ticker.C:
+			if heartbeat != nil && heartbeat() != nil {
+				return
+			}
+		}
+	}
+}
+
+// snapshotEvents describes the current state of the unfinished expressions
+// of the user and of the latest finished ones, oldest first. The events share
+// the ID of the latest published event, so a client that reconnects after
+// the snapshot resumes from that point.
+func (s *Service) snapshotEvents(userID int, position int64) ([]Event, error) {
+	var expressions []*models.Expression
+	for _, query := range []database.ExpressionQuery{
+		{
+			UserID:     userID,
+			Statuses:   []models.ExpressionStatus{models.StatusPending, models.StatusProcessing},
+			Descending: true,
+			Limit:      snapshotUnfinishedLimit,
+		},
+		{
+			UserID:     userID,
+			Statuses:   []models.ExpressionStatus{models.StatusCompleted, models.StatusFailed, models.StatusCancelled},
+			Descending: true,
+			Limit:      snapshotFinishedLimit,
+		},
+	} {
+		page, _, err := s.store.ListExpressions(query)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, page...)
+	}
+	sort.SliceStable(expressions, func(i, j int) bool { return expressions[i].ID < expressions[j].ID })
+
+	events := make([]Event, 0, len(expressions))
+	for i, expr := range expressions {
+		// An expression that finished between the two queries is in both;
+		// the finished state comes second.
+		if i+1 < len(expressions) && expressions[i+1].ID == expr.ID {
+			continue
+		}
+		event := expressionEvent(expr)
+		event.ID = position
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func writeSSE(w *bufio.Writer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+func lastEventIDParam(c *fiber.Ctx) (int64, error) {
+	value := c.Get("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
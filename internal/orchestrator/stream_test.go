@@ -0,0 +1,221 @@
+package orchestrator_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/orchestrator"
+)
+
+type sseEvent struct {
+	id    string
+	event orchestrator.Event
+}
+
+func startStreamServer(t *testing.T, service *orchestrator.Service) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", 1)
+		return c.Next()
+	})
+	app.Get("/stream", orchestrator.StreamHandler(service))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("не удалось открыть порт: %v", err)
+	}
+	go app.Listener(lis)
+	t.Cleanup(func() { app.ShutdownWithTimeout(100 * time.Millisecond) })
+
+	return "http://" + lis.Addr().String() + "/stream"
+}
+
+func openSSE(t *testing.T, url, lastEventID string) <-chan sseEvent {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("не удалось подключиться к потоку: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("ожидался text/event-stream, получено %s", ct)
+	}
+
+	events := make(chan sseEvent, 64)
+	go func() {
+		defer close(events)
+
+		scanner := bufio.NewScanner(resp.Body)
+		var current sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				current.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.event)
+			case line == "" && current.event.Type != "":
+				events <- current
+				current = sseEvent{}
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("поток событий закрылся")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("событие не пришло")
+	}
+	return sseEvent{}
+}
+
+func TestExpressionEventStream(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+	url := startStreamServer(t, service)
+
+	events := openSSE(t, url, "")
+
+	exprID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	created := nextEvent(t, events)
+	if created.event.Type != orchestrator.EventExpression || created.event.ExpressionID != exprID || created.event.Status != "pending" {
+		t.Fatalf("ожидалось событие о новом выражении, получено %+v", created.event)
+	}
+
+	task, err := service.GetNextTask()
+	if err != nil {
+		t.Fatalf("не удалось получить задачу: %v", err)
+	}
+
+	started := nextEvent(t, events)
+	if started.event.ExpressionID != exprID || started.event.Status != "processing" {
+		t.Fatalf("ожидалось начало вычисления, получено %+v", started.event)
+	}
+	if err := service.SetTaskResult(task.ID, task.LeaseID, 5); err != nil {
+		t.Fatalf("не удалось сохранить результат: %v", err)
+	}
+
+	progress := nextEvent(t, events)
+	if progress.event.Type != orchestrator.EventTask || progress.event.TaskID != task.ID ||
+		progress.event.CompletedTasks != 1 || progress.event.TotalTasks != 1 {
+		t.Fatalf("ожидалось событие о задаче, получено %+v", progress.event)
+	}
+
+	completed := nextEvent(t, events)
+	if completed.event.Status != "completed" || completed.event.Result == nil || *completed.event.Result != 5 {
+		t.Fatalf("ожидалось завершение с результатом 5, получено %+v", completed.event)
+	}
+
+	resumed := openSSE(t, url, started.id)
+	if replay := nextEvent(t, resumed); replay.id != progress.id {
+		t.Errorf("после переподключения ожидалось событие %s, получено %s", progress.id, replay.id)
+	}
+	if replay := nextEvent(t, resumed); replay.id != completed.id {
+		t.Errorf("после переподключения ожидалось событие %s, получено %s", completed.id, replay.id)
+	}
+
+	stale, _ := strconv.ParseInt(created.id, 10, 64)
+	snapshot := openSSE(t, url, strconv.FormatInt(stale-1_000_000, 10))
+	if state := nextEvent(t, snapshot); state.event.ExpressionID != exprID || state.event.Status != "completed" {
+		t.Errorf("для устаревшего Last-Event-ID ожидался снимок состояния, получено %+v", state.event)
+	}
+}
+
+func TestExpressionEventStreamOverWebSocket(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+	url := startStreamServer(t, service)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("не удалось подключиться по WebSocket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	exprID, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+
+	var created orchestrator.Event
+	if err := conn.ReadJSON(&created); err != nil {
+		t.Fatalf("не удалось прочитать событие: %v", err)
+	}
+	if created.Type != orchestrator.EventExpression || created.ExpressionID != exprID {
+		t.Fatalf("ожидалось событие о новом выражении, получено %+v", created)
+	}
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := conn.WriteMessage(websocket.CloseMessage, closeMessage); err != nil {
+		t.Fatalf("не удалось отправить close: %v", err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("сервер должен ответить на close, получено %v", err)
+	}
+}
+
+func TestSnapshotSkipsOldFinishedExpressions(t *testing.T) {
+	service := newTestService(t, &config.Config{LeaseGraceMs: 1000})
+	url := startStreamServer(t, service)
+
+	unfinished, err := service.AddExpression(1, "2+3")
+	if err != nil {
+		t.Fatalf("не удалось добавить выражение: %v", err)
+	}
+	var last int
+	for i := 0; i < 60; i++ {
+		if last, err = service.AddExpression(1, "7"); err != nil {
+			t.Fatalf("не удалось добавить выражение: %v", err)
+		}
+	}
+
+	events := openSSE(t, url, "")
+	first := nextEvent(t, events)
+	if first.event.ExpressionID != unfinished || first.event.Status != "pending" {
+		t.Fatalf("снимок должен начинаться с незавершённого выражения, получено %+v", first.event)
+	}
+
+	count, latest := 1, first
+	for done := false; !done; {
+		select {
+		case event := <-events:
+			count++
+			latest = event
+		case <-time.After(200 * time.Millisecond):
+			done = true
+		}
+	}
+	if count != 51 || latest.event.ExpressionID != last {
+		t.Errorf("ожидался снимок из 51 выражения, заканчивающийся %d, получено %d до %d", last, count, latest.event.ExpressionID)
+	}
+}
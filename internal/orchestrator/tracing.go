@@ -0,0 +1,22 @@
+package orchestrator
+
+import (
+	"context"
+
+	"github.com/neptship/calc-yandex-go/internal/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TaskContext returns ctx continuing the trace of the request that created
+// the expression of task. Expressions restored after a restart have no
+// trace and ctx is returned as is.
+func (s *Service) TaskContext(ctx context.Context, task *models.Task) context.Context {
+	s.mu.Lock()
+	parent, exists := s.traces[task.ExpressionID]
+	s.mu.Unlock()
+
+	if !exists {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, parent)
+}
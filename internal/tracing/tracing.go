@@ -0,0 +1,157 @@
+// Package tracing sets up OpenTelemetry tracing and carries the trace of an
+// expression between the orchestrator and the agents. Without Setup spans
+// are not recorded, but the trace context is still propagated.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// Exporters accepted in TRACING_EXPORTER.
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+const instrumentationName = "github.com/neptship/calc-yandex-go"
+
+// The orchestrator and the agents always speak W3C trace context, whatever
+// the global propagator is.
+var propagator = propagation.TraceContext{}
+
+// Tracer returns the tracer of the global provider installed by Setup.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs a global tracer provider exporting spans of the named
+// service as configured by cfg.TracingExporter. The returned function
+// flushes the remaining spans and must be called before exiting.
+func Setup(ctx context.Context, cfg *config.Config, serviceName string) (func(context.Context) error, error) {
+	var (
+		processor sdktrace.SpanProcessor
+		closeFile func() error
+	)
+
+	switch cfg.TracingExporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.TracingOTLPEndpoint)}
+		if cfg.TracingOTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case ExporterFile:
+		if err := os.MkdirAll(filepath.Dir(cfg.TracingFile), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create trace directory: %w", err)
+		}
+		file, err := os.OpenFile(cfg.TracingFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		// Spans are written as they end, so the file is complete even if
+		// the process is killed.
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+		closeFile = file.Close
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.TracingExporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// RecordError marks span as failed with err.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Inject returns the trace context of ctx for a message field.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns ctx continuing the trace context of a message field.
+func Extract(ctx context.Context, fields map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(fields))
+}
+
+// InjectMetadata adds the trace context of ctx to md.
+func InjectMetadata(ctx context.Context, md metadata.MD) {
+	propagator.Inject(ctx, metadataCarrier(md))
+}
+
+// ExtractMetadata returns ctx continuing the trace context found in md.
+func ExtractMetadata(ctx context.Context, md metadata.MD) context.Context {
+	return propagator.Extract(ctx, metadataCarrier(md))
+}
+
+// metadataCarrier lets the propagator read and write gRPC metadata, whose
+// keys are lower case.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,80 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/internal/config"
+	"github.com/neptship/calc-yandex-go/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFileExporterWritesSpans(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	shutdown, err := tracing.Setup(context.Background(), &config.Config{
+		TracingExporter: tracing.ExporterFile,
+		TracingFile:     path,
+	}, "calc-test")
+	if err != nil {
+		t.Fatalf("не удалось настроить трассировку: %v", err)
+	}
+
+	_, span := tracing.Tracer().Start(context.Background(), "CalculateHandler")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("не удалось завершить трассировку: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("не удалось прочитать файл трасс: %v", err)
+	}
+	for _, want := range []string{`"Name":"CalculateHandler"`, span.SpanContext().TraceID().String(), "calc-test"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("в файле трасс нет %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "zipkin"}, "calc-test"); err == nil {
+		t.Fatal("ожидалась ошибка для неизвестного экспортёра")
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+
+	md := metadata.MD{}
+	tracing.InjectMetadata(ctx, md)
+	if len(md.Get("traceparent")) != 1 {
+		t.Fatalf("в метаданных нет traceparent: %v", md)
+	}
+
+	got := trace.SpanContextFromContext(tracing.ExtractMetadata(context.Background(), md))
+	if got.TraceID() != parent.TraceID() || got.SpanID() != parent.SpanID() || !got.IsRemote() {
+		t.Fatalf("ожидался удалённый контекст %v, получено %v", parent, got)
+	}
+
+	fields := tracing.Inject(ctx)
+	if got := trace.SpanContextFromContext(tracing.Extract(context.Background(), fields)); got.TraceID() != parent.TraceID() {
+		t.Fatalf("контекст не восстановлен из полей сообщения: %v", fields)
+	}
+	if tracing.Inject(context.Background()) != nil {
+		t.Fatal("без трассы поля сообщения должны быть пустыми")
+	}
+}
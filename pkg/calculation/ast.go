@@ -0,0 +1,270 @@
+package calculation
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Node is an expression tree produced by Parse. The same tree is evaluated
+// locally by Evaluate and split into agent tasks by Compile, so both paths
+// share one grammar and one set of semantics.
+type Node interface {
+	// String prints the expression in canonical form: single spaces around
+	// binary operators and only the parentheses the grammar requires.
+	String() string
+	// Pos is the byte offset of the node in the parsed input.
+	Pos() int
+	precedence() int
+}
+
+// Number keeps the literal as written so exact mode can read "0.1" as 1/10
+// rather than as the nearest float64.
+type Number struct {
+	Value  float64
+	Text   string
+	Offset int
+}
+
+// Variable is an identifier bound to a value at submission time. Trees
+// containing variables must go through Bind before evaluation.
+type Variable struct {
+	Name   string
+	Offset int
+}
+
+type Unary struct {
+	Op      string
+	Operand Node
+	Offset  int
+}
+
+type Binary struct {
+	Op     string
+	Left   Node
+	Right  Node
+	Offset int
+}
+
+type Call struct {
+	Name   string
+	Args   []Node
+	Offset int
+}
+
+func (n *Number) Pos() int   { return n.Offset }
+func (n *Variable) Pos() int { return n.Offset }
+func (n *Unary) Pos() int    { return n.Offset }
+func (n *Binary) Pos() int   { return n.Offset }
+func (n *Call) Pos() int     { return n.Offset }
+
+func (n *Number) precedence() int   { return bpAtom }
+func (n *Variable) precedence() int { return bpAtom }
+func (n *Unary) precedence() int    { return bpUnary }
+func (n *Binary) precedence() int   { return binaryPrecedence(n.Op) }
+func (n *Call) precedence() int     { return bpAtom }
+
+func binaryPrecedence(op string) int {
+	switch op {
+	case "+", "-":
+		return bpSum
+	case "*", "/":
+		return bpProduct
+	case "^":
+		return bpPower
+	}
+	return bpAtom
+}
+
+func (n *Number) String() string {
+	text := strconv.FormatFloat(n.Value, 'g', -1, 64)
+	if n.Value < 0 {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func (n *Variable) String() string {
+	return n.Name
+}
+
+func (n *Unary) String() string {
+	return n.Op + wrap(n.Operand, n.Operand.precedence() < bpUnary)
+}
+
+func (n *Binary) String() string {
+	prec := n.precedence()
+
+	var left, right bool
+	if n.Op == "^" {
+		left = n.Left.precedence() <= prec
+		_, unary := n.Right.(*Unary)
+		right = n.Right.precedence() < prec && !unary
+	} else {
+		left = n.Left.precedence() < prec
+		right = n.Right.precedence() <= prec
+	}
+
+	return wrap(n.Left, left) + " " + n.Op + " " + wrap(n.Right, right)
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func wrap(node Node, parens bool) string {
+	if parens {
+		return "(" + node.String() + ")"
+	}
+	return node.String()
+}
+
+// Evaluate computes the value of the tree in the current process.
+func Evaluate(node Node) (float64, error) {
+	switch n := node.(type) {
+	case *Number:
+		return n.Value, nil
+
+	case *Variable:
+		return 0, &UnboundVariableError{Name: n.Name, Offset: n.Offset}
+
+	case *Unary:
+		value, err := Evaluate(n.Operand)
+		if err != nil {
+			return 0, err
+		}
+		return -value, nil
+
+	case *Binary:
+		left, err := Evaluate(n.Left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := Evaluate(n.Right)
+		if err != nil {
+			return 0, err
+		}
+		return EvaluateOperation(left, right, n.Op)
+
+	case *Call:
+		args := make([]float64, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := Evaluate(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = value
+		}
+		return ApplyOperation(n.Name, args)
+	}
+
+	return 0, ErrUnsupportedExpr
+}
+
+// Compile flattens the tree into operations in dependency order, the last
+// one producing the final result. An expression without operators, such as
+// "(5)", compiles to no operations and should be evaluated directly.
+func Compile(node Node) ([]Operation, error) {
+	c := &compiler{nextResultID: 1}
+	if _, err := c.compile(node); err != nil {
+		return nil, err
+	}
+	return c.operations, nil
+}
+
+// CompileExact is like Compile, but literals are *big.Rat and functions
+// without an exact counterpart are rejected up front.
+func CompileExact(node Node) ([]Operation, error) {
+	c := &compiler{nextResultID: 1, exact: true}
+	if _, err := c.compile(node); err != nil {
+		return nil, err
+	}
+	return c.operations, nil
+}
+
+type compiler struct {
+	operations   []Operation
+	nextResultID int
+	exact        bool
+}
+
+func (c *compiler) compile(node Node) (interface{}, error) {
+	switch n := node.(type) {
+	case *Number:
+		if c.exact {
+			return numberRat(n)
+		}
+		return n.Value, nil
+
+	case *Variable:
+		return nil, &UnboundVariableError{Name: n.Name, Offset: n.Offset}
+
+	case *Unary:
+		operand, err := c.compile(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		switch value := operand.(type) {
+		case float64:
+			return -value, nil
+		case *big.Rat:
+			return new(big.Rat).Neg(value), nil
+		}
+		if c.exact {
+			return c.emit("*", big.NewRat(-1, 1), operand), nil
+		}
+		return c.emit("*", -1.0, operand), nil
+
+	case *Binary:
+		left, err := c.compile(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := c.compile(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return c.emit(n.Op, left, right), nil
+
+	case *Call:
+		fn, ok := LookupFunction(n.Name)
+		if !ok {
+			return nil, ErrUnknownFunction
+		}
+		if err := fn.checkArity(len(n.Args)); err != nil {
+			return nil, err
+		}
+		if c.exact && fn.Exact == nil {
+			return nil, fmt.Errorf("%w: %s is not available in exact mode", ErrInexact, fn.Name)
+		}
+
+		args := make([]interface{}, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := c.compile(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return c.emit(n.Name, args...), nil
+	}
+
+	return nil, ErrUnsupportedExpr
+}
+
+func (c *compiler) emit(op string, args ...interface{}) interface{} {
+	c.operations = append(c.operations, Operation{
+		Args:     args,
+		Operator: op,
+	})
+
+	resultID := c.nextResultID
+	c.nextResultID++
+
+	return resultID
+}
@@ -0,0 +1,162 @@
+package calculation_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+)
+
+var differentialCorpus = []string{
+	"1",
+	"(5)",
+	"-5",
+	"-(5)",
+	"--5",
+	"2+3*4",
+	"(2+3)*4",
+	"2-3-4",
+	"2-(3-4)",
+	"8/4/2",
+	"8/(4/2)",
+	"-(2+3)",
+	"-(2+3)*4",
+	"2*-(3+1)",
+	"-2^2",
+	"(-2)^2",
+	"-(2)^2",
+	"2^-1",
+	"2^-1^2",
+	"2^3^2",
+	"(2^3)^2",
+	"-2^-2*3",
+	"1/3*3",
+	"0.1+0.2",
+	"1e3/7",
+	"(70/7) * 10 /((3+2) * (3+7)) - 2",
+	"sqrt(16)*-abs(-3)",
+	"max(-1, -(2), 3-5)",
+	"min(2^10, 1000)+round(-2.5)",
+	"sin(1)^2+cos(1)^2",
+	"log(abs(-(2+3)))",
+	"-sqrt(4)^2",
+	"1/0",
+	"1/(2-2)",
+	"sqrt(-(1))",
+	"log(0*5)",
+	"(-8)^(1/3)",
+}
+
+func runCompiled(ops []calculation.Operation) (float64, error) {
+	values := make([]float64, len(ops)+1)
+	for i, op := range ops {
+		args := make([]float64, len(op.Args))
+		for j, arg := range op.Args {
+			switch v := arg.(type) {
+			case float64:
+				args[j] = v
+			case int:
+				args[j] = values[v]
+			}
+		}
+
+		value, err := calculation.ApplyOperation(op.Operator, args)
+		if err != nil {
+			return 0, err
+		}
+		values[i+1] = value
+	}
+	return values[len(ops)], nil
+}
+
+func sameValue(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+func TestEvaluateMatchesCompile(t *testing.T) {
+	for _, expr := range differentialCorpus {
+		t.Run(expr, func(t *testing.T) {
+			node, err := calculation.Parse(expr)
+			if err != nil {
+				t.Fatalf("не удалось разобрать выражение '%s': %v", expr, err)
+			}
+
+			local, localErr := calculation.Evaluate(node)
+
+			ops, err := calculation.Compile(node)
+			if err != nil {
+				t.Fatalf("не удалось скомпилировать выражение '%s': %v", expr, err)
+			}
+			if len(ops) == 0 {
+				return
+			}
+			distributed, distributedErr := runCompiled(ops)
+
+			if (localErr != nil) != (distributedErr != nil) {
+				t.Fatalf("для '%s' ошибки расходятся: локально %v, по задачам %v", expr, localErr, distributedErr)
+			}
+			if localErr == nil && !sameValue(local, distributed) {
+				t.Errorf("для '%s' результаты расходятся: локально %v, по задачам %v", expr, local, distributed)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, expr := range differentialCorpus {
+		t.Run(expr, func(t *testing.T) {
+			node, err := calculation.Parse(expr)
+			if err != nil {
+				t.Fatalf("не удалось разобрать выражение '%s': %v", expr, err)
+			}
+
+			printed := node.String()
+			reparsed, err := calculation.Parse(printed)
+			if err != nil {
+				t.Fatalf("каноническая запись '%s' не разбирается: %v", printed, err)
+			}
+			if reparsed.String() != printed {
+				t.Errorf("каноническая запись нестабильна: '%s' -> '%s'", printed, reparsed.String())
+			}
+
+			before, errBefore := calculation.Evaluate(node)
+			after, errAfter := calculation.Evaluate(reparsed)
+			if (errBefore != nil) != (errAfter != nil) || (errBefore == nil && !sameValue(before, after)) {
+				t.Errorf("'%s' и '%s' вычисляются по-разному: %v/%v и %v/%v", expr, printed, before, errBefore, after, errAfter)
+			}
+		})
+	}
+}
+
+func TestCanonicalString(t *testing.T) {
+	testCases := []struct {
+		expr     string
+		expected string
+	}{
+		{"2+3*4", "2 + 3 * 4"},
+		{"(2+3)*4", "(2 + 3) * 4"},
+		{"((2))", "2"},
+		{"2-(3-4)", "2 - (3 - 4)"},
+		{"(2-3)-4", "2 - 3 - 4"},
+		{"2^3^2", "2 ^ 3 ^ 2"},
+		{"(2^3)^2", "(2 ^ 3) ^ 2"},
+		{"-2^2", "-2 ^ 2"},
+		{"(-2)^2", "(-2) ^ 2"},
+		{"2**-1", "2 ^ -1"},
+		{"-(2+3)", "-(2 + 3)"},
+		{"max( 1 ,2+3 )", "max(1, 2 + 3)"},
+		{"1.50", "1.5"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			node, err := calculation.Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("не удалось разобрать выражение '%s': %v", tc.expr, err)
+			}
+			if node.String() != tc.expected {
+				t.Errorf("для '%s': ожидалось '%s', получено '%s'", tc.expr, tc.expected, node.String())
+			}
+		})
+	}
+}
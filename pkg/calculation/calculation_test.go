@@ -1,6 +1,7 @@
 package calculation_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/neptship/calc-yandex-go/pkg/calculation"
@@ -20,6 +21,32 @@ func TestCalculate(t *testing.T) {
 		{"деление на ноль", "1/0", 0, true},
 		{"некорректное выражение", "2++3", 0, true},
 		{"пустое выражение", "", 0, true},
+		{"степень", "2^10", 1024, false},
+		{"степень через **", "2**3", 8, false},
+		{"правая ассоциативность степени", "2^3^2", 512, false},
+		{"степень выше унарного минуса", "-2^2", -4, false},
+		{"отрицательное основание в скобках", "(-2)^2", 4, false},
+		{"отрицательный показатель", "2^-1", 0.5, false},
+		{"степень выше умножения", "3*2^2", 12, false},
+		{"неопределённая степень", "(-8)^(1/3)", 0, true},
+		{"незакрытая скобка", "(2+3", 0, true},
+		{"недопустимый символ", "2+a", 0, true},
+		{"недопустимый знак", "2+$", 0, true},
+		{"экспоненциальная запись", "1.5e2+.5", 150.5, false},
+		{"корень", "sqrt(16)*2", 8, false},
+		{"модуль", "abs(-3)+1", 4, false},
+		{"синус нуля", "sin(0)", 0, false},
+		{"косинус нуля", "cos(0)*5", 5, false},
+		{"логарифм единицы", "log(1)", 0, false},
+		{"минимум", "min(4, 2, 8)", 2, false},
+		{"максимум от выражений", "max(1+1, 2*3)", 6, false},
+		{"округление", "round(2.5)", 3, false},
+		{"вложенные функции", "sqrt(abs(-16))", 4, false},
+		{"корень из отрицательного", "sqrt(-1)", 0, true},
+		{"логарифм нуля", "log(0)", 0, true},
+		{"неизвестная функция", "foo(1)", 0, true},
+		{"лишний аргумент", "sqrt(1, 2)", 0, true},
+		{"без аргументов", "max()", 0, true},
 	}
 
 	for _, tc := range testCases {
@@ -41,3 +68,58 @@ func TestCalculate(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expr     string
+		offset   int
+		sentinel error
+	}{
+		{"два оператора подряд", "2+*3", 2, calculation.ErrConsecutiveOperators},
+		{"шестнадцатеричное число", "0x1F", 0, calculation.ErrInvalidNumber},
+		{"разделитель разрядов", "1+1_000", 2, calculation.ErrInvalidNumber},
+		{"символьный литерал", "'a'", 0, calculation.ErrInvalidCharacter},
+		{"обращение к полю", "x.y", 1, calculation.ErrInvalidCharacter},
+		{"незакрытая скобка", "(2+3", 4, calculation.ErrMismatchedBrackets},
+		{"лишняя скобка", "2+3)", 3, calculation.ErrMismatchedBrackets},
+		{"неизвестная функция", "1+foo(2)", 2, calculation.ErrUnknownFunction},
+		{"неверное число аргументов", "sqrt(1, 2)", 0, calculation.ErrArgumentCount},
+		{"пустое выражение", "", 0, calculation.ErrInvalidExpression},
+		{"обрыв выражения", "2*", 2, calculation.ErrInvalidExpression},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := calculation.ParseExpression(tc.expr)
+
+			var parseErr *calculation.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("ожидалась ParseError для выражения '%s', получено: %v", tc.expr, err)
+			}
+			if parseErr.Offset != tc.offset {
+				t.Errorf("для выражения '%s': ожидалась позиция %d, получена %d", tc.expr, tc.offset, parseErr.Offset)
+			}
+			if !errors.Is(err, tc.sentinel) {
+				t.Errorf("для выражения '%s': ожидалась ошибка %v, получена %v", tc.expr, tc.sentinel, err)
+			}
+			if parseErr.Expected == "" {
+				t.Errorf("для выражения '%s': не указано, что ожидалось", tc.expr)
+			}
+		})
+	}
+}
+
+func TestParseErrorSnippet(t *testing.T) {
+	_, err := calculation.ParseExpression("2 + * 3")
+
+	var parseErr *calculation.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("ожидалась ParseError, получено: %v", err)
+	}
+
+	expected := "2 + * 3\n    ^"
+	if parseErr.Snippet() != expected {
+		t.Errorf("ожидался фрагмент\n%s\nполучен\n%s", expected, parseErr.Snippet())
+	}
+}
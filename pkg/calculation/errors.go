@@ -1,6 +1,11 @@
 package calculation
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
 
 var (
 	ErrInvalidExpression    = errors.New("invalid expression")
@@ -10,4 +15,49 @@ var (
 	ErrMismatchedBrackets   = errors.New("mismatched parentheses")
 	ErrInvalidCharacter     = errors.New("invalid character")
 	ErrUnsupportedExpr      = errors.New("unsupported expression type")
+	ErrUndefinedPower       = errors.New("power is undefined")
+	ErrUnknownFunction      = errors.New("unknown function")
+	ErrArgumentCount        = errors.New("wrong number of arguments")
+	ErrDomain               = errors.New("argument out of domain")
+	ErrInexact              = errors.New("no exact rational result")
+	ErrUnboundVariable      = errors.New("unbound variable")
+	ErrInvalidVariable      = errors.New("invalid variable value")
 )
+
+// UnboundVariableError names an identifier that has no value in the bindings.
+type UnboundVariableError struct {
+	Name   string
+	Offset int
+}
+
+func (e *UnboundVariableError) Error() string {
+	return fmt.Sprintf("%v %q", ErrUnboundVariable, e.Name)
+}
+
+func (e *UnboundVariableError) Unwrap() error {
+	return ErrUnboundVariable
+}
+
+// ParseError describes why an expression could not be parsed. Offset is the
+// byte offset of the offending token in Input.
+type ParseError struct {
+	Input    string
+	Offset   int
+	Expected string
+	Found    string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at offset %d: expected %s, found %s", e.Err, e.Offset, e.Expected, e.Found)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the input with a caret under the offending position.
+func (e *ParseError) Snippet() string {
+	column := utf8.RuneCountInString(e.Input[:e.Offset])
+	return e.Input + "\n" + strings.Repeat(" ", column) + "^"
+}
@@ -0,0 +1,191 @@
+package calculation
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Calculation modes. In exact mode operands and results are *big.Rat, so
+// "0.1+0.2" is exactly 3/10.
+const (
+	ModeFloat = "float"
+	ModeExact = "exact"
+)
+
+// maxExactPowerBits bounds the numerator and the denominator of an integer
+// power in exact mode. The size of the result is checked rather than the
+// exponent, so nested powers cannot grow past it either and a single task
+// does not exhaust an agent's memory.
+const maxExactPowerBits = 1 << 20
+
+// ParseRat reads a rational written as a decimal ("0.1", "1e3") or a
+// fraction ("1/3").
+func ParseRat(text string) (*big.Rat, error) {
+	value, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidNumber, text)
+	}
+	return value, nil
+}
+
+func numberRat(n *Number) (*big.Rat, error) {
+	if n.Text == "" {
+		return new(big.Rat).SetFloat64(n.Value), nil
+	}
+	return ParseRat(n.Text)
+}
+
+// EvaluateExact computes the value of the tree in rational arithmetic.
+func EvaluateExact(node Node) (*big.Rat, error) {
+	switch n := node.(type) {
+	case *Number:
+		return numberRat(n)
+
+	case *Variable:
+		return nil, &UnboundVariableError{Name: n.Name, Offset: n.Offset}
+
+	case *Unary:
+		value, err := EvaluateExact(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return value.Neg(value), nil
+
+	case *Binary:
+		left, err := EvaluateExact(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := EvaluateExact(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return EvaluateExactOperation(left, right, n.Op)
+
+	case *Call:
+		args := make([]*big.Rat, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := EvaluateExact(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return ApplyExactOperation(n.Name, args)
+	}
+
+	return nil, ErrUnsupportedExpr
+}
+
+// ApplyExactOperation is the rational counterpart of ApplyOperation.
+func ApplyExactOperation(op string, args []*big.Rat) (*big.Rat, error) {
+	if fn, ok := functions[op]; ok {
+		if err := fn.checkArity(len(args)); err != nil {
+			return nil, err
+		}
+		if fn.Exact == nil {
+			return nil, fmt.Errorf("%w: %s is not available in exact mode", ErrInexact, fn.Name)
+		}
+		return fn.Exact(args)
+	}
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("%w: %s expects 2 arguments, got %d", ErrArgumentCount, op, len(args))
+	}
+	return EvaluateExactOperation(args[0], args[1], op)
+}
+
+func EvaluateExactOperation(left, right *big.Rat, op string) (*big.Rat, error) {
+	result := new(big.Rat)
+
+	switch op {
+	case "+":
+		return result.Add(left, right), nil
+	case "-":
+		return result.Sub(left, right), nil
+	case "*":
+		return result.Mul(left, right), nil
+	case "/":
+		if right.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return result.Quo(left, right), nil
+	case "^":
+		return exactPower(left, right)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", op)
+	}
+}
+
+func exactPower(base, exponent *big.Rat) (*big.Rat, error) {
+	if !exponent.IsInt() {
+		return nil, fmt.Errorf("%w: %s ^ %s has a non-integer exponent", ErrInexact, base.RatString(), exponent.RatString())
+	}
+
+	n := exponent.Num()
+	if !n.IsInt64() || !powerFits(base, n.Int64()) {
+		return nil, fmt.Errorf("%w: %s ^ %s exceeds %d bits", ErrInexact, base.RatString(), n, maxExactPowerBits)
+	}
+
+	power := n.Int64()
+	if power < 0 {
+		if base.Sign() == 0 {
+			return nil, fmt.Errorf("%w: %s ^ %d", ErrUndefinedPower, base.RatString(), power)
+		}
+		power = -power
+		base = new(big.Rat).Inv(base)
+	}
+
+	e := big.NewInt(power)
+	num := new(big.Int).Exp(base.Num(), e, nil)
+	den := new(big.Int).Exp(base.Denom(), e, nil)
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// powerFits reports whether base^power stays within maxExactPowerBits: the
+// result has about BitLen*|power| bits in the numerator and the denominator.
+func powerFits(base *big.Rat, power int64) bool {
+	if power < 0 {
+		power = -power
+	}
+	if power < 0 {
+		return false
+	}
+	for _, part := range []*big.Int{base.Num(), base.Denom()} {
+		if bits := int64(part.BitLen()); bits > 0 && power > maxExactPowerBits/bits {
+			return false
+		}
+	}
+	return true
+}
+
+// exactSqrt succeeds only when numerator and denominator are perfect squares.
+func exactSqrt(args []*big.Rat) (*big.Rat, error) {
+	value := args[0]
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("%w: sqrt of negative number %s", ErrDomain, value.RatString())
+	}
+
+	num := new(big.Int).Sqrt(value.Num())
+	den := new(big.Int).Sqrt(value.Denom())
+	result := new(big.Rat).SetFrac(num, den)
+	if new(big.Rat).Mul(result, result).Cmp(value) != 0 {
+		return nil, fmt.Errorf("%w: sqrt(%s) is irrational", ErrInexact, value.RatString())
+	}
+	return result, nil
+}
+
+// exactRound rounds half away from zero, like math.Round.
+func exactRound(args []*big.Rat) (*big.Rat, error) {
+	value := args[0]
+
+	num := new(big.Int).Abs(value.Num())
+	den := value.Denom()
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if value.Sign() < 0 {
+		num.Neg(num)
+	}
+
+	return new(big.Rat).SetInt(num), nil
+}
@@ -0,0 +1,111 @@
+package calculation_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+)
+
+func TestEvaluateExact(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expr     string
+		expected string
+		err      error
+	}{
+		{"десятичные дроби", "0.1+0.2", "3/10", nil},
+		{"треть на три", "1/3*3", "1", nil},
+		{"экспоненциальная запись", "1.5e2+.5", "301/2", nil},
+		{"отрицательная степень", "2^-2", "1/4", nil},
+		{"степень дроби", "(2/3)^3", "8/27", nil},
+		{"точный корень", "sqrt(9/4)", "3/2", nil},
+		{"округление половины", "round(-2.5)", "-3", nil},
+		{"минимум и модуль", "min(1/3, abs(-1/4))", "1/4", nil},
+		{"иррациональный корень", "sqrt(2)", "", calculation.ErrInexact},
+		{"дробный показатель", "4^0.5", "", calculation.ErrInexact},
+		{"деление на ноль", "1/(0.1+0.2-0.3)", "", calculation.ErrDivisionByZero},
+		{"ноль в отрицательной степени", "0^-1", "", calculation.ErrUndefinedPower},
+		{"вложенные степени", "((2^4096)^4096)^4096", "", calculation.ErrInexact},
+		{"слишком большой знаменатель", "(1/3)^-1000000", "", calculation.ErrInexact},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := calculation.Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("не удалось разобрать выражение '%s': %v", tc.expr, err)
+			}
+
+			result, err := calculation.EvaluateExact(node)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("для '%s' ожидалась ошибка %v, получено: %v", tc.expr, tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("неожиданная ошибка для '%s': %v", tc.expr, err)
+			}
+			if result.RatString() != tc.expected {
+				t.Errorf("для '%s': ожидалось %s, получено %s", tc.expr, tc.expected, result.RatString())
+			}
+		})
+	}
+}
+
+func TestCompileExactMatchesEvaluateExact(t *testing.T) {
+	for _, expr := range []string{"0.1+0.2", "-(1/3)*3", "2^-1^2", "max(-1/2, -(1/3), 3-5)", "round(7/2)-abs(-0.25)"} {
+		t.Run(expr, func(t *testing.T) {
+			node, err := calculation.Parse(expr)
+			if err != nil {
+				t.Fatalf("не удалось разобрать выражение '%s': %v", expr, err)
+			}
+
+			local, err := calculation.EvaluateExact(node)
+			if err != nil {
+				t.Fatalf("не удалось вычислить '%s': %v", expr, err)
+			}
+
+			ops, err := calculation.CompileExact(node)
+			if err != nil {
+				t.Fatalf("не удалось скомпилировать '%s': %v", expr, err)
+			}
+
+			values := make([]*big.Rat, len(ops)+1)
+			for i, op := range ops {
+				args := make([]*big.Rat, len(op.Args))
+				for j, arg := range op.Args {
+					switch v := arg.(type) {
+					case *big.Rat:
+						args[j] = v
+					case int:
+						args[j] = values[v]
+					default:
+						t.Fatalf("операнд %v имеет тип %T вместо *big.Rat", arg, arg)
+					}
+				}
+				values[i+1], err = calculation.ApplyExactOperation(op.Operator, args)
+				if err != nil {
+					t.Fatalf("операция %s завершилась ошибкой: %v", op.Operator, err)
+				}
+			}
+
+			if values[len(ops)].Cmp(local) != 0 {
+				t.Errorf("для '%s' результаты расходятся: локально %s, по задачам %s", expr, local, values[len(ops)])
+			}
+		})
+	}
+}
+
+func TestCompileExactRejectsInexactFunctions(t *testing.T) {
+	node, err := calculation.Parse("sin(1)+1")
+	if err != nil {
+		t.Fatalf("не удалось разобрать выражение: %v", err)
+	}
+
+	if _, err := calculation.CompileExact(node); !errors.Is(err, calculation.ErrInexact) {
+		t.Errorf("ожидалась ошибка %v, получено: %v", calculation.ErrInexact, err)
+	}
+}
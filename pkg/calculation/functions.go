@@ -0,0 +1,115 @@
+package calculation
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Function is a named operation that agents evaluate as a separate task.
+// MaxArgs of -1 means the function accepts any number of arguments above MinArgs.
+// Exact is nil for functions whose results are generally irrational.
+type Function struct {
+	Name    string
+	MinArgs int
+	MaxArgs int
+	Eval    func(args []float64) (float64, error)
+	Exact   func(args []*big.Rat) (*big.Rat, error)
+}
+
+var functions = map[string]Function{
+	"sqrt": {Name: "sqrt", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, fmt.Errorf("%w: sqrt of negative number %v", ErrDomain, args[0])
+		}
+		return math.Sqrt(args[0]), nil
+	}, Exact: exactSqrt},
+	"abs": {Name: "abs", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		return math.Abs(args[0]), nil
+	}, Exact: func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Abs(args[0]), nil
+	}},
+	"sin": {Name: "sin", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		return math.Sin(args[0]), nil
+	}},
+	"cos": {Name: "cos", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		return math.Cos(args[0]), nil
+	}},
+	"log": {Name: "log", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		if args[0] <= 0 {
+			return 0, fmt.Errorf("%w: log of non-positive number %v", ErrDomain, args[0])
+		}
+		return math.Log(args[0]), nil
+	}},
+	"min": {Name: "min", MinArgs: 1, MaxArgs: -1, Eval: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}, Exact: func(args []*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	}},
+	"max": {Name: "max", MinArgs: 1, MaxArgs: -1, Eval: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}, Exact: func(args []*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	}},
+	"round": {Name: "round", MinArgs: 1, MaxArgs: 1, Eval: func(args []float64) (float64, error) {
+		return math.Round(args[0]), nil
+	}, Exact: exactRound},
+}
+
+func LookupFunction(name string) (Function, bool) {
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+func (f Function) checkArity(count int) error {
+	if count < f.MinArgs || (f.MaxArgs >= 0 && count > f.MaxArgs) {
+		return fmt.Errorf("%w: %s expects %s, got %d", ErrArgumentCount, f.Name, f.arity(), count)
+	}
+	return nil
+}
+
+func (f Function) arity() string {
+	switch {
+	case f.MinArgs == f.MaxArgs:
+		return fmt.Sprintf("%d argument(s)", f.MinArgs)
+	case f.MaxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", f.MinArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", f.MinArgs, f.MaxArgs)
+	}
+}
+
+// ApplyOperation evaluates a binary operator or a built-in function.
+func ApplyOperation(op string, args []float64) (float64, error) {
+	if fn, ok := functions[op]; ok {
+		if err := fn.checkArity(len(args)); err != nil {
+			return 0, err
+		}
+		return fn.Eval(args)
+	}
+
+	if len(args) != 2 {
+		return 0, fmt.Errorf("%w: %s expects 2 arguments, got %d", ErrArgumentCount, op, len(args))
+	}
+	return EvaluateOperation(args[0], args[1], op)
+}
@@ -0,0 +1,171 @@
+package calculation
+
+import "fmt"
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokPlus
+	tokMinus
+	tokStar
+	tokSlash
+	tokCaret
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokNumber:
+		return "number " + t.text
+	case tokIdent:
+		return "name " + t.text
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+func (t token) isOperator() bool {
+	switch t.kind {
+	case tokPlus, tokMinus, tokStar, tokSlash, tokCaret:
+		return true
+	}
+	return false
+}
+
+// The calculator language has decimal numbers with an optional exponent
+// ("12", "0.5", ".5", "1e-3"), names made of ASCII letters, digits and
+// underscores, the operators + - * / ^ ** and the punctuation ( ) ,.
+// Anything else, including Go-style literals such as 0x1F or 1_000, is
+// rejected by the lexer.
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	pos := 0
+
+	for pos < len(input) {
+		char := input[pos]
+		start := pos
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			pos++
+			continue
+
+		case isDigit(char) || (char == '.' && pos+1 < len(input) && isDigit(input[pos+1])):
+			pos = scanNumber(input, pos)
+			if pos < len(input) && (isLetter(input[pos]) || isDigit(input[pos]) || input[pos] == '.') {
+				for pos < len(input) && (isLetter(input[pos]) || isDigit(input[pos]) || input[pos] == '.') {
+					pos++
+				}
+				return nil, &ParseError{
+					Input:    input,
+					Offset:   start,
+					Expected: "number",
+					Found:    fmt.Sprintf("'%s'", input[start:pos]),
+					Err:      ErrInvalidNumber,
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: input[start:pos], offset: start})
+			continue
+
+		case isLetter(char):
+			for pos < len(input) && (isLetter(input[pos]) || isDigit(input[pos])) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: input[start:pos], offset: start})
+			continue
+		}
+
+		kind := tokEOF
+		switch char {
+		case '+':
+			kind = tokPlus
+		case '-':
+			kind = tokMinus
+		case '*':
+			kind = tokStar
+			if pos+1 < len(input) && input[pos+1] == '*' {
+				kind = tokCaret
+				pos++
+			}
+		case '/':
+			kind = tokSlash
+		case '^':
+			kind = tokCaret
+		case '(':
+			kind = tokLParen
+		case ')':
+			kind = tokRParen
+		case ',':
+			kind = tokComma
+		default:
+			return nil, &ParseError{
+				Input:    input,
+				Offset:   start,
+				Expected: "number, name, operator or parenthesis",
+				Found:    fmt.Sprintf("%q", nextRune(input[start:])),
+				Err:      ErrInvalidCharacter,
+			}
+		}
+
+		pos++
+		tokens = append(tokens, token{kind: kind, text: input[start:pos], offset: start})
+	}
+
+	return append(tokens, token{kind: tokEOF, offset: len(input)}), nil
+}
+
+func scanNumber(input string, pos int) int {
+	for pos < len(input) && isDigit(input[pos]) {
+		pos++
+	}
+
+	if pos+1 < len(input) && input[pos] == '.' && isDigit(input[pos+1]) {
+		pos++
+		for pos < len(input) && isDigit(input[pos]) {
+			pos++
+		}
+	}
+
+	if pos < len(input) && (input[pos] == 'e' || input[pos] == 'E') {
+		exp := pos + 1
+		if exp < len(input) && (input[exp] == '+' || input[exp] == '-') {
+			exp++
+		}
+		if exp < len(input) && isDigit(input[exp]) {
+			pos = exp
+			for pos < len(input) && isDigit(input[pos]) {
+				pos++
+			}
+		}
+	}
+
+	return pos
+}
+
+func nextRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isLetter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_'
+}
@@ -2,123 +2,223 @@ package calculation
 
 import (
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
+	"math"
 	"strconv"
 )
 
+// Operation applies Operator to Args. An argument is either a float64
+// literal or an int referring to the result of an earlier operation
+// (1 for the first one).
 type Operation struct {
-	Left     interface{}
-	Right    interface{}
+	Args     []interface{}
 	Operator string
 }
 
+// Binding powers of the Pratt parser. Unary minus binds looser than "^",
+// so "-2^2" is -(2^2), and "^" is right-associative: its right operand is
+// parsed with a binding power one below its own, so "2^3^2" is 2^(3^2).
+const (
+	bpSum     = 10
+	bpProduct = 20
+	bpUnary   = 30
+	bpPower   = 40
+	bpAtom    = 100
+)
+
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+// ParseExpression parses expr and compiles it into agent operations.
 func ParseExpression(expr string) ([]Operation, error) {
-	exprAST, err := parser.ParseExpr(expr)
+	node, err := Parse(expr)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+		return nil, err
 	}
+	return Compile(node)
+}
 
-	var operations []Operation
-	nextResultID := 1
+// Parse builds the expression tree, returning a *ParseError for invalid input.
+func Parse(expr string) (Node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{input: expr, tokens: tokens}
 
-	resultID, err := buildOperations(exprAST, &operations, &nextResultID)
+	node, err := p.parseExpr(0)
 	if err != nil {
 		return nil, err
 	}
 
-	if resultID == 0 {
-		return nil, ErrInvalidExpression
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, p.errorAt(tok, "operator or end of expression", ErrMismatchedBrackets)
+		}
+		return nil, p.errorAt(tok, "operator or end of expression", ErrInvalidExpression)
 	}
 
-	return operations, nil
+	return node, nil
 }
 
-func buildOperations(node ast.Expr, operations *[]Operation, nextResultID *int) (interface{}, error) {
-	switch n := node.(type) {
-	case *ast.BinaryExpr:
-		left, err := buildOperations(n.X, operations, nextResultID)
-		if err != nil {
-			return 0, err
-		}
-
-		right, err := buildOperations(n.Y, operations, nextResultID)
-		if err != nil {
-			return 0, err
-		}
+func (p *parser) parseExpr(minBP int) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
 
-		op := ""
-		switch n.Op {
-		case token.ADD:
-			op = "+"
-		case token.SUB:
-			op = "-"
-		case token.MUL:
-			op = "*"
-		case token.QUO:
-			op = "/"
-		default:
-			return 0, fmt.Errorf("unsupported operator: %v", n.Op)
+	for {
+		tok := p.peek()
+		bp, rightBP, op := infixBindingPower(tok.kind)
+		if bp == 0 || bp <= minBP {
+			return left, nil
 		}
+		p.next()
 
-		operation := Operation{
-			Left:     left,
-			Right:    right,
-			Operator: op,
+		right, err := p.parseExpr(rightBP)
+		if err != nil {
+			return nil, err
 		}
+		left = &Binary{Op: op, Left: left, Right: right, Offset: tok.offset}
+	}
+}
 
-		*operations = append(*operations, operation)
+func infixBindingPower(kind tokenKind) (int, int, string) {
+	switch kind {
+	case tokPlus:
+		return bpSum, bpSum, "+"
+	case tokMinus:
+		return bpSum, bpSum, "-"
+	case tokStar:
+		return bpProduct, bpProduct, "*"
+	case tokSlash:
+		return bpProduct, bpProduct, "/"
+	case tokCaret:
+		return bpPower, bpPower - 1, "^"
+	}
+	return 0, 0, ""
+}
 
-		resultID := *nextResultID
-		*nextResultID++
+func (p *parser) parsePrefix() (Node, error) {
+	tok := p.next()
 
-		return resultID, nil
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorAt(tok, "number", ErrInvalidNumber)
+		}
+		return &Number{Value: value, Text: tok.text, Offset: tok.offset}, nil
 
-	case *ast.BasicLit:
-		if n.Kind != token.INT && n.Kind != token.FLOAT {
-			return 0, fmt.Errorf("unsupported literal type: %v", n.Kind)
+	case tokMinus:
+		operand, err := p.parseExpr(bpUnary)
+		if err != nil {
+			return nil, err
 		}
+		return &Unary{Op: "-", Operand: operand, Offset: tok.offset}, nil
 
-		value, err := strconv.ParseFloat(n.Value, 64)
+	case tokLParen:
+		node, err := p.parseExpr(0)
 		if err != nil {
-			return 0, fmt.Errorf("invalid number: %v", n.Value)
+			return nil, err
 		}
+		if err := p.expect(tokRParen, "')'", ErrMismatchedBrackets); err != nil {
+			return nil, err
+		}
+		return node, nil
 
-		return value, nil
+	case tokIdent:
+		if _, isFunction := LookupFunction(tok.text); isFunction || p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return &Variable{Name: tok.text, Offset: tok.offset}, nil
 
-	case *ast.ParenExpr:
-		return buildOperations(n.X, operations, nextResultID)
+	case tokEOF:
+		return nil, p.errorAt(tok, "number, variable, function or '('", ErrInvalidExpression)
+	}
 
-	case *ast.UnaryExpr:
-		if n.Op != token.SUB {
-			return 0, fmt.Errorf("unsupported unary operator: %v", n.Op)
-		}
+	if tok.isOperator() {
+		return nil, p.errorAt(tok, "number, variable, function or '('", ErrConsecutiveOperators)
+	}
+	return nil, p.errorAt(tok, "number, variable, function or '('", ErrInvalidExpression)
+}
 
-		operand, err := buildOperations(n.X, operations, nextResultID)
-		if err != nil {
-			return 0, err
-		}
+func (p *parser) parseCall(name token) (Node, error) {
+	fn, ok := LookupFunction(name.text)
+	if !ok {
+		return nil, p.errorAt(name, "function name", ErrUnknownFunction)
+	}
 
-		if value, ok := operand.(float64); ok {
-			return -value, nil
+	if err := p.expect(tokLParen, "'(' after "+name.text, ErrInvalidExpression); err != nil {
+		return nil, err
+	}
+
+	call := &Call{Name: name.text, Offset: name.offset}
+	if p.peek().kind == tokRParen {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			if err := p.expect(tokRParen, "',' or ')'", ErrMismatchedBrackets); err != nil {
+				return nil, err
+			}
+			break
 		}
+	}
 
-		operation := Operation{
-			Left:     -1.0,
-			Right:    operand,
-			Operator: "*",
+	if fn.checkArity(len(call.Args)) != nil {
+		return nil, &ParseError{
+			Input:    p.input,
+			Offset:   name.offset,
+			Expected: fn.arity() + " for " + fn.Name,
+			Found:    fmt.Sprintf("%d", len(call.Args)),
+			Err:      ErrArgumentCount,
 		}
+	}
 
-		*operations = append(*operations, operation)
+	return call, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
 
-		resultID := *nextResultID
-		*nextResultID++
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
 
-		return resultID, nil
+func (p *parser) expect(kind tokenKind, expected string, sentinel error) error {
+	tok := p.peek()
+	if tok.kind != kind {
+		return p.errorAt(tok, expected, sentinel)
+	}
+	p.next()
+	return nil
+}
 
-	default:
-		return 0, ErrUnsupportedExpr
+func (p *parser) errorAt(tok token, expected string, sentinel error) error {
+	return &ParseError{
+		Input:    p.input,
+		Offset:   tok.offset,
+		Expected: expected,
+		Found:    tok.describe(),
+		Err:      sentinel,
 	}
 }
 
@@ -135,6 +235,12 @@ func EvaluateOperation(left, right float64, op string) (float64, error) {
 			return 0, ErrDivisionByZero
 		}
 		return left / right, nil
+	case "^":
+		result := math.Pow(left, right)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, fmt.Errorf("%w: %v ^ %v", ErrUndefinedPower, left, right)
+		}
+		return result, nil
 	default:
 		return 0, fmt.Errorf("unknown operator: %s", op)
 	}
@@ -0,0 +1,123 @@
+package calculation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ParseExpressionWithVariables parses expr, substitutes the bound variables
+// and compiles the result into agent operations.
+func ParseExpressionWithVariables(expr string, variables map[string]string) ([]Operation, error) {
+	node, err := ParseWithVariables(expr, variables)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(node)
+}
+
+// ParseWithVariables parses expr and replaces every identifier with its value
+// from variables. A missing binding is reported as a *ParseError wrapping an
+// *UnboundVariableError, so it carries the position of the identifier.
+func ParseWithVariables(expr string, variables map[string]string) (Node, error) {
+	node, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	bound, err := Bind(node, variables)
+	if unbound, ok := err.(*UnboundVariableError); ok {
+		return nil, &ParseError{
+			Input:    expr,
+			Offset:   unbound.Offset,
+			Expected: "a value for " + unbound.Name + " in variables",
+			Found:    unbound.Name,
+			Err:      unbound,
+		}
+	}
+	return bound, err
+}
+
+// Bind returns a copy of the tree with variables replaced by numbers. Values
+// are number literals, kept as text so exact mode reads them without
+// rounding; they may be negative.
+func Bind(node Node, variables map[string]string) (Node, error) {
+	switch n := node.(type) {
+	case *Variable:
+		text, ok := variables[n.Name]
+		if !ok {
+			return nil, &UnboundVariableError{Name: n.Name, Offset: n.Offset}
+		}
+
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("%w: %s = %q is not a number", ErrInvalidVariable, n.Name, text)
+		}
+		if _, err := ParseRat(text); err != nil {
+			return nil, fmt.Errorf("%w: %s = %q is not a number", ErrInvalidVariable, n.Name, text)
+		}
+
+		return &Number{Value: value, Text: text, Offset: n.Offset}, nil
+
+	case *Unary:
+		operand, err := Bind(n.Operand, variables)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: n.Op, Operand: operand, Offset: n.Offset}, nil
+
+	case *Binary:
+		left, err := Bind(n.Left, variables)
+		if err != nil {
+			return nil, err
+		}
+		right, err := Bind(n.Right, variables)
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: n.Op, Left: left, Right: right, Offset: n.Offset}, nil
+
+	case *Call:
+		call := &Call{Name: n.Name, Args: make([]Node, len(n.Args)), Offset: n.Offset}
+		for i, arg := range n.Args {
+			bound, err := Bind(arg, variables)
+			if err != nil {
+				return nil, err
+			}
+			call.Args[i] = bound
+		}
+		return call, nil
+	}
+
+	return node, nil
+}
+
+// Variables lists the distinct variable names of the tree in order of first
+// appearance.
+func Variables(node Node) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	var walk func(Node)
+	walk = func(node Node) {
+		switch n := node.(type) {
+		case *Variable:
+			if !seen[n.Name] {
+				seen[n.Name] = true
+				names = append(names, n.Name)
+			}
+		case *Unary:
+			walk(n.Operand)
+		case *Binary:
+			walk(n.Left)
+			walk(n.Right)
+		case *Call:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(node)
+
+	return names
+}
@@ -0,0 +1,99 @@
+package calculation_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/neptship/calc-yandex-go/pkg/calculation"
+)
+
+func TestParseWithVariables(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expr      string
+		variables map[string]string
+		expected  float64
+	}{
+		{"формула", "rate*amount+fee", map[string]string{"rate": "0.5", "amount": "200", "fee": "3"}, 103},
+		{"отрицательное значение", "x^2", map[string]string{"x": "-3"}, 9},
+		{"переменная в функции", "max(a, b_2)", map[string]string{"a": "1", "b_2": "7"}, 7},
+		{"лишние переменные", "a+1", map[string]string{"a": "1", "unused": "5"}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := calculation.ParseWithVariables(tc.expr, tc.variables)
+			if err != nil {
+				t.Fatalf("неожиданная ошибка для '%s': %v", tc.expr, err)
+			}
+
+			result, err := calculation.Evaluate(node)
+			if err != nil {
+				t.Fatalf("не удалось вычислить '%s': %v", tc.expr, err)
+			}
+			if result != tc.expected {
+				t.Errorf("для '%s': ожидалось %v, получено %v", tc.expr, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestUnboundVariable(t *testing.T) {
+	_, err := calculation.ParseExpressionWithVariables("rate*amount+fee", map[string]string{"rate": "1", "fee": "2"})
+
+	var unbound *calculation.UnboundVariableError
+	if !errors.As(err, &unbound) {
+		t.Fatalf("ожидалась UnboundVariableError, получено: %v", err)
+	}
+	if unbound.Name != "amount" {
+		t.Errorf("ожидалась переменная amount, получено %s", unbound.Name)
+	}
+
+	var parseErr *calculation.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Offset != 5 {
+		t.Errorf("ожидалась ParseError с позицией 5, получено: %v", err)
+	}
+	if !errors.Is(err, calculation.ErrUnboundVariable) {
+		t.Errorf("ошибка должна оборачивать ErrUnboundVariable: %v", err)
+	}
+
+	if _, err := calculation.Calc("2+a"); !errors.As(err, &unbound) || unbound.Name != "a" {
+		t.Errorf("вычисление без привязок должно сообщать о переменной a, получено: %v", err)
+	}
+}
+
+func TestInvalidVariableValue(t *testing.T) {
+	for _, value := range []string{"abc", "NaN", "Inf", ""} {
+		_, err := calculation.ParseWithVariables("x+1", map[string]string{"x": value})
+		if !errors.Is(err, calculation.ErrInvalidVariable) {
+			t.Errorf("значение %q должно отклоняться, получено: %v", value, err)
+		}
+	}
+}
+
+func TestVariablesKeepExactText(t *testing.T) {
+	node, err := calculation.ParseWithVariables("a+b", map[string]string{"a": "0.1", "b": "0.2"})
+	if err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+
+	result, err := calculation.EvaluateExact(node)
+	if err != nil {
+		t.Fatalf("не удалось вычислить: %v", err)
+	}
+	if result.RatString() != "3/10" {
+		t.Errorf("ожидалось 3/10, получено %s", result.RatString())
+	}
+}
+
+func TestVariablesList(t *testing.T) {
+	node, err := calculation.Parse("b*a+max(c, b)")
+	if err != nil {
+		t.Fatalf("не удалось разобрать выражение: %v", err)
+	}
+
+	if names := calculation.Variables(node); !reflect.DeepEqual(names, []string{"b", "a", "c"}) {
+		t.Errorf("ожидались переменные [b a c], получено %v", names)
+	}
+}
@@ -23,7 +23,9 @@ const (
 
 // GetTaskRequest is an empty request to get a task
 type GetTaskRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Agent the task is assigned to; empty for agents that did not register
+	AgentId       string `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -58,6 +60,13 @@ func (*GetTaskRequest) Descriptor() ([]byte, []int) {
 	return file_proto_calculator_proto_rawDescGZIP(), []int{0}
 }
 
+func (x *GetTaskRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
 // TaskResponse contains all details about a calculation task
 type TaskResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -78,7 +87,18 @@ type TaskResponse struct {
 	//
 	//	*TaskResponse_NumberArg2
 	//	*TaskResponse_StringArg2
-	Arg2          isTaskResponse_Arg2 `protobuf_oneof:"arg2"`
+	Arg2 isTaskResponse_Arg2 `protobuf_oneof:"arg2"`
+	// Lease identifies this assignment of the task; it must be sent back with the result
+	LeaseId string `protobuf:"bytes,9,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	// Unix time in milliseconds after which the task is given to another agent
+	LeaseExpiresAt int64 `protobuf:"varint,10,opt,name=lease_expires_at,json=leaseExpiresAt,proto3" json:"lease_expires_at,omitempty"`
+	// All operands in order; arg1 and arg2 mirror the first two for older agents
+	Args []*Operand `protobuf:"bytes,11,rep,name=args,proto3" json:"args,omitempty"`
+	// Exact tasks carry rational operands and expect exact_result back
+	Exact bool `protobuf:"varint,12,opt,name=exact,proto3" json:"exact,omitempty"`
+	// W3C trace context of the expression, set on TaskStream where there is
+	// no per-task metadata; GetTask sends it in the response header instead
+	TraceContext  map[string]string `protobuf:"bytes,13,rep,name=trace_context,json=traceContext,proto3" json:"trace_context,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -191,6 +211,41 @@ func (x *TaskResponse) GetStringArg2() string {
 	return ""
 }
 
+func (x *TaskResponse) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *TaskResponse) GetLeaseExpiresAt() int64 {
+	if x != nil {
+		return x.LeaseExpiresAt
+	}
+	return 0
+}
+
+func (x *TaskResponse) GetArgs() []*Operand {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *TaskResponse) GetExact() bool {
+	if x != nil {
+		return x.Exact
+	}
+	return false
+}
+
+func (x *TaskResponse) GetTraceContext() map[string]string {
+	if x != nil {
+		return x.TraceContext
+	}
+	return nil
+}
+
 type isTaskResponse_Arg1 interface {
 	isTaskResponse_Arg1()
 }
@@ -223,20 +278,128 @@ func (*TaskResponse_NumberArg2) isTaskResponse_Arg2() {}
 
 func (*TaskResponse_StringArg2) isTaskResponse_Arg2() {}
 
+// Operand is a number, a string reference or, in exact mode, a rational
+// written as "numerator/denominator"
+type Operand struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*Operand_Number
+	//	*Operand_Ref
+	//	*Operand_Rational
+	Value         isOperand_Value `protobuf_oneof:"value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operand) Reset() {
+	*x = Operand{}
+	mi := &file_proto_calculator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operand) ProtoMessage() {}
+
+func (x *Operand) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operand.ProtoReflect.Descriptor instead.
+func (*Operand) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Operand) GetValue() isOperand_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Operand) GetNumber() float64 {
+	if x != nil {
+		if x, ok := x.Value.(*Operand_Number); ok {
+			return x.Number
+		}
+	}
+	return 0
+}
+
+func (x *Operand) GetRef() string {
+	if x != nil {
+		if x, ok := x.Value.(*Operand_Ref); ok {
+			return x.Ref
+		}
+	}
+	return ""
+}
+
+func (x *Operand) GetRational() string {
+	if x != nil {
+		if x, ok := x.Value.(*Operand_Rational); ok {
+			return x.Rational
+		}
+	}
+	return ""
+}
+
+type isOperand_Value interface {
+	isOperand_Value()
+}
+
+type Operand_Number struct {
+	Number float64 `protobuf:"fixed64,1,opt,name=number,proto3,oneof"`
+}
+
+type Operand_Ref struct {
+	Ref string `protobuf:"bytes,2,opt,name=ref,proto3,oneof"`
+}
+
+type Operand_Rational struct {
+	Rational string `protobuf:"bytes,3,opt,name=rational,proto3,oneof"`
+}
+
+func (*Operand_Number) isOperand_Value() {}
+
+func (*Operand_Ref) isOperand_Value() {}
+
+func (*Operand_Rational) isOperand_Value() {}
+
 // TaskResultRequest sends a calculation result back
 type TaskResultRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	TaskId        int32                  `protobuf:"varint,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
-	Result        float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
-	IsError       bool                   `protobuf:"varint,3,opt,name=is_error,json=isError,proto3" json:"is_error,omitempty"`
-	ErrorMessage  string                 `protobuf:"bytes,4,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	TaskId       int32                  `protobuf:"varint,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	Result       float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	IsError      bool                   `protobuf:"varint,3,opt,name=is_error,json=isError,proto3" json:"is_error,omitempty"`
+	ErrorMessage string                 `protobuf:"bytes,4,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	LeaseId      string                 `protobuf:"bytes,5,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	// Result of an exact task as "numerator/denominator"
+	ExactResult string `protobuf:"bytes,6,opt,name=exact_result,json=exactResult,proto3" json:"exact_result,omitempty"`
+	// Agent submitting the result; it must be the one holding the lease
+	AgentId string `protobuf:"bytes,7,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	// W3C trace context of the agent span, set on TaskStream; SubmitTaskResult
+	// sends it in the request metadata instead
+	TraceContext  map[string]string `protobuf:"bytes,8,rep,name=trace_context,json=traceContext,proto3" json:"trace_context,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TaskResultRequest) Reset() {
 	*x = TaskResultRequest{}
-	mi := &file_proto_calculator_proto_msgTypes[2]
+	mi := &file_proto_calculator_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -248,7 +411,7 @@ func (x *TaskResultRequest) String() string {
 func (*TaskResultRequest) ProtoMessage() {}
 
 func (x *TaskResultRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_calculator_proto_msgTypes[2]
+	mi := &file_proto_calculator_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -261,7 +424,7 @@ func (x *TaskResultRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TaskResultRequest.ProtoReflect.Descriptor instead.
 func (*TaskResultRequest) Descriptor() ([]byte, []int) {
-	return file_proto_calculator_proto_rawDescGZIP(), []int{2}
+	return file_proto_calculator_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *TaskResultRequest) GetTaskId() int32 {
@@ -292,18 +455,48 @@ func (x *TaskResultRequest) GetErrorMessage() string {
 	return ""
 }
 
+func (x *TaskResultRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetExactResult() string {
+	if x != nil {
+		return x.ExactResult
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *TaskResultRequest) GetTraceContext() map[string]string {
+	if x != nil {
+		return x.TraceContext
+	}
+	return nil
+}
+
 // TaskResultResponse indicates whether the result was accepted
 type TaskResultResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Success bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// Set on TaskStream so the agent can match the answer to its result
+	TaskId        int32 `protobuf:"varint,3,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TaskResultResponse) Reset() {
 	*x = TaskResultResponse{}
-	mi := &file_proto_calculator_proto_msgTypes[3]
+	mi := &file_proto_calculator_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -315,7 +508,7 @@ func (x *TaskResultResponse) String() string {
 func (*TaskResultResponse) ProtoMessage() {}
 
 func (x *TaskResultResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_calculator_proto_msgTypes[3]
+	mi := &file_proto_calculator_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -328,7 +521,7 @@ func (x *TaskResultResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TaskResultResponse.ProtoReflect.Descriptor instead.
 func (*TaskResultResponse) Descriptor() ([]byte, []int) {
-	return file_proto_calculator_proto_rawDescGZIP(), []int{3}
+	return file_proto_calculator_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *TaskResultResponse) GetSuccess() bool {
@@ -345,81 +538,863 @@ func (x *TaskResultResponse) GetMessage() string {
 	return ""
 }
 
-var File_proto_calculator_proto protoreflect.FileDescriptor
+func (x *TaskResultResponse) GetTaskId() int32 {
+	if x != nil {
+		return x.TaskId
+	}
+	return 0
+}
 
-const file_proto_calculator_proto_rawDesc = "" +
-	"\n" +
-	"\x16proto/calculator.proto\x12\n" +
-	"calculator\"\x10\n" +
-	"\x0eGetTaskRequest\"\xad\x02\n" +
-	"\fTaskResponse\x12\x17\n" +
-	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12#\n" +
-	"\rexpression_id\x18\x02 \x01(\x05R\fexpressionId\x12\x1c\n" +
-	"\toperation\x18\x03 \x01(\tR\toperation\x12%\n" +
-	"\x0eoperation_time\x18\x04 \x01(\x05R\roperationTime\x12!\n" +
-	"\vnumber_arg1\x18\x05 \x01(\x01H\x00R\n" +
-	"numberArg1\x12!\n" +
-	"\vstring_arg1\x18\x06 \x01(\tH\x00R\n" +
-	"stringArg1\x12!\n" +
-	"\vnumber_arg2\x18\a \x01(\x01H\x01R\n" +
-	"numberArg2\x12!\n" +
-	"\vstring_arg2\x18\b \x01(\tH\x01R\n" +
-	"stringArg2B\x06\n" +
-	"\x04arg1B\x06\n" +
-	"\x04arg2\"\x84\x01\n" +
-	"\x11TaskResultRequest\x12\x17\n" +
-	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12\x16\n" +
-	"\x06result\x18\x02 \x01(\x01R\x06result\x12\x19\n" +
-	"\bis_error\x18\x03 \x01(\bR\aisError\x12#\n" +
-	"\rerror_message\x18\x04 \x01(\tR\ferrorMessage\"H\n" +
-	"\x12TaskResultResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\xa2\x01\n" +
-	"\fAgentService\x12?\n" +
-	"\aGetTask\x12\x1a.calculator.GetTaskRequest\x1a\x18.calculator.TaskResponse\x12Q\n" +
-	"\x10SubmitTaskResult\x12\x1d.calculator.TaskResultRequest\x1a\x1e.calculator.TaskResultResponseB*Z(github.com/neptship/calc-yandex-go/protob\x06proto3"
+// ExtendLeaseRequest asks to keep the task assigned to the agent
+type ExtendLeaseRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	TaskId  int32                  `protobuf:"varint,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	LeaseId string                 `protobuf:"bytes,2,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	// Agent holding the lease
+	AgentId       string `protobuf:"bytes,3,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-var (
-	file_proto_calculator_proto_rawDescOnce sync.Once
-	file_proto_calculator_proto_rawDescData []byte
-)
+func (x *ExtendLeaseRequest) Reset() {
+	*x = ExtendLeaseRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
 
-func file_proto_calculator_proto_rawDescGZIP() []byte {
-	file_proto_calculator_proto_rawDescOnce.Do(func() {
-		file_proto_calculator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_calculator_proto_rawDesc), len(file_proto_calculator_proto_rawDesc)))
-	})
-	return file_proto_calculator_proto_rawDescData
+func (x *ExtendLeaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_proto_calculator_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
-var file_proto_calculator_proto_goTypes = []any{
-	(*GetTaskRequest)(nil),     // 0: calculator.GetTaskRequest
-	(*TaskResponse)(nil),       // 1: calculator.TaskResponse
-	(*TaskResultRequest)(nil),  // 2: calculator.TaskResultRequest
-	(*TaskResultResponse)(nil), // 3: calculator.TaskResultResponse
+func (*ExtendLeaseRequest) ProtoMessage() {}
+
+func (x *ExtendLeaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_proto_calculator_proto_depIdxs = []int32{
-	0, // 0: calculator.AgentService.GetTask:input_type -> calculator.GetTaskRequest
-	2, // 1: calculator.AgentService.SubmitTaskResult:input_type -> calculator.TaskResultRequest
-	1, // 2: calculator.AgentService.GetTask:output_type -> calculator.TaskResponse
-	3, // 3: calculator.AgentService.SubmitTaskResult:output_type -> calculator.TaskResultResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+
+// Deprecated: Use ExtendLeaseRequest.ProtoReflect.Descriptor instead.
+func (*ExtendLeaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{5}
 }
 
-func init() { file_proto_calculator_proto_init() }
-func file_proto_calculator_proto_init() {
-	if File_proto_calculator_proto != nil {
-		return
+func (x *ExtendLeaseRequest) GetTaskId() int32 {
+	if x != nil {
+		return x.TaskId
 	}
-	file_proto_calculator_proto_msgTypes[1].OneofWrappers = []any{
-		(*TaskResponse_NumberArg1)(nil),
-		(*TaskResponse_StringArg1)(nil),
-		(*TaskResponse_NumberArg2)(nil),
-		(*TaskResponse_StringArg2)(nil),
+	return 0
+}
+
+func (x *ExtendLeaseRequest) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+func (x *ExtendLeaseRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+// ExtendLeaseResponse contains the new lease deadline
+type ExtendLeaseResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Success        bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message        string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	LeaseExpiresAt int64                  `protobuf:"varint,3,opt,name=lease_expires_at,json=leaseExpiresAt,proto3" json:"lease_expires_at,omitempty"`
+	// Cancelled is set when the expression was cancelled or failed and the task should be abandoned
+	Cancelled     bool `protobuf:"varint,4,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtendLeaseResponse) Reset() {
+	*x = ExtendLeaseResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtendLeaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtendLeaseResponse) ProtoMessage() {}
+
+func (x *ExtendLeaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtendLeaseResponse.ProtoReflect.Descriptor instead.
+func (*ExtendLeaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExtendLeaseResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ExtendLeaseResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ExtendLeaseResponse) GetLeaseExpiresAt() int64 {
+	if x != nil {
+		return x.LeaseExpiresAt
+	}
+	return 0
+}
+
+func (x *ExtendLeaseResponse) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+// AgentMessage is sent by the agent on TaskStream
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*AgentMessage_Slots
+	//	*AgentMessage_Result
+	Payload       isAgentMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_proto_calculator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AgentMessage) GetPayload() isAgentMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetSlots() *SlotsAvailable {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Slots); ok {
+			return x.Slots
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetResult() *TaskResultRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isAgentMessage_Payload interface {
+	isAgentMessage_Payload()
+}
+
+type AgentMessage_Slots struct {
+	Slots *SlotsAvailable `protobuf:"bytes,1,opt,name=slots,proto3,oneof"`
+}
+
+type AgentMessage_Result struct {
+	Result *TaskResultRequest `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*AgentMessage_Slots) isAgentMessage_Payload() {}
+
+func (*AgentMessage_Result) isAgentMessage_Payload() {}
+
+// SlotsAvailable tells the orchestrator that count more tasks can be sent.
+// The agent announces all of its slots after connecting and one more every
+// time a slot frees up
+type SlotsAvailable struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Count int32                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	// Agent the tasks are assigned to; empty for agents that did not register
+	AgentId       string `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SlotsAvailable) Reset() {
+	*x = SlotsAvailable{}
+	mi := &file_proto_calculator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SlotsAvailable) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SlotsAvailable) ProtoMessage() {}
+
+func (x *SlotsAvailable) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SlotsAvailable.ProtoReflect.Descriptor instead.
+func (*SlotsAvailable) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SlotsAvailable) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *SlotsAvailable) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+// OrchestratorMessage is sent by the orchestrator on TaskStream
+type OrchestratorMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*OrchestratorMessage_Task
+	//	*OrchestratorMessage_Result
+	//	*OrchestratorMessage_Cancel
+	Payload       isOrchestratorMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrchestratorMessage) Reset() {
+	*x = OrchestratorMessage{}
+	mi := &file_proto_calculator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrchestratorMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrchestratorMessage) ProtoMessage() {}
+
+func (x *OrchestratorMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrchestratorMessage.ProtoReflect.Descriptor instead.
+func (*OrchestratorMessage) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *OrchestratorMessage) GetPayload() isOrchestratorMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetTask() *TaskResponse {
+	if x != nil {
+		if x, ok := x.Payload.(*OrchestratorMessage_Task); ok {
+			return x.Task
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetResult() *TaskResultResponse {
+	if x != nil {
+		if x, ok := x.Payload.(*OrchestratorMessage_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetCancel() *TaskCancel {
+	if x != nil {
+		if x, ok := x.Payload.(*OrchestratorMessage_Cancel); ok {
+			return x.Cancel
+		}
+	}
+	return nil
+}
+
+type isOrchestratorMessage_Payload interface {
+	isOrchestratorMessage_Payload()
+}
+
+type OrchestratorMessage_Task struct {
+	Task *TaskResponse `protobuf:"bytes,1,opt,name=task,proto3,oneof"`
+}
+
+type OrchestratorMessage_Result struct {
+	Result *TaskResultResponse `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+type OrchestratorMessage_Cancel struct {
+	Cancel *TaskCancel `protobuf:"bytes,3,opt,name=cancel,proto3,oneof"`
+}
+
+func (*OrchestratorMessage_Task) isOrchestratorMessage_Payload() {}
+
+func (*OrchestratorMessage_Result) isOrchestratorMessage_Payload() {}
+
+func (*OrchestratorMessage_Cancel) isOrchestratorMessage_Payload() {}
+
+// TaskCancel tells the agent to abandon a task whose expression was
+// cancelled or failed; its lease is no longer valid
+type TaskCancel struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        int32                  `protobuf:"varint,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	LeaseId       string                 `protobuf:"bytes,2,opt,name=lease_id,json=leaseId,proto3" json:"lease_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskCancel) Reset() {
+	*x = TaskCancel{}
+	mi := &file_proto_calculator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskCancel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskCancel) ProtoMessage() {}
+
+func (x *TaskCancel) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskCancel.ProtoReflect.Descriptor instead.
+func (*TaskCancel) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TaskCancel) GetTaskId() int32 {
+	if x != nil {
+		return x.TaskId
+	}
+	return 0
+}
+
+func (x *TaskCancel) GetLeaseId() string {
+	if x != nil {
+		return x.LeaseId
+	}
+	return ""
+}
+
+// RegisterRequest identifies an agent
+type RegisterRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	AgentId  string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Hostname string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Version  string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	// Number of tasks the agent calculates at once (COMPUTING_POWER)
+	Capacity      int32 `protobuf:"varint,4,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *RegisterRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+// RegisterResponse tells the agent how often to send heartbeats
+type RegisterResponse struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Success             bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message             string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	HeartbeatIntervalMs int64                  `protobuf:"varint,3,opt,name=heartbeat_interval_ms,json=heartbeatIntervalMs,proto3" json:"heartbeat_interval_ms,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RegisterResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RegisterResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetHeartbeatIntervalMs() int64 {
+	if x != nil {
+		return x.HeartbeatIntervalMs
+	}
+	return 0
+}
+
+// HeartbeatRequest is sent periodically by a registered agent
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_proto_calculator_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *HeartbeatRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+// HeartbeatResponse asks the agent to register again when the orchestrator
+// does not know it, e.g. after a restart or when the agent was expired
+type HeartbeatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Reregister    bool                   `protobuf:"varint,3,opt,name=reregister,proto3" json:"reregister,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_proto_calculator_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_calculator_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_calculator_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *HeartbeatResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *HeartbeatResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *HeartbeatResponse) GetReregister() bool {
+	if x != nil {
+		return x.Reregister
+	}
+	return false
+}
+
+var File_proto_calculator_proto protoreflect.FileDescriptor
+
+const file_proto_calculator_proto_rawDesc = "" +
+	"\n" +
+	"\x16proto/calculator.proto\x12\n" +
+	"calculator\"+\n" +
+	"\x0eGetTaskRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"\xc3\x04\n" +
+	"\fTaskResponse\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12#\n" +
+	"\rexpression_id\x18\x02 \x01(\x05R\fexpressionId\x12\x1c\n" +
+	"\toperation\x18\x03 \x01(\tR\toperation\x12%\n" +
+	"\x0eoperation_time\x18\x04 \x01(\x05R\roperationTime\x12!\n" +
+	"\vnumber_arg1\x18\x05 \x01(\x01H\x00R\n" +
+	"numberArg1\x12!\n" +
+	"\vstring_arg1\x18\x06 \x01(\tH\x00R\n" +
+	"stringArg1\x12!\n" +
+	"\vnumber_arg2\x18\a \x01(\x01H\x01R\n" +
+	"numberArg2\x12!\n" +
+	"\vstring_arg2\x18\b \x01(\tH\x01R\n" +
+	"stringArg2\x12\x19\n" +
+	"\blease_id\x18\t \x01(\tR\aleaseId\x12(\n" +
+	"\x10lease_expires_at\x18\n" +
+	" \x01(\x03R\x0eleaseExpiresAt\x12'\n" +
+	"\x04args\x18\v \x03(\v2\x13.calculator.OperandR\x04args\x12\x14\n" +
+	"\x05exact\x18\f \x01(\bR\x05exact\x12O\n" +
+	"\rtrace_context\x18\r \x03(\v2*.calculator.TaskResponse.TraceContextEntryR\ftraceContext\x1a?\n" +
+	"\x11TraceContextEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x06\n" +
+	"\x04arg1B\x06\n" +
+	"\x04arg2\"^\n" +
+	"\aOperand\x12\x18\n" +
+	"\x06number\x18\x01 \x01(\x01H\x00R\x06number\x12\x12\n" +
+	"\x03ref\x18\x02 \x01(\tH\x00R\x03ref\x12\x1c\n" +
+	"\brational\x18\x03 \x01(\tH\x00R\brationalB\a\n" +
+	"\x05value\"\xf4\x02\n" +
+	"\x11TaskResultRequest\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\x01R\x06result\x12\x19\n" +
+	"\bis_error\x18\x03 \x01(\bR\aisError\x12#\n" +
+	"\rerror_message\x18\x04 \x01(\tR\ferrorMessage\x12\x19\n" +
+	"\blease_id\x18\x05 \x01(\tR\aleaseId\x12!\n" +
+	"\fexact_result\x18\x06 \x01(\tR\vexactResult\x12\x19\n" +
+	"\bagent_id\x18\a \x01(\tR\aagentId\x12T\n" +
+	"\rtrace_context\x18\b \x03(\v2/.calculator.TaskResultRequest.TraceContextEntryR\ftraceContext\x1a?\n" +
+	"\x11TraceContextEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"a\n" +
+	"\x12TaskResultResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x17\n" +
+	"\atask_id\x18\x03 \x01(\x05R\x06taskId\"c\n" +
+	"\x12ExtendLeaseRequest\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12\x19\n" +
+	"\blease_id\x18\x02 \x01(\tR\aleaseId\x12\x19\n" +
+	"\bagent_id\x18\x03 \x01(\tR\aagentId\"\x91\x01\n" +
+	"\x13ExtendLeaseResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12(\n" +
+	"\x10lease_expires_at\x18\x03 \x01(\x03R\x0eleaseExpiresAt\x12\x1c\n" +
+	"\tcancelled\x18\x04 \x01(\bR\tcancelled\"\x86\x01\n" +
+	"\fAgentMessage\x122\n" +
+	"\x05slots\x18\x01 \x01(\v2\x1a.calculator.SlotsAvailableH\x00R\x05slots\x127\n" +
+	"\x06result\x18\x02 \x01(\v2\x1d.calculator.TaskResultRequestH\x00R\x06resultB\t\n" +
+	"\apayload\"A\n" +
+	"\x0eSlotsAvailable\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\"\xbc\x01\n" +
+	"\x13OrchestratorMessage\x12.\n" +
+	"\x04task\x18\x01 \x01(\v2\x18.calculator.TaskResponseH\x00R\x04task\x128\n" +
+	"\x06result\x18\x02 \x01(\v2\x1e.calculator.TaskResultResponseH\x00R\x06result\x120\n" +
+	"\x06cancel\x18\x03 \x01(\v2\x16.calculator.TaskCancelH\x00R\x06cancelB\t\n" +
+	"\apayload\"@\n" +
+	"\n" +
+	"TaskCancel\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\x05R\x06taskId\x12\x19\n" +
+	"\blease_id\x18\x02 \x01(\tR\aleaseId\"~\n" +
+	"\x0fRegisterRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x12\x1a\n" +
+	"\bcapacity\x18\x04 \x01(\x05R\bcapacity\"z\n" +
+	"\x10RegisterResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x122\n" +
+	"\x15heartbeat_interval_ms\x18\x03 \x01(\x03R\x13heartbeatIntervalMs\"-\n" +
+	"\x10HeartbeatRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"g\n" +
+	"\x11HeartbeatResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1e\n" +
+	"\n" +
+	"reregister\x18\x03 \x01(\bR\n" +
+	"reregister2\xd0\x03\n" +
+	"\fAgentService\x12?\n" +
+	"\aGetTask\x12\x1a.calculator.GetTaskRequest\x1a\x18.calculator.TaskResponse\x12Q\n" +
+	"\x10SubmitTaskResult\x12\x1d.calculator.TaskResultRequest\x1a\x1e.calculator.TaskResultResponse\x12N\n" +
+	"\vExtendLease\x12\x1e.calculator.ExtendLeaseRequest\x1a\x1f.calculator.ExtendLeaseResponse\x12K\n" +
+	"\n" +
+	"TaskStream\x12\x18.calculator.AgentMessage\x1a\x1f.calculator.OrchestratorMessage(\x010\x01\x12E\n" +
+	"\bRegister\x12\x1b.calculator.RegisterRequest\x1a\x1c.calculator.RegisterResponse\x12H\n" +
+	"\tHeartbeat\x12\x1c.calculator.HeartbeatRequest\x1a\x1d.calculator.HeartbeatResponseB*Z(github.com/neptship/calc-yandex-go/protob\x06proto3"
+
+var (
+	file_proto_calculator_proto_rawDescOnce sync.Once
+	file_proto_calculator_proto_rawDescData []byte
+)
+
+func file_proto_calculator_proto_rawDescGZIP() []byte {
+	file_proto_calculator_proto_rawDescOnce.Do(func() {
+		file_proto_calculator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_calculator_proto_rawDesc), len(file_proto_calculator_proto_rawDesc)))
+	})
+	return file_proto_calculator_proto_rawDescData
+}
+
+var file_proto_calculator_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_proto_calculator_proto_goTypes = []any{
+	(*GetTaskRequest)(nil),      // 0: calculator.GetTaskRequest
+	(*TaskResponse)(nil),        // 1: calculator.TaskResponse
+	(*Operand)(nil),             // 2: calculator.Operand
+	(*TaskResultRequest)(nil),   // 3: calculator.TaskResultRequest
+	(*TaskResultResponse)(nil),  // 4: calculator.TaskResultResponse
+	(*ExtendLeaseRequest)(nil),  // 5: calculator.ExtendLeaseRequest
+	(*ExtendLeaseResponse)(nil), // 6: calculator.ExtendLeaseResponse
+	(*AgentMessage)(nil),        // 7: calculator.AgentMessage
+	(*SlotsAvailable)(nil),      // 8: calculator.SlotsAvailable
+	(*OrchestratorMessage)(nil), // 9: calculator.OrchestratorMessage
+	(*TaskCancel)(nil),          // 10: calculator.TaskCancel
+	(*RegisterRequest)(nil),     // 11: calculator.RegisterRequest
+	(*RegisterResponse)(nil),    // 12: calculator.RegisterResponse
+	(*HeartbeatRequest)(nil),    // 13: calculator.HeartbeatRequest
+	(*HeartbeatResponse)(nil),   // 14: calculator.HeartbeatResponse
+	nil,                         // 15: calculator.TaskResponse.TraceContextEntry
+	nil,                         // 16: calculator.TaskResultRequest.TraceContextEntry
+}
+var file_proto_calculator_proto_depIdxs = []int32{
+	2,  // 0: calculator.TaskResponse.args:type_name -> calculator.Operand
+	15, // 1: calculator.TaskResponse.trace_context:type_name -> calculator.TaskResponse.TraceContextEntry
+	16, // 2: calculator.TaskResultRequest.trace_context:type_name -> calculator.TaskResultRequest.TraceContextEntry
+	8,  // 3: calculator.AgentMessage.slots:type_name -> calculator.SlotsAvailable
+	3,  // 4: calculator.AgentMessage.result:type_name -> calculator.TaskResultRequest
+	1,  // 5: calculator.OrchestratorMessage.task:type_name -> calculator.TaskResponse
+	4,  // 6: calculator.OrchestratorMessage.result:type_name -> calculator.TaskResultResponse
+	10, // 7: calculator.OrchestratorMessage.cancel:type_name -> calculator.TaskCancel
+	0,  // 8: calculator.AgentService.GetTask:input_type -> calculator.GetTaskRequest
+	3,  // 9: calculator.AgentService.SubmitTaskResult:input_type -> calculator.TaskResultRequest
+	5,  // 10: calculator.AgentService.ExtendLease:input_type -> calculator.ExtendLeaseRequest
+	7,  // 11: calculator.AgentService.TaskStream:input_type -> calculator.AgentMessage
+	11, // 12: calculator.AgentService.Register:input_type -> calculator.RegisterRequest
+	13, // 13: calculator.AgentService.Heartbeat:input_type -> calculator.HeartbeatRequest
+	1,  // 14: calculator.AgentService.GetTask:output_type -> calculator.TaskResponse
+	4,  // 15: calculator.AgentService.SubmitTaskResult:output_type -> calculator.TaskResultResponse
+	6,  // 16: calculator.AgentService.ExtendLease:output_type -> calculator.ExtendLeaseResponse
+	9,  // 17: calculator.AgentService.TaskStream:output_type -> calculator.OrchestratorMessage
+	12, // 18: calculator.AgentService.Register:output_type -> calculator.RegisterResponse
+	14, // 19: calculator.AgentService.Heartbeat:output_type -> calculator.HeartbeatResponse
+	14, // [14:20] is the sub-list for method output_type
+	8,  // [8:14] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_proto_calculator_proto_init() }
+func file_proto_calculator_proto_init() {
+	if File_proto_calculator_proto != nil {
+		return
+	}
+	file_proto_calculator_proto_msgTypes[1].OneofWrappers = []any{
+		(*TaskResponse_NumberArg1)(nil),
+		(*TaskResponse_StringArg1)(nil),
+		(*TaskResponse_NumberArg2)(nil),
+		(*TaskResponse_StringArg2)(nil),
+	}
+	file_proto_calculator_proto_msgTypes[2].OneofWrappers = []any{
+		(*Operand_Number)(nil),
+		(*Operand_Ref)(nil),
+		(*Operand_Rational)(nil),
+	}
+	file_proto_calculator_proto_msgTypes[7].OneofWrappers = []any{
+		(*AgentMessage_Slots)(nil),
+		(*AgentMessage_Result)(nil),
+	}
+	file_proto_calculator_proto_msgTypes[9].OneofWrappers = []any{
+		(*OrchestratorMessage_Task)(nil),
+		(*OrchestratorMessage_Result)(nil),
+		(*OrchestratorMessage_Cancel)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -427,7 +1402,7 @@ func file_proto_calculator_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_calculator_proto_rawDesc), len(file_proto_calculator_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -21,18 +21,33 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	AgentService_GetTask_FullMethodName          = "/calculator.AgentService/GetTask"
 	AgentService_SubmitTaskResult_FullMethodName = "/calculator.AgentService/SubmitTaskResult"
+	AgentService_ExtendLease_FullMethodName      = "/calculator.AgentService/ExtendLease"
+	AgentService_TaskStream_FullMethodName       = "/calculator.AgentService/TaskStream"
+	AgentService_Register_FullMethodName         = "/calculator.AgentService/Register"
+	AgentService_Heartbeat_FullMethodName        = "/calculator.AgentService/Heartbeat"
 )
 
 // AgentServiceClient is the client API for AgentService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 //
-// AgentService defines the service interface between orchestrator and agents
+// AgentService defines the service interface between orchestrator and agents.
+// Agents authenticate with a pre-shared token sent as "authorization: Bearer <token>"
+// metadata or with a client certificate whose common name is the agent ID
 type AgentServiceClient interface {
 	// GetTask retrieves a task from the orchestrator
 	GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*TaskResponse, error)
 	// SubmitTaskResult sends the calculated result back to the orchestrator
 	SubmitTaskResult(ctx context.Context, in *TaskResultRequest, opts ...grpc.CallOption) (*TaskResultResponse, error)
+	// ExtendLease keeps a task assigned to the agent while it is being calculated
+	ExtendLease(ctx context.Context, in *ExtendLeaseRequest, opts ...grpc.CallOption) (*ExtendLeaseResponse, error)
+	// TaskStream replaces polling: the agent announces free slots and sends results,
+	// the orchestrator pushes tasks as soon as they become ready
+	TaskStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error)
+	// Register announces the agent; it is repeated when a heartbeat is rejected
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Heartbeat keeps the agent in the registry; silent agents lose their tasks
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 }
 
 type agentServiceClient struct {
@@ -63,16 +78,70 @@ func (c *agentServiceClient) SubmitTaskResult(ctx context.Context, in *TaskResul
 	return out, nil
 }
 
+func (c *agentServiceClient) ExtendLease(ctx context.Context, in *ExtendLeaseRequest, opts ...grpc.CallOption) (*ExtendLeaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExtendLeaseResponse)
+	err := c.cc.Invoke(ctx, AgentService_ExtendLease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) TaskStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[0], AgentService_TaskStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentMessage, OrchestratorMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_TaskStreamClient = grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage]
+
+func (c *agentServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, AgentService_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, AgentService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AgentServiceServer is the server API for AgentService service.
 // All implementations must embed UnimplementedAgentServiceServer
 // for forward compatibility.
 //
-// AgentService defines the service interface between orchestrator and agents
+// AgentService defines the service interface between orchestrator and agents.
+// Agents authenticate with a pre-shared token sent as "authorization: Bearer <token>"
+// metadata or with a client certificate whose common name is the agent ID
 type AgentServiceServer interface {
 	// GetTask retrieves a task from the orchestrator
 	GetTask(context.Context, *GetTaskRequest) (*TaskResponse, error)
 	// SubmitTaskResult sends the calculated result back to the orchestrator
 	SubmitTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error)
+	// ExtendLease keeps a task assigned to the agent while it is being calculated
+	ExtendLease(context.Context, *ExtendLeaseRequest) (*ExtendLeaseResponse, error)
+	// TaskStream replaces polling: the agent announces free slots and sends results,
+	// the orchestrator pushes tasks as soon as they become ready
+	TaskStream(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error
+	// Register announces the agent; it is repeated when a heartbeat is rejected
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Heartbeat keeps the agent in the registry; silent agents lose their tasks
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	mustEmbedUnimplementedAgentServiceServer()
 }
 
@@ -89,6 +158,18 @@ func (UnimplementedAgentServiceServer) GetTask(context.Context, *GetTaskRequest)
 func (UnimplementedAgentServiceServer) SubmitTaskResult(context.Context, *TaskResultRequest) (*TaskResultResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SubmitTaskResult not implemented")
 }
+func (UnimplementedAgentServiceServer) ExtendLease(context.Context, *ExtendLeaseRequest) (*ExtendLeaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExtendLease not implemented")
+}
+func (UnimplementedAgentServiceServer) TaskStream(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method TaskStream not implemented")
+}
+func (UnimplementedAgentServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedAgentServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
 func (UnimplementedAgentServiceServer) mustEmbedUnimplementedAgentServiceServer() {}
 func (UnimplementedAgentServiceServer) testEmbeddedByValue()                      {}
 
@@ -146,6 +227,67 @@ func _AgentService_SubmitTaskResult_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AgentService_ExtendLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExtendLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ExtendLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_ExtendLease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ExtendLease(ctx, req.(*ExtendLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_TaskStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).TaskStream(&grpc.GenericServerStream[AgentMessage, OrchestratorMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentService_TaskStreamServer = grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]
+
+func _AgentService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -161,7 +303,26 @@ var AgentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SubmitTaskResult",
 			Handler:    _AgentService_SubmitTaskResult_Handler,
 		},
+		{
+			MethodName: "ExtendLease",
+			Handler:    _AgentService_ExtendLease_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _AgentService_Register_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _AgentService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TaskStream",
+			Handler:       _AgentService_TaskStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/calculator.proto",
 }